@@ -0,0 +1,212 @@
+// Package batch keeps the state of scans of large lists of domains on disk:
+// a checkpoint of the completed domains, so an interrupted scan resumes where
+// it left off, and the results, appended as every domain completes.
+//
+// Both files are appended a line at a time and synced, a partial last line
+// left by a crash is dropped when the file is opened again.
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// DefaultSize is the default number of domains scanned at a time.
+const DefaultSize = 1000
+
+// DefaultAttempts is the default number of scans of a domain with checks
+// that could not be completed, before it is given up on.
+const DefaultAttempts = 3
+
+// DefaultRetryDelay is the default delay before scanning a domain again after
+// its first failed attempt, it doubles with every attempt.
+const DefaultRetryDelay = 10 * time.Second
+
+// failed marks the checkpoint lines recording a failed attempt.
+const failed = "failed"
+
+// openAppend opens the file at path for appending, creating it if needed,
+// and returns it with the size of its complete lines.
+func openAppend(path string) (*os.File, int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	end, err := lineEnd(f, size)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	// drop the partial line of an interrupted write
+	if end < size {
+		if err := f.Truncate(end); err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+
+		if _, err := f.Seek(end, io.SeekStart); err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+	}
+
+	return f, end, nil
+}
+
+// lineEnd returns the offset past the last newline in the first size bytes
+// of r, reading back from size only as far as that newline.
+func lineEnd(r io.ReaderAt, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+
+	for off := size; off > 0; {
+		n := int64(len(buf))
+		if n > off {
+			n = off
+		}
+
+		off -= n
+
+		if _, err := r.ReadAt(buf[:n], off); err != nil {
+			return 0, err
+		}
+
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i != -1 {
+			return off + int64(i) + 1, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// appendLine writes line to f, and syncs it to disk.
+func appendLine(f *os.File, line []byte) error {
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// Checkpoint records the completed domains, a domain per line, and the
+// failed attempts to scan a domain, as the domain followed by "failed".
+type Checkpoint struct {
+	f        *os.File
+	done     map[string]bool
+	attempts map[string]int
+}
+
+// OpenCheckpoint opens the checkpoint at path, creating it if needed, with
+// the domains completed and attempted before.
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	f, size, err := openAppend(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := &Checkpoint{
+		f:        f,
+		done:     map[string]bool{},
+		attempts: map[string]int{},
+	}
+
+	scanner := bufio.NewScanner(io.NewSectionReader(f, 0, size))
+	for scanner.Scan() {
+		switch fields := strings.Fields(scanner.Text()); {
+		case len(fields) == 1:
+			cp.done[fields[0]] = true
+		case len(fields) == 2 && fields[1] == failed:
+			cp.attempts[fields[0]]++
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return cp, nil
+}
+
+// Done returns whether domain was completed.
+func (cp *Checkpoint) Done(domain string) bool {
+	return cp.done[domain]
+}
+
+// Len returns the number of completed domains.
+func (cp *Checkpoint) Len() int {
+	return len(cp.done)
+}
+
+// Add records domain as completed.
+func (cp *Checkpoint) Add(domain string) error {
+	if err := appendLine(cp.f, []byte(domain)); err != nil {
+		return err
+	}
+
+	cp.done[domain] = true
+	return nil
+}
+
+// Fail records a failed attempt to scan domain, and returns the number of
+// failed attempts so far.
+func (cp *Checkpoint) Fail(domain string) (int, error) {
+	if err := appendLine(cp.f, []byte(domain+" "+failed)); err != nil {
+		return 0, err
+	}
+
+	cp.attempts[domain]++
+	return cp.attempts[domain], nil
+}
+
+// Close closes the checkpoint.
+func (cp *Checkpoint) Close() error {
+	return cp.f.Close()
+}
+
+// Results appends the result of every domain to a file, as a JSON object per
+// line. A domain scanned again, like after failing, is appended again, the
+// last result counts.
+type Results struct {
+	f *os.File
+}
+
+// OpenResults opens the results at path for appending, creating it if
+// needed. The results written before aren't read.
+func OpenResults(path string) (*Results, error) {
+	f, _, err := openAppend(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Results{f: f}, nil
+}
+
+// Write appends the result of d.
+func (r *Results) Write(d *report.Domain) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	return appendLine(r.f, data)
+}
+
+// Close closes the results.
+func (r *Results) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,184 @@
+package batch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dutchcoders/checkmail/input"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "results.ndjson.checkpoint")
+
+	cp, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cp.Add("example.com")
+
+	for i := 1; i <= 2; i++ {
+		if n, err := cp.Fail("example.org"); err != nil {
+			t.Fatal(err)
+		} else if n != i {
+			t.Errorf("got %d attempts, expected %d", n, i)
+		}
+	}
+
+	cp.Close()
+
+	// a crash left a partial line
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.WriteString("example.ne")
+	f.Close()
+
+	cp, err = OpenCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer cp.Close()
+
+	if !cp.Done("example.com") || cp.Done("example.org") || cp.Done("example.ne") || cp.Len() != 1 {
+		t.Errorf("got done example.com %t, example.org %t, example.ne %t, %d in total, expected only example.com", cp.Done("example.com"), cp.Done("example.org"), cp.Done("example.ne"), cp.Len())
+	}
+
+	if n, _ := cp.Fail("example.org"); n != 3 {
+		t.Errorf("got %d attempts, expected the attempts before resuming to count", n)
+	}
+
+	cp.Add("example.net")
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "example.com\nexample.org failed\nexample.org failed\nexample.org failed\nexample.net\n"
+	if string(data) != expected {
+		t.Errorf("got checkpoint %q, expected %q", data, expected)
+	}
+}
+
+func TestOpenResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "results.ndjson")
+
+	// complete lines spanning more than a read back, and a partial line
+	// longer than a read back
+	lines := strings.Repeat(`{"domain":"example.com"}`+"\n", 1000)
+
+	for _, tt := range []struct {
+		name    string
+		data    string
+		partial string
+	}{
+		{"empty", "", ""},
+		{"complete", lines, ""},
+		{"partial", lines, `{"domain":"example.ne`},
+		{"long partial", lines, `{"domain":"` + strings.Repeat("x", 10000)},
+		{"only partial", "", `{"domain":"example.ne`},
+	} {
+		if err := ioutil.WriteFile(path, []byte(tt.data+tt.partial), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		results, err := OpenResults(path)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+
+		if err := appendLine(results.f, []byte(`{"domain":"example.org"}`)); err != nil {
+			t.Fatal(err)
+		}
+
+		results.Close()
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := tt.data + `{"domain":"example.org"}` + "\n"; string(data) != expected {
+			t.Errorf("%s: got %d bytes, expected %d with the partial line dropped", tt.name, len(data), len(expected))
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	targets := func(domains ...string) []input.Target {
+		result := []input.Target{}
+		for _, domain := range domains {
+			result = append(result, input.Target{Domain: domain})
+		}
+
+		return result
+	}
+
+	q := NewQueue(targets("a.example", "b.example", "c.example"), 50*time.Millisecond)
+
+	ctx := context.Background()
+
+	if next, _ := q.Next(ctx, 2); !reflect.DeepEqual(next, targets("a.example", "b.example")) {
+		t.Errorf("got %v, expected the first batch", next)
+	}
+
+	// b failed a second time, its delay doubled
+	q.Retry(input.Target{Domain: "b.example"}, 2)
+	q.Retry(input.Target{Domain: "a.example"}, 1)
+
+	// retries aren't due yet
+	if next, _ := q.Next(ctx, 2); !reflect.DeepEqual(next, targets("c.example")) {
+		t.Errorf("got %v, expected the rest of the domains", next)
+	}
+
+	if q.Len() != 2 {
+		t.Errorf("got %d left, expected the 2 retries", q.Len())
+	}
+
+	// only retries are left, wait for the first
+	started := time.Now()
+
+	if next, _ := q.Next(ctx, 2); !reflect.DeepEqual(next, targets("a.example")) {
+		t.Errorf("got %v, expected the first retry", next)
+	} else if waited := time.Since(started); waited < 40*time.Millisecond {
+		t.Errorf("waited %s, expected to wait for the delay", waited)
+	}
+
+	// and gives up when ctx is done
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if _, err := q.Next(cancelled, 2); err != context.Canceled {
+		t.Errorf("got error %v, expected %v", err, context.Canceled)
+	}
+
+	if next, _ := q.Next(ctx, 2); !reflect.DeepEqual(next, targets("b.example")) {
+		t.Errorf("got %v, expected the second retry", next)
+	} else if q.Len() != 0 {
+		t.Errorf("got %d left, expected none", q.Len())
+	}
+}
@@ -0,0 +1,82 @@
+package batch
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/dutchcoders/checkmail/input"
+)
+
+// Queue holds the domains left to scan, and the domains to scan again after
+// a failed attempt, once their delay passed.
+type Queue struct {
+	// Delay is the delay after the first failed attempt, it doubles with
+	// every attempt.
+	Delay time.Duration
+
+	pending []input.Target
+	retries []retry
+}
+
+type retry struct {
+	target input.Target
+	at     time.Time
+}
+
+// NewQueue returns a queue of targets, retried after delay.
+func NewQueue(targets []input.Target, delay time.Duration) *Queue {
+	return &Queue{
+		Delay:   delay,
+		pending: targets,
+	}
+}
+
+// Len returns the number of domains left, including the retries.
+func (q *Queue) Len() int {
+	return len(q.pending) + len(q.retries)
+}
+
+// Retry queues t to be scanned again after its attempt failed.
+func (q *Queue) Retry(t input.Target, attempt int) {
+	delay := q.Delay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+	}
+
+	q.retries = append(q.retries, retry{target: t, at: time.Now().Add(delay)})
+
+	sort.SliceStable(q.retries, func(i, j int) bool {
+		return q.retries[i].at.Before(q.retries[j].at)
+	})
+}
+
+// Next returns up to n domains to scan, the retries that are due after the
+// other domains. When only retries are left, it waits for the first to be
+// due or ctx to be done.
+func (q *Queue) Next(ctx context.Context, n int) ([]input.Target, error) {
+	if len(q.pending) == 0 && len(q.retries) > 0 {
+		timer := time.NewTimer(time.Until(q.retries[0].at))
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	now := time.Now()
+	for len(q.retries) > 0 && !q.retries[0].at.After(now) {
+		q.pending = append(q.pending, q.retries[0].target)
+		q.retries = q.retries[1:]
+	}
+
+	if n > len(q.pending) {
+		n = len(q.pending)
+	}
+
+	next := q.pending[:n]
+	q.pending = q.pending[n:]
+	return next, nil
+}
@@ -0,0 +1,234 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// TopFindings is the number of most common findings in a summary.
+const TopFindings = 20
+
+// Summary aggregates the results of all domains of a scan.
+type Summary struct {
+	Domains int `json:"domains"`
+
+	// Failed is the number of domains with checks that could not be
+	// completed.
+	Failed int `json:"failed"`
+
+	// Started and Finished are the times the first domain started and the
+	// last finished.
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+
+	// Grades counts the domains by grade, Score is their average score.
+	Grades map[string]int `json:"grades"`
+	Score  float64        `json:"score"`
+
+	// Findings counts the findings by severity.
+	Findings map[plugins.Severity]int `json:"findings"`
+
+	Checks []CheckSummary `json:"checks"`
+
+	// Top are the errors and warnings reported for most domains.
+	Top []FindingSummary `json:"top"`
+}
+
+// CheckSummary counts the domains by status of a check.
+type CheckSummary struct {
+	Plugin string `json:"plugin"`
+
+	Status map[report.Status]int `json:"status"`
+
+	// Failed is the number of domains the check could not be completed
+	// for.
+	Failed int `json:"failed"`
+}
+
+// FindingSummary counts the domains a finding was reported for.
+type FindingSummary struct {
+	Plugin   string           `json:"plugin"`
+	ID       string           `json:"id"`
+	Severity plugins.Severity `json:"severity"`
+
+	Domains int `json:"domains"`
+}
+
+// each calls fn with every result in the results at path, and its line
+// number. A partial last line is ignored.
+func each(path string, fn func(n int, line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := fn(n, line); err != nil {
+			return err
+		}
+	}
+}
+
+// Summarize aggregates the results at path, counting the last result of
+// every domain only.
+func Summarize(path string) (*Summary, error) {
+	last := map[string]int{}
+
+	if err := each(path, func(n int, line []byte) error {
+		var d struct {
+			Domain string `json:"domain"`
+		}
+
+		if err := json.Unmarshal(line, &d); err != nil {
+			return err
+		}
+
+		last[d.Domain] = n
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	s := &Summary{
+		Grades:   map[string]int{},
+		Findings: map[plugins.Severity]int{},
+		Checks:   []CheckSummary{},
+		Top:      []FindingSummary{},
+	}
+
+	// checks in the order first seen, which is plugin order
+	order := []string{}
+	checks := map[string]*CheckSummary{}
+
+	findings := map[string]*FindingSummary{}
+
+	scored, total := 0, 0
+
+	if err := each(path, func(n int, line []byte) error {
+		d := &report.Domain{}
+		if err := json.Unmarshal(line, d); err != nil {
+			return err
+		}
+
+		if last[d.Domain] != n {
+			return nil
+		}
+
+		s.Domains++
+
+		if s.Started.IsZero() || d.Started.Before(s.Started) {
+			s.Started = d.Started
+		}
+
+		if d.Finished.After(s.Finished) {
+			s.Finished = d.Finished
+		}
+
+		if d.Score != nil {
+			s.Grades[d.Score.Grade]++
+
+			scored++
+			total += d.Score.Score
+		}
+
+		failed := false
+		seen := map[string]bool{}
+
+		for _, c := range d.Checks {
+			cs, ok := checks[c.Plugin]
+			if !ok {
+				cs = &CheckSummary{
+					Plugin: c.Plugin,
+					Status: map[report.Status]int{},
+				}
+
+				checks[c.Plugin] = cs
+				order = append(order, c.Plugin)
+			}
+
+			cs.Status[c.Status()]++
+
+			if c.Failed() {
+				cs.Failed++
+				failed = true
+			}
+
+			for _, issue := range c.Issues {
+				if issue.Severity != plugins.SeverityDebug {
+					s.Findings[issue.Severity]++
+				}
+
+				if !issue.Severity.AtLeast(plugins.SeverityWarning) || seen[issue.ID] {
+					continue
+				}
+
+				seen[issue.ID] = true
+
+				fs, ok := findings[issue.ID]
+				if !ok {
+					fs = &FindingSummary{
+						Plugin:   issue.Plugin,
+						ID:       issue.ID,
+						Severity: issue.Severity,
+					}
+
+					findings[issue.ID] = fs
+				}
+
+				fs.Domains++
+			}
+		}
+
+		if failed {
+			s.Failed++
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if scored > 0 {
+		s.Score = float64(total) / float64(scored)
+	}
+
+	for _, plugin := range order {
+		s.Checks = append(s.Checks, *checks[plugin])
+	}
+
+	for _, fs := range findings {
+		s.Top = append(s.Top, *fs)
+	}
+
+	sort.Slice(s.Top, func(i, j int) bool {
+		if s.Top[i].Domains != s.Top[j].Domains {
+			return s.Top[i].Domains > s.Top[j].Domains
+		}
+
+		return s.Top[i].ID < s.Top[j].ID
+	})
+
+	if len(s.Top) > TopFindings {
+		s.Top = s.Top[:TopFindings]
+	}
+
+	return s, nil
+}
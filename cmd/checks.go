@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/minio/cli"
+
+	"github.com/dutchcoders/checkmail/config"
+	"github.com/dutchcoders/checkmail/plugins"
+)
+
+// splitValues splits flag values on comma, so both "--only spf,dmarc" and
+// "--only spf --only dmarc" work.
+func splitValues(values []string) []string {
+	result := []string{}
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				result = append(result, v)
+			}
+		}
+	}
+
+	return result
+}
+
+// selectPlugins returns the configured plugins to run. Plugins selected with
+// --only run even when disabled in the configuration.
+func selectPlugins(c *cli.Context, conf *config.Config) ([]plugins.Plugin, error) {
+	only := splitValues(c.GlobalStringSlice("only"))
+	skip := splitValues(c.GlobalStringSlice("skip"))
+
+	if err := plugins.ValidateSelectors(append(only, skip...)); err != nil {
+		return nil, err
+	}
+
+	selected := []plugins.Plugin{}
+
+	for _, p := range plugins.Plugins {
+		plugin := p()
+
+		pc := conf.Plugin(plugins.Key(plugin.Name()))
+
+		if len(only) > 0 && !plugins.Matches(plugin, only) {
+			continue
+		} else if len(only) == 0 && !pc.Enabled {
+			continue
+		} else if plugins.Matches(plugin, skip) {
+			continue
+		}
+
+		selected = append(selected, p(pluginOptions(pc)...))
+	}
+
+	return selected, nil
+}
+
+func ChecksAction(c *cli.Context) error {
+	conf, err := loadConfig(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	for _, p := range plugins.Plugins {
+		plugin := p()
+
+		key := plugins.Key(plugin.Name())
+
+		state := "enabled"
+		if !conf.Plugin(key).Enabled {
+			state = "disabled"
+		}
+
+		fmt.Printf("%s (%s, %s, %s)\n", plugin.Name(), key, plugin.Category(), state)
+		fmt.Printf("    %s\n", plugin.Description())
+
+		for _, finding := range plugin.Findings() {
+			fmt.Printf("    %-8s %s\n", finding.Severity, finding.ID)
+		}
+
+		fmt.Println("")
+	}
+
+	fmt.Printf("Every check can report %s when it exceeds its time budget.\n", plugins.FindingTimeout.ID)
+	return nil
+}
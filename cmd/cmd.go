@@ -1,15 +1,20 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/fatih/color"
 	"github.com/minio/cli"
 	"github.com/op/go-logging"
 
+	"github.com/dutchcoders/checkmail/diff"
+	"github.com/dutchcoders/checkmail/input"
+	"github.com/dutchcoders/checkmail/output"
 	"github.com/dutchcoders/checkmail/plugins"
-	"strings"
-	"sync"
+	"github.com/dutchcoders/checkmail/report"
+	"github.com/dutchcoders/checkmail/scanner"
+	"os"
 )
 
 var Version = "0.1"
@@ -37,12 +42,22 @@ var log = logging.MustGetLogger("check/cmd")
 var globalFlags = []cli.Flag{
 	cli.StringFlag{
 		Name:  "p,port",
-		Usage: "port",
+		Usage: "address the serve and exporter commands listen on",
 		Value: "127.0.0.1:8080",
 	},
 	cli.StringFlag{
 		Name:  "path",
-		Usage: "path to static files",
+		Usage: "path to static files served by the serve command",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "record",
+		Usage: "record all DNS exchanges and SMTP transcripts to a fixture bundle in this directory",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "replay",
+		Usage: "replay the fixture bundle in this directory instead of using the network",
 		Value: "",
 	},
 	cli.StringFlag{
@@ -50,6 +65,105 @@ var globalFlags = []cli.Flag{
 		Usage: "config file",
 		Value: "config.toml",
 	},
+	cli.StringFlag{
+		Name:  "o,output",
+		Usage: "output format (text, json, ndjson, sarif, junit or html), defaults to the configured format",
+		Value: "",
+	},
+	cli.StringSliceFlag{
+		Name:  "zone",
+		Usage: "zone files defining the checked records, as path or origin=path, findings point at their lines",
+		Value: &cli.StringSlice{},
+	},
+	cli.StringSliceFlag{
+		Name:  "resolver",
+		Usage: "resolvers to use: system, host[:port], tls://host[:port][#name] or https://url",
+		Value: &cli.StringSlice{},
+	},
+	cli.BoolFlag{
+		Name:  "iterative",
+		Usage: "resolve iteratively from the root servers, querying authoritative servers directly",
+	},
+	cli.StringSliceFlag{
+		Name:  "root-hints",
+		Usage: "root servers used by the iterative resolver, as host[:port]",
+		Value: &cli.StringSlice{},
+	},
+	cli.StringSliceFlag{
+		Name:  "only",
+		Usage: "only run the checks of these plugins or categories",
+		Value: &cli.StringSlice{},
+	},
+	cli.StringSliceFlag{
+		Name:  "skip",
+		Usage: "skip the checks of these plugins or categories",
+		Value: &cli.StringSlice{},
+	},
+	cli.StringFlag{
+		Name:  "i,input",
+		Usage: "file with the domains to check, - for stdin, in addition to the arguments",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "input-format",
+		Usage: "format of the input: auto, list or csv",
+		Value: input.FormatAuto,
+	},
+	cli.StringFlag{
+		Name:  "domain-column",
+		Usage: "column of a CSV input holding the domains, the other columns are passed through",
+		Value: input.DefaultColumn,
+	},
+	cli.IntFlag{
+		Name:  "workers",
+		Usage: "maximum number of checks running concurrently",
+		Value: scanner.DefaultWorkers,
+	},
+	cli.Float64Flag{
+		Name:  "dns-qps",
+		Usage: "maximum number of DNS queries per second, defaults to the config file, 0 disables",
+		Value: 0,
+	},
+	cli.Float64Flag{
+		Name:  "smtp-cps",
+		Usage: "maximum number of SMTP connections per second, defaults to the config file, 0 disables",
+		Value: 0,
+	},
+	cli.StringFlag{
+		Name:  "baseline",
+		Usage: "JSON report of an earlier run, only report the findings new, resolved or changed since",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "suppressions",
+		Usage: "file with suppressions of accepted risks, in addition to those of the config file",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "history",
+		Usage: "directory of the history store keeping every scan, defaults to the config file",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "fail-on",
+		Usage: "exit with status 1 when findings of this severity (error or warning) or worse are reported",
+		Value: "",
+	},
+	cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "time budget for the complete run, 0 disables",
+		Value: 0,
+	},
+	cli.DurationFlag{
+		Name:  "domain-timeout",
+		Usage: "time budget for all checks of a single domain, 0 disables",
+		Value: 0,
+	},
+	cli.StringSliceFlag{
+		Name:  "plugin-timeout",
+		Usage: "time budget for a single check, as duration or plugin=duration",
+		Value: &cli.StringSlice{},
+	},
 }
 
 type Cmd struct {
@@ -73,58 +187,156 @@ func New() *Cmd {
 			Name:   "version",
 			Action: VersionAction,
 		},
+		{
+			Name:      "diff",
+			Usage:     "compare two JSON reports, written with --output json",
+			ArgsUsage: "old.json new.json",
+			Action:    DiffAction,
+		},
+		{
+			Name:      "scan",
+			Usage:     "scan large lists of domains, streaming the results to --results and resuming where an interrupted scan left off",
+			ArgsUsage: "[domain...]",
+			Flags:     scanFlags,
+			Action:    ScanAction,
+		},
+		{
+			Name:   "serve",
+			Usage:  "serve the checks over a JSON API, on --port",
+			Flags:  serveFlags,
+			Action: ServeAction,
+		},
+		{
+			Name:      "exporter",
+			Usage:     "rescan domains on an interval and serve Prometheus metrics at /metrics on --port",
+			ArgsUsage: "[domain...]",
+			Flags:     exporterFlags,
+			Action:    ExporterAction,
+		},
+		{
+			Name:      "watch",
+			Usage:     "rescan domains on an interval and alert a webhook when their findings change",
+			ArgsUsage: "[domain...]",
+			Flags:     watchFlags,
+			Action:    WatchAction,
+		},
+		{
+			Name:      "history",
+			Usage:     "show the timeline of domains, or of a finding, from the history store",
+			ArgsUsage: "[domain...]",
+			Flags:     historyFlags,
+			Action:    HistoryAction,
+		},
+		{
+			Name:   "checks",
+			Usage:  "list the available checks",
+			Action: ChecksAction,
+		},
 	}
 
 	app.Before = func(c *cli.Context) error {
 		return nil
 	}
 
-	app.Action = func(c *cli.Context) {
-		fmt.Println("Check Email")
-		fmt.Println("Verify configuration of domain and email settings.")
-		fmt.Println("by DutchSec")
-		fmt.Println("----------------")
+	app.Action = func(c *cli.Context) error {
+		e, err := newEngine(c)
+		if err != nil {
+			return cli.NewExitError(err.Error(), ExitFailed)
+		}
+
+		defer e.Close()
+
+		format := e.conf.Output.Format
+		if c.IsSet("output") {
+			format = c.String("output")
+		}
+
+		options, err := outputOptions(c)
+		if err != nil {
+			return cli.NewExitError(err.Error(), ExitFailed)
+		}
+
+		var baseline *report.Report
+		if path := c.String("baseline"); path != "" {
+			if baseline, err = report.Load(path); err != nil {
+				return cli.NewExitError(err.Error(), ExitFailed)
+			}
+		}
+
+		var renderer output.Renderer
+		if baseline != nil {
+			renderer, err = output.NewDiff(format, os.Stdout, baseline)
+		} else {
+			renderer, err = output.New(format, os.Stdout, options...)
+		}
+
+		if err != nil {
+			return cli.NewExitError(err.Error(), ExitFailed)
+		}
 
-		for _, p := range plugins.Plugins {
-			plugin := p()
+		failOn, err := failOnSeverity(c.String("fail-on"))
+		if err != nil {
+			return cli.NewExitError(err.Error(), ExitFailed)
+		}
 
-			fmt.Printf("---- %s %s\n", plugin.Name(), strings.Repeat("-", 80-len(plugin.Name())))
+		ctx := context.Background()
+
+		if timeout := c.Duration("timeout"); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
 
-			wg := sync.WaitGroup{}
+		targets, err := readTargets(c)
+		if err != nil {
+			return cli.NewExitError(err.Error(), ExitFailed)
+		}
 
-			for _, domain := range c.Args()[0:] {
-				// only thing, what to do with caching dns client
+		selected, err := e.Plugins(nil)
+		if err != nil {
+			return cli.NewExitError(err.Error(), ExitFailed)
+		}
 
-				wg.Add(1)
-				go func() {
+		rep := e.StartTargets(targets, selected)
 
-					defer wg.Done()
+		if err := renderer.Start(rep); err != nil {
+			return cli.NewExitError(err.Error(), ExitFailed)
+		}
 
-					issues := plugin.Check(domain)
+		p := newProgress()
 
-					for issue := range issues {
-						if issue.Severity == plugins.SeverityError {
-							fmt.Printf("[%s] [%s] %s \n", color.RedString("!!"), domain, issue.Message)
-						} else if issue.Severity == plugins.SeverityDebug {
-							// fmt.Printf("[%s] [%s] %s \n", "- ", domain, issue.Message)
-						} else if issue.Severity == plugins.SeverityWarning {
-							fmt.Printf("[%s] [%s] %s \n", color.RedString("! "), domain, issue.Message)
-						} else if issue.Severity == plugins.SeverityOK {
-							fmt.Printf("[%s] [%s] %s \n", color.GreenString("OK"), domain, issue.Message)
-						} else if issue.Severity == plugins.SeverityInfo {
-							fmt.Printf("[%s] [%s] %s \n", "  ", domain, issue.Message)
-						}
-					}
-				}()
+		e.Run(ctx, rep, selected, output.Ordered(renderer), p.Update, func(domain string, plugin plugins.Plugin, check *report.Check) {
+			p.Clear()
 
+			for _, issue := range check.Issues {
+				if err := renderer.Issue(domain, plugin, issue); err != nil {
+					log.Errorf("Error rendering issue: %s", err.Error())
+				}
 			}
+		})
+
+		p.Clear()
+
+		if err := renderer.Finish(rep); err != nil {
+			return cli.NewExitError(err.Error(), ExitFailed)
+		}
 
-			wg.Wait()
+		if rep.Failed() {
+			return cli.NewExitError("Scan failed, checks could not be completed", ExitFailed)
+		}
 
-			fmt.Println("")
+		if failOn == "" {
+			return nil
 		}
 
-		fmt.Println("--------")
+		// compared to a baseline, only new and changed findings count
+		if baseline != nil && diffHas(diff.Compare(baseline, rep), failOn) {
+			return cli.NewExitError("", ExitFindings)
+		} else if baseline == nil && rep.Has(failOn) {
+			return cli.NewExitError("", ExitFindings)
+		}
+
+		return nil
 	}
 
 	return &Cmd{
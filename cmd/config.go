@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/minio/cli"
+
+	"github.com/dutchcoders/checkmail/config"
+	"github.com/dutchcoders/checkmail/plugins"
+)
+
+// loadConfig reads the configuration file. The default configuration file is
+// optional, an explicitly passed one is not.
+func loadConfig(c *cli.Context) (*config.Config, error) {
+	path := c.GlobalString("config")
+
+	conf, err := config.Load(path)
+	if os.IsNotExist(err) && !c.GlobalIsSet("config") {
+		return config.Default(), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+// pluginOptions translates the configuration of a plugin to plugin options.
+func pluginOptions(pc config.Plugin) []plugins.OptionFn {
+	options := []plugins.OptionFn{}
+
+	if len(pc.Selectors) > 0 {
+		options = append(options, plugins.Selectors(pc.Selectors...))
+	}
+
+	if len(pc.Ports) > 0 {
+		options = append(options, plugins.Ports(pc.Ports...))
+	}
+
+	if pc.EHLO != "" {
+		options = append(options, plugins.EHLO(pc.EHLO))
+	}
+
+	if pc.SMTPTimeout > 0 {
+		options = append(options, plugins.SMTPTimeout(pc.SMTPTimeout))
+	}
+
+	return options
+}
+
+// resolverOptions translates the resolver configuration to resolver options.
+func resolverOptions(rc config.Resolver) []plugins.OptionFn {
+	options := []plugins.OptionFn{}
+
+	if rc.Concurrency > 0 {
+		options = append(options, plugins.Concurrency(rc.Concurrency))
+	}
+
+	if rc.BufSize > 0 {
+		options = append(options, plugins.BufSize(uint16(rc.BufSize)))
+	}
+
+	if rc.Retries > 0 || rc.Backoff > 0 {
+		policy := plugins.DefaultRetryPolicy
+		if rc.Retries > 0 {
+			policy.Attempts = rc.Retries + 1
+		}
+
+		if rc.Backoff > 0 {
+			policy.Backoff = rc.Backoff
+		}
+
+		options = append(options, plugins.Retry(policy))
+	}
+
+	return options
+}
+
+// newResolver returns the resolver configured by the flags or the
+// configuration file, defaulting to the system resolver.
+func newResolver(c *cli.Context, conf *config.Config) (plugins.Resolver, error) {
+	options := resolverOptions(conf.Resolver)
+
+	qps := conf.Limits.DNSQueries
+	if c.GlobalIsSet("dns-qps") {
+		qps = c.GlobalFloat64("dns-qps")
+	}
+
+	options = append(options, plugins.QueryRate(qps))
+
+	if c.GlobalBool("iterative") || conf.Resolver.Iterative {
+		rootHints := conf.Resolver.RootHints
+		if c.GlobalIsSet("root-hints") {
+			rootHints = splitValues(c.GlobalStringSlice("root-hints"))
+		}
+
+		return plugins.IterativeResolver(rootHints, options...), nil
+	}
+
+	specs := conf.Resolver.Servers
+	if c.GlobalIsSet("resolver") {
+		specs = splitValues(c.GlobalStringSlice("resolver"))
+	}
+
+	if len(specs) == 0 {
+		return plugins.SystemResolver(options...)
+	}
+
+	return plugins.NewResolver(specs, options...)
+}
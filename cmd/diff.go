@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/minio/cli"
+
+	"github.com/dutchcoders/checkmail/diff"
+	"github.com/dutchcoders/checkmail/output"
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// DiffAction compares two JSON reports, written with --output json.
+func DiffAction(c *cli.Context) error {
+	if len(c.Args()) != 2 {
+		return cli.NewExitError("Usage: checkmail diff old.json new.json", ExitFailed)
+	}
+
+	old, err := report.Load(c.Args()[0])
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	current, err := report.Load(c.Args()[1])
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	format := "text"
+	if c.GlobalIsSet("output") {
+		format = c.GlobalString("output")
+	}
+
+	d := diff.Compare(old, current)
+
+	if err := output.WriteDiff(format, os.Stdout, d); err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	if failOn, err := failOnSeverity(c.GlobalString("fail-on")); err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	} else if failOn != "" && diffHas(d, failOn) {
+		return cli.NewExitError("", ExitFindings)
+	}
+
+	return nil
+}
+
+// diffHas returns whether a new or changed finding is as severe as severity,
+// or more.
+func diffHas(d *diff.Diff, severity plugins.Severity) bool {
+	for _, dd := range d.Domains {
+		for _, changes := range [][]diff.Change{dd.New, dd.Changed} {
+			for _, c := range changes {
+				if c.After.Severity.AtLeast(severity) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
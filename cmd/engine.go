@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/minio/cli"
+
+	"github.com/dutchcoders/checkmail/config"
+	"github.com/dutchcoders/checkmail/history"
+	"github.com/dutchcoders/checkmail/input"
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+	"github.com/dutchcoders/checkmail/scanner"
+	"github.com/dutchcoders/checkmail/suppress"
+)
+
+// engine runs the checks as configured by the config file and global flags,
+// for a single run as well as the long running commands.
+type engine struct {
+	conf     *config.Config
+	resolver plugins.Resolver
+
+	scanner      *scanner.Scanner
+	suppressions *suppress.Suppressions
+	weights      report.Weights
+
+	// history keeps every scan, if configured.
+	history *history.Store
+
+	// Close closes the recording of the resolver, if any.
+	Close func() error
+}
+
+// newEngine sets up the plugins, resolver, time budgets, suppressions and
+// score weights.
+func newEngine(c *cli.Context) (*engine, error) {
+	conf, err := loadConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	timeouts, err := parsePluginTimeouts(c.GlobalStringSlice("plugin-timeout"))
+	if err != nil {
+		return nil, err
+	}
+
+	for key, pc := range conf.Plugins {
+		if _, ok := timeouts.Plugins[key]; !ok && pc.Timeout > 0 {
+			timeouts.Plugins[key] = pc.Timeout
+		}
+	}
+
+	suppressions := conf.Suppressions
+	if path := c.GlobalString("suppressions"); path != "" {
+		entries, err := config.LoadSuppressions(path)
+		if err != nil {
+			return nil, err
+		}
+
+		suppressions = append(suppressions, entries...)
+	}
+
+	weights, err := scoreWeights(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := selectPlugins(c, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := openHistory(c, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	res, closeRecording, err := setupResolver(c, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &engine{
+		conf: conf,
+		scanner: &scanner.Scanner{
+			Plugins:       selected,
+			Workers:       c.GlobalInt("workers"),
+			Timeout:       timeouts.For,
+			DomainTimeout: c.GlobalDuration("domain-timeout"),
+		},
+		resolver:     res,
+		suppressions: suppress.New(suppressions),
+		weights:      weights,
+		history:      store,
+		Close:        closeRecording,
+	}, nil
+}
+
+// Observe calls fn with the outcome of every lookup of the plugins.
+func (e *engine) Observe(fn plugins.ObserveFunc) {
+	plugins.SetResolver(plugins.ObserveResolver(e.resolver, fn))
+}
+
+// Plugins returns the selected plugins, only those matching selectors if
+// any.
+func (e *engine) Plugins(selectors []string) ([]plugins.Plugin, error) {
+	if len(selectors) == 0 {
+		return e.scanner.Plugins, nil
+	}
+
+	if err := plugins.ValidateSelectors(selectors); err != nil {
+		return nil, err
+	}
+
+	selected := []plugins.Plugin{}
+	for _, p := range e.scanner.Plugins {
+		if plugins.Matches(p, selectors) {
+			selected = append(selected, p)
+		}
+	}
+
+	return selected, nil
+}
+
+// Start returns the report of a run of selected checking domains.
+func (e *engine) Start(domains []string, selected []plugins.Plugin) *report.Report {
+	return report.New(Version, domains, selected)
+}
+
+// StartTargets returns the report of a run of selected checking targets,
+// keeping the fields read with every domain.
+func (e *engine) StartTargets(targets []input.Target, selected []plugins.Plugin) *report.Report {
+	domains := []string{}
+	for _, t := range targets {
+		domains = append(domains, t.Domain)
+	}
+
+	rep := e.Start(domains, selected)
+	for i, d := range rep.Domains {
+		d.Fields = targets[i].Fields
+	}
+
+	return rep
+}
+
+// Run runs the checks of rep, calling fn with every check finished, with
+// suppressions applied. Checks are passed as they finish or, when ordered,
+// in domain then plugin order. The report is finished and scored when Run
+// returns.
+func (e *engine) Run(ctx context.Context, rep *report.Report, selected []plugins.Plugin, ordered bool, progress func(done, running, total int), fn func(domain string, p plugins.Plugin, c *report.Check)) {
+	s := *e.scanner
+	s.Plugins = selected
+	s.Ordered = ordered
+	s.Progress = progress
+
+	s.Scan(ctx, rep, func(domain string, p plugins.Plugin, c *report.Check) {
+		e.suppressions.Apply(domain, c)
+
+		if fn != nil {
+			fn(domain, p, c)
+		}
+	})
+
+	rep.Finish()
+	rep.Score(e.weights)
+
+	if e.history == nil {
+		return
+	}
+
+	for _, d := range rep.Domains {
+		if err := e.history.Add(rep.Version, d); err != nil {
+			log.Errorf("Error storing scan of %s: %s", d.Domain, err.Error())
+		}
+	}
+}
+
+// Scan runs the checks of domains, only those matching selectors if any,
+// and returns the finished report.
+func (e *engine) Scan(ctx context.Context, domains []string, selectors []string) (*report.Report, error) {
+	selected, err := e.Plugins(selectors)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := e.Start(domains, selected)
+	e.Run(ctx, rep, selected, false, nil, nil)
+	return rep, nil
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/dutchcoders/checkmail/plugins"
+)
+
+// Exit codes of a run.
+const (
+	// ExitFindings is returned when findings as severe as --fail-on, or
+	// more, were reported.
+	ExitFindings = 1
+
+	// ExitFailed is returned when the scan itself failed: it could not be
+	// started, the resolver failed or every check failed.
+	ExitFailed = 2
+)
+
+// failOnSeverity parses the --fail-on value, an empty value disables.
+func failOnSeverity(value string) (plugins.Severity, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	severity, err := plugins.ParseSeverity(value)
+	if err != nil {
+		return "", err
+	}
+
+	if severity != plugins.SeverityError && severity != plugins.SeverityWarning {
+		return "", fmt.Errorf("Unsupported --fail-on severity: %s", value)
+	}
+
+	return severity, nil
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/minio/cli"
+
+	"github.com/dutchcoders/checkmail/exporter"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+var exporterFlags = []cli.Flag{
+	cli.DurationFlag{
+		Name:  "interval",
+		Usage: "interval between scans of the domains, defaults to the config file or 1h",
+		Value: 0,
+	},
+}
+
+// ExporterAction rescans the domains given as arguments or --input, or
+// configured in the [exporter] section, every interval and serves their
+// metrics at /metrics on --port.
+func ExporterAction(c *cli.Context) error {
+	e, err := newEngine(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	defer e.Close()
+
+	domains, err := readDomains(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	if len(domains) == 0 {
+		domains = e.conf.Exporter.Domains
+	}
+
+	if len(domains) == 0 {
+		return cli.NewExitError("No domains to export, pass them as arguments or with --input, or configure them in the [exporter] section", ExitFailed)
+	}
+
+	x := exporter.New(func(ctx context.Context, domains []string) (*report.Report, error) {
+		return e.Scan(ctx, domains, nil)
+	}, domains)
+
+	x.Timeout = c.GlobalDuration("timeout")
+
+	if e.conf.Exporter.Interval > 0 {
+		x.Interval = e.conf.Exporter.Interval
+	}
+
+	if interval := c.Duration("interval"); interval > 0 {
+		x.Interval = interval
+	}
+
+	e.Observe(x.Observe)
+
+	go x.Run(context.Background())
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", x.Handler())
+
+	addr := c.GlobalString("port")
+
+	log.Infof("Serving metrics on %s/metrics", addr)
+
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/minio/cli"
+
+	"github.com/dutchcoders/checkmail/config"
+	"github.com/dutchcoders/checkmail/history"
+	"github.com/dutchcoders/checkmail/output"
+)
+
+var historyFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "finding",
+		Usage: "show when this finding was reported, by finding ID",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "since",
+		Usage: "only scans since, as age like 90d or 12h, or as date like 2026-01-31",
+		Value: "",
+	},
+}
+
+// openHistory opens the history store of --history or the config file, nil
+// if none is configured. Scans beyond the retention are removed right away.
+func openHistory(c *cli.Context, conf *config.Config) (*history.Store, error) {
+	path := conf.History.Path
+	if c.GlobalIsSet("history") {
+		path = c.GlobalString("history")
+	}
+
+	if path == "" {
+		return nil, nil
+	}
+
+	store, err := history.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	store.Retention = conf.History.Retention
+	store.MaxScans = conf.History.MaxScans
+
+	if err := store.Prune(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// parseSince parses an age like 90d, or a date.
+func parseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+
+	age, err := config.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid since: %s", value)
+	}
+
+	return time.Now().Add(-age), nil
+}
+
+// HistoryAction shows the timeline of the domains given as arguments, or of
+// all domains in the store, or the periods a finding was reported in.
+func HistoryAction(c *cli.Context) error {
+	conf, err := loadConfig(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	store, err := openHistory(c, conf)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	} else if store == nil {
+		return cli.NewExitError("No history store, pass --history or configure the [history] section", ExitFailed)
+	}
+
+	since, err := parseSince(c.String("since"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	format := "text"
+	if c.GlobalIsSet("output") {
+		format = c.GlobalString("output")
+	}
+
+	domains := []string(c.Args())
+	if len(domains) == 0 {
+		if domains, err = store.Domains(); err != nil {
+			return cli.NewExitError(err.Error(), ExitFailed)
+		}
+	}
+
+	finding := c.String("finding")
+
+	timelines := []output.Timeline{}
+	periods := []history.Period{}
+
+	for _, domain := range domains {
+		scans, err := store.Scans(domain, since)
+		if err != nil {
+			return cli.NewExitError(err.Error(), ExitFailed)
+		}
+
+		if finding != "" {
+			periods = append(periods, history.Occurrences(finding, scans)...)
+			continue
+		}
+
+		timelines = append(timelines, output.Timeline{
+			Domain:  domain,
+			Entries: history.Timeline(scans),
+		})
+	}
+
+	if finding != "" {
+		err = output.WriteOccurrences(format, os.Stdout, finding, periods)
+	} else {
+		err = output.WriteTimelines(format, os.Stdout, timelines)
+	}
+
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/minio/cli"
+
+	"github.com/dutchcoders/checkmail/input"
+)
+
+// readTargets returns the domains given as arguments followed by those read
+// from --input, normalized and without duplicates.
+func readTargets(c *cli.Context) ([]input.Target, error) {
+	targets := []input.Target{}
+
+	for _, arg := range c.Args() {
+		domain := input.Normalize(arg)
+		if !input.Valid(domain) {
+			return nil, fmt.Errorf("Invalid domain: %s", arg)
+		}
+
+		targets = append(targets, input.Target{Domain: domain})
+	}
+
+	if path := c.GlobalString("input"); path != "" {
+		var r io.Reader = os.Stdin
+
+		if path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+
+			defer f.Close()
+			r = f
+		}
+
+		read, err := input.Read(r, c.GlobalString("input-format"), c.GlobalString("domain-column"))
+		if err != nil {
+			return nil, fmt.Errorf("Error reading %s: %s", path, err.Error())
+		}
+
+		targets = append(targets, read...)
+	}
+
+	return input.Dedupe(targets), nil
+}
+
+// readDomains returns the domains of readTargets.
+func readDomains(c *cli.Context) ([]string, error) {
+	targets, err := readTargets(c)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := []string{}
+	for _, t := range targets {
+		domains = append(domains, t.Domain)
+	}
+
+	return domains, nil
+}
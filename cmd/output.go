@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/minio/cli"
+
+	"github.com/dutchcoders/checkmail/config"
+	"github.com/dutchcoders/checkmail/output"
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+	"github.com/dutchcoders/checkmail/zone"
+)
+
+// outputOptions returns the renderer options set by the flags.
+func outputOptions(c *cli.Context) ([]output.OptionFn, error) {
+	options := []output.OptionFn{}
+
+	if files := c.StringSlice("zone"); len(files) > 0 {
+		idx := zone.NewIndex()
+
+		for _, value := range splitValues(files) {
+			origin, path := "", value
+			if parts := strings.SplitN(value, "=", 2); len(parts) == 2 {
+				origin, path = parts[0], parts[1]
+			}
+
+			if err := idx.Load(path, origin); err != nil {
+				return nil, err
+			}
+		}
+
+		options = append(options, output.Zones(idx))
+	}
+
+	return options, nil
+}
+
+// scoreWeights returns the default score weights with the configured weights
+// applied.
+func scoreWeights(conf *config.Config) (report.Weights, error) {
+	w := report.Weights{
+		Categories: map[plugins.Category]float64{},
+		Checks:     conf.Scoring.Checks,
+	}
+
+	for name, weight := range conf.Scoring.Categories {
+		known := false
+		for _, category := range plugins.Categories {
+			known = known || string(category) == name
+		}
+
+		if !known {
+			return w, fmt.Errorf("Unknown category: %s", name)
+		}
+
+		w.Categories[plugins.Category(name)] = weight
+	}
+
+	return report.DefaultWeights.Merge(w), nil
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mattn/go-isatty"
+)
+
+// progress shows the number of finished checks on a single line of stderr,
+// when stderr is a terminal.
+type progress struct {
+	w       io.Writer
+	enabled bool
+
+	line string
+}
+
+func newProgress() *progress {
+	return &progress{
+		w:       os.Stderr,
+		enabled: isatty.IsTerminal(os.Stderr.Fd()),
+	}
+}
+
+// Update redraws the progress line.
+func (p *progress) Update(done, running, total int) {
+	if !p.enabled {
+		return
+	}
+
+	p.line = fmt.Sprintf("[%d/%d] checks done, %d running", done, total, running)
+	fmt.Fprintf(p.w, "\r\033[K%s", p.line)
+}
+
+// Clear removes the progress line, so other output can be written.
+func (p *progress) Clear() {
+	if !p.enabled || p.line == "" {
+		return
+	}
+
+	fmt.Fprint(p.w, "\r\033[K")
+	p.line = ""
+}
+
+// Domains redraws the progress line with the number of completed domains.
+func (p *progress) Domains(done, total int) {
+	if !p.enabled {
+		return
+	}
+
+	p.line = fmt.Sprintf("[%d/%d] domains done", done, total)
+	fmt.Fprintf(p.w, "\r\033[K%s", p.line)
+}
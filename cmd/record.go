@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/dutchcoders/checkmail/config"
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/minio/cli"
+)
+
+// setupResolver sets the resolver and grabber used by the plugins. With
+// --replay both answer from a recorded fixture bundle, with --record every
+// exchange is written to one. Unless replaying, the SMTP connection rate is
+// limited as configured. It returns the resolver set, and a func closing the
+// recording.
+func setupResolver(c *cli.Context, conf *config.Config) (plugins.Resolver, func() error, error) {
+	if c.GlobalString("record") != "" && c.GlobalString("replay") != "" {
+		return nil, nil, errors.New("Can't record and replay at the same time")
+	}
+
+	if dir := c.GlobalString("replay"); dir != "" {
+		rp, err := plugins.NewReplayer(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		res := rp.Resolver()
+
+		plugins.SetResolver(res)
+		plugins.SetGrabber(rp.Grabber())
+		return res, func() error { return nil }, nil
+	}
+
+	res, err := newResolver(c, conf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cps := conf.Limits.SMTPConnections
+	if c.GlobalIsSet("smtp-cps") {
+		cps = c.GlobalFloat64("smtp-cps")
+	}
+
+	gr := plugins.DefaultGrabber
+	if cps > 0 {
+		gr = plugins.LimitGrabber(gr, cps)
+	}
+
+	dir := c.GlobalString("record")
+	if dir == "" {
+		plugins.SetResolver(res)
+		plugins.SetGrabber(gr)
+		return res, func() error { return nil }, nil
+	}
+
+	rec, err := plugins.NewRecorder(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res = rec.Resolver(res)
+
+	plugins.SetResolver(res)
+	plugins.SetGrabber(rec.Grabber(gr))
+	return res, rec.Close, nil
+}
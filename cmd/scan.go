@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/minio/cli"
+
+	"github.com/dutchcoders/checkmail/batch"
+	"github.com/dutchcoders/checkmail/input"
+	"github.com/dutchcoders/checkmail/output"
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+var scanFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "results",
+		Usage: "file the result of every domain is appended to as it completes, as a JSON object per line",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "checkpoint",
+		Usage: "file recording the completed domains, defaults to the results file with .checkpoint appended",
+		Value: "",
+	},
+	cli.IntFlag{
+		Name:  "batch",
+		Usage: "number of domains scanned at a time, bounding the memory used",
+		Value: batch.DefaultSize,
+	},
+	cli.IntFlag{
+		Name:  "attempts",
+		Usage: "number of scans of a domain with checks that could not be completed, before giving up on it",
+		Value: batch.DefaultAttempts,
+	},
+	cli.DurationFlag{
+		Name:  "retry-delay",
+		Usage: "delay before scanning a domain again after a failed attempt, doubling with every attempt",
+		Value: batch.DefaultRetryDelay,
+	},
+}
+
+// ScanAction scans the domains given as arguments or --input, appending the
+// result of every domain to --results as soon as it completes. Completed
+// domains are recorded in the checkpoint and skipped when the scan is run
+// again, so an interrupted scan resumes where it left off. Domains with
+// checks that could not be completed, like on a timeout, are scanned again
+// after --retry-delay, up to --attempts times. A summary of all results is
+// written at the end.
+func ScanAction(c *cli.Context) error {
+	path := c.String("results")
+	if path == "" {
+		return cli.NewExitError("No results file, pass --results", ExitFailed)
+	}
+
+	checkpoint := c.String("checkpoint")
+	if checkpoint == "" {
+		checkpoint = path + ".checkpoint"
+	}
+
+	format := "text"
+	if c.GlobalIsSet("output") {
+		format = c.GlobalString("output")
+	}
+
+	if format != "text" && format != "json" {
+		return cli.NewExitError("Unsupported output format for summary: "+format, ExitFailed)
+	}
+
+	failOn, err := failOnSeverity(c.GlobalString("fail-on"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	e, err := newEngine(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	defer e.Close()
+
+	targets, err := readTargets(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	if len(targets) == 0 {
+		return cli.NewExitError("No domains to scan, pass them as arguments or with --input", ExitFailed)
+	}
+
+	selected, err := e.Plugins(nil)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	} else if len(selected) == 0 {
+		return cli.NewExitError("No checks selected", ExitFailed)
+	}
+
+	cp, err := batch.OpenCheckpoint(checkpoint)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	defer cp.Close()
+
+	results, err := batch.OpenResults(path)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	defer results.Close()
+
+	pending := []input.Target{}
+	for _, t := range targets {
+		if !cp.Done(t.Domain) {
+			pending = append(pending, t)
+		}
+	}
+
+	if completed := len(targets) - len(pending); completed > 0 {
+		log.Infof("Resuming scan, %d of %d domains completed before", completed, len(targets))
+	}
+
+	ctx := context.Background()
+
+	if timeout := c.GlobalDuration("timeout"); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	size := c.Int("batch")
+	if size <= 0 {
+		size = batch.DefaultSize
+	}
+
+	attempts := c.Int("attempts")
+	if attempts <= 0 {
+		attempts = batch.DefaultAttempts
+	}
+
+	p := newProgress()
+	done := len(targets) - len(pending)
+
+	q := batch.NewQueue(pending, c.Duration("retry-delay"))
+
+	var writeErr error
+
+	for q.Len() > 0 && ctx.Err() == nil && writeErr == nil {
+		next, err := q.Next(ctx, size)
+		if err != nil {
+			break
+		}
+
+		rep := e.StartTargets(next, selected)
+
+		// checks left per domain, a domain completes with its last check
+		left := map[string]int{}
+		domains := map[string]*report.Domain{}
+		queued := map[string]input.Target{}
+
+		for _, d := range rep.Domains {
+			left[d.Domain] = len(d.Checks)
+			domains[d.Domain] = d
+		}
+
+		for _, t := range next {
+			queued[t.Domain] = t
+		}
+
+		e.Run(ctx, rep, selected, false, nil, func(domain string, plugin plugins.Plugin, check *report.Check) {
+			if left[domain]--; left[domain] > 0 {
+				return
+			}
+
+			// checks cut short by the time budget of the run are
+			// neither written nor recorded, they run again on resume
+			if ctx.Err() != nil || writeErr != nil {
+				return
+			}
+
+			n, err := complete(e, cp, results, domains[domain], attempts)
+			if err != nil {
+				writeErr = err
+				return
+			} else if n > 0 {
+				q.Retry(queued[domain], n)
+				return
+			}
+
+			done++
+			p.Domains(done, len(targets))
+		})
+	}
+
+	p.Clear()
+
+	if writeErr != nil {
+		return cli.NewExitError(writeErr.Error(), ExitFailed)
+	}
+
+	summary, err := batch.Summarize(path)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	if err := output.WriteSummary(format, os.Stdout, summary); err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	if ctx.Err() != nil {
+		return cli.NewExitError("Scan timed out, run it again to resume", ExitFailed)
+	}
+
+	if failOn == "" {
+		return nil
+	}
+
+	for severity, count := range summary.Findings {
+		if count > 0 && severity.AtLeast(failOn) {
+			return cli.NewExitError("", ExitFindings)
+		}
+	}
+
+	return nil
+}
+
+// complete finishes and scores d, and appends it to the results. It is
+// recorded in the checkpoint, unless a check could not be completed and d was
+// attempted less than attempts times, then the number of failed attempts is
+// returned to scan it again.
+func complete(e *engine, cp *batch.Checkpoint, results *batch.Results, d *report.Domain, attempts int) (int, error) {
+	d.Finish()
+	d.Score = e.weights.Score(d)
+
+	if err := results.Write(d); err != nil {
+		return 0, err
+	}
+
+	retry := []string{}
+	for _, c := range d.Checks {
+		if c.Failed() {
+			retry = append(retry, c.Plugin)
+		}
+	}
+
+	if len(retry) == 0 {
+		return 0, cp.Add(d.Domain)
+	}
+
+	n, err := cp.Fail(d.Domain)
+	if err != nil {
+		return 0, err
+	}
+
+	if n >= attempts {
+		log.Warningf("Checks %s of %s failed %d times, giving up on the domain", strings.Join(retry, ", "), d.Domain, n)
+		return 0, cp.Add(d.Domain)
+	}
+
+	log.Warningf("Checks %s of %s failed, scanning the domain again", strings.Join(retry, ", "), d.Domain)
+	return n, nil
+}
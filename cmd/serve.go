@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"github.com/minio/cli"
+
+	"github.com/dutchcoders/checkmail/server"
+)
+
+var serveFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:  "jobs",
+		Usage: "number of scans running concurrently, others are queued",
+		Value: server.DefaultJobs,
+	},
+	cli.IntFlag{
+		Name:  "max-domains",
+		Usage: "maximum number of domains of a single scan",
+		Value: server.DefaultMaxDomains,
+	},
+	cli.IntFlag{
+		Name:  "max-queued",
+		Usage: "maximum number of queued scans, others are refused",
+		Value: server.DefaultMaxQueued,
+	},
+	cli.DurationFlag{
+		Name:  "retention",
+		Usage: "how long finished scans are kept",
+		Value: server.DefaultRetention,
+	},
+}
+
+// ServeAction serves the JSON API on --port, and the static files of
+// --path.
+func ServeAction(c *cli.Context) error {
+	e, err := newEngine(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	defer e.Close()
+
+	s := server.New(e.Scan)
+	s.Path = c.GlobalString("path")
+	s.Jobs = c.Int("jobs")
+	s.MaxDomains = c.Int("max-domains")
+	s.MaxQueued = c.Int("max-queued")
+	s.Retention = c.Duration("retention")
+	s.Timeout = c.GlobalDuration("timeout")
+
+	addr := c.GlobalString("port")
+
+	log.Infof("Listening on %s", addr)
+
+	if err := s.ListenAndServe(addr); err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	return nil
+}
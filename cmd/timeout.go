@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dutchcoders/checkmail/plugins"
+)
+
+// pluginTimeouts holds the time budget of a single check, with optional
+// overrides per plugin (keyed by plugin key).
+type pluginTimeouts struct {
+	Default time.Duration
+
+	Plugins map[string]time.Duration
+}
+
+func (pt pluginTimeouts) For(p plugins.Plugin) time.Duration {
+	if timeout, ok := pt.Plugins[plugins.Key(p.Name())]; ok {
+		return timeout
+	}
+
+	return pt.Default
+}
+
+// parsePluginTimeouts parses values like "30s" or "Banner grabbing=2m". The
+// plugin has to be registered, and the timeout positive.
+func parsePluginTimeouts(values []string) (pluginTimeouts, error) {
+	pt := pluginTimeouts{
+		Plugins: map[string]time.Duration{},
+	}
+
+	known := map[string]bool{}
+	for _, fn := range plugins.Plugins {
+		known[plugins.Key(fn().Name())] = true
+	}
+
+	for _, value := range values {
+		name, duration := "", value
+		if i := strings.LastIndex(value, "="); i != -1 {
+			name, duration = strings.TrimSpace(value[:i]), value[i+1:]
+		}
+
+		timeout, err := time.ParseDuration(strings.TrimSpace(duration))
+		if err != nil {
+			return pt, fmt.Errorf("Invalid plugin timeout %q: %s", value, err.Error())
+		} else if timeout <= 0 {
+			return pt, fmt.Errorf("Invalid plugin timeout %q: must be positive", value)
+		}
+
+		if name == "" {
+			pt.Default = timeout
+		} else if !known[plugins.Key(name)] {
+			return pt, fmt.Errorf("Invalid plugin timeout %q: unknown plugin: %s", value, name)
+		} else {
+			pt.Plugins[plugins.Key(name)] = timeout
+		}
+	}
+
+	return pt, nil
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/minio/cli"
+
+	"github.com/dutchcoders/checkmail/report"
+	"github.com/dutchcoders/checkmail/watch"
+)
+
+var watchFlags = []cli.Flag{
+	cli.DurationFlag{
+		Name:  "interval",
+		Usage: "interval between scans of the domains, defaults to the config file or 1h",
+		Value: 0,
+	},
+	cli.StringFlag{
+		Name:  "webhook",
+		Usage: "URL the alerts are posted to as JSON",
+		Value: "",
+	},
+	cli.StringFlag{
+		Name:  "state",
+		Usage: "directory keeping the last scan of every domain, to detect changes across restarts",
+		Value: "",
+	},
+}
+
+// WatchAction rescans the domains given as arguments or --input, or
+// configured in the [watch] section, every interval and alerts when their
+// findings change.
+func WatchAction(c *cli.Context) error {
+	e, err := newEngine(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	defer e.Close()
+
+	conf := e.conf.Watch
+
+	domains, err := readDomains(c)
+	if err != nil {
+		return cli.NewExitError(err.Error(), ExitFailed)
+	}
+
+	if len(domains) == 0 {
+		domains = conf.Domains
+	}
+
+	if len(domains) == 0 {
+		return cli.NewExitError("No domains to watch, pass them as arguments or with --input, or configure them in the [watch] section", ExitFailed)
+	}
+
+	w := watch.New(func(ctx context.Context, domains []string) (*report.Report, error) {
+		return e.Scan(ctx, domains, nil)
+	}, domains)
+
+	w.Timeout = c.GlobalDuration("timeout")
+	w.Webhook = conf.Webhook
+	w.State = conf.State
+
+	if conf.Interval > 0 {
+		w.Interval = conf.Interval
+	}
+
+	if interval := c.Duration("interval"); interval > 0 {
+		w.Interval = interval
+	}
+
+	if webhook := c.String("webhook"); webhook != "" {
+		w.Webhook = webhook
+	}
+
+	if state := c.String("state"); state != "" {
+		w.State = state
+	}
+
+	log.Infof("Watching %d domains every %s", len(domains), w.Interval)
+
+	w.Run(context.Background())
+	return nil
+}
@@ -0,0 +1,547 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/dutchcoders/checkmail/plugins"
+)
+
+// Config is the configuration of checkmail, as read from config.toml.
+type Config struct {
+	Resolver Resolver
+	Output   Output
+	Scoring  Scoring
+	Exporter Exporter
+	Watch    Watch
+	History  History
+	Limits   Limits
+
+	// Suppressions are the accepted risks.
+	Suppressions []Suppression
+
+	// Plugins holds the configuration per plugin, keyed by plugin key.
+	Plugins map[string]Plugin
+}
+
+type Resolver struct {
+	// Servers to use instead of the ones from /etc/resolv.conf, as host or
+	// host:port.
+	Servers []string
+
+	// Concurrency is the maximum number of queries in flight.
+	Concurrency int
+
+	// BufSize is the advertised EDNS0 UDP buffer size.
+	BufSize int
+
+	// Retries is the number of times a query failing transiently (timeout,
+	// SERVFAIL) is retried, with exponential backoff starting at Backoff.
+	Retries int
+	Backoff time.Duration
+
+	// Iterative resolves from the RootHints, instead of using Servers.
+	Iterative bool
+	RootHints []string
+}
+
+type Output struct {
+	Format string
+}
+
+// Scoring overrides the default weights of the score per domain.
+type Scoring struct {
+	// Categories weigh the categories in the overall score, by category.
+	Categories map[string]float64
+
+	// Checks weigh the checks within their category, by plugin key.
+	Checks map[string]float64
+}
+
+// Exporter configures the Prometheus exporter.
+type Exporter struct {
+	// Domains are rescanned every Interval.
+	Domains  []string
+	Interval time.Duration
+}
+
+// Watch configures the watch command.
+type Watch struct {
+	// Domains are rescanned every Interval.
+	Domains  []string
+	Interval time.Duration
+
+	// Webhook is the URL alerts are posted to.
+	Webhook string
+
+	// State is the directory keeping the last scan of every domain.
+	State string
+}
+
+// History configures the store keeping the results of every scan.
+type History struct {
+	// Path is the directory of the store, scans aren't kept if empty.
+	Path string
+
+	// Retention is how long scans are kept, 0 keeps them forever.
+	Retention time.Duration
+
+	// MaxScans is the number of scans kept per domain, 0 keeps all.
+	MaxScans int
+}
+
+// Limits caps the rate of the network traffic of all checks, 0 disables.
+type Limits struct {
+	// DNSQueries is the maximum number of DNS queries per second.
+	DNSQueries float64
+
+	// SMTPConnections is the maximum number of SMTP connections per second.
+	SMTPConnections float64
+}
+
+// Plugin is the configuration of a single plugin. Options that do not apply
+// to a plugin are ignored by it.
+type Plugin struct {
+	Enabled bool
+
+	// Timeout is the time budget of a single check.
+	Timeout time.Duration
+
+	// Selectors are the DKIM selectors to check.
+	Selectors []string
+
+	// Ports, EHLO and SMTPTimeout configure the SMTP banner grab.
+	Ports       []int
+	EHLO        string
+	SMTPTimeout time.Duration
+}
+
+// Default returns the configuration used when no configuration file exists.
+func Default() *Config {
+	return &Config{
+		Output: Output{
+			Format: "text",
+		},
+		Scoring: Scoring{
+			Categories: map[string]float64{},
+			Checks:     map[string]float64{},
+		},
+		Plugins: map[string]Plugin{},
+	}
+}
+
+// Plugin returns the configuration of the plugin with key.
+func (c *Config) Plugin(key string) Plugin {
+	if p, ok := c.Plugins[key]; ok {
+		return p
+	}
+
+	return Plugin{
+		Enabled: true,
+	}
+}
+
+// Load reads the configuration file at path.
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	m, err := decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	c := Default()
+
+	root := newSection(m)
+
+	resolver := root.Table("resolver")
+	resolver.Strings("servers", &c.Resolver.Servers)
+	resolver.Int("concurrency", &c.Resolver.Concurrency)
+	resolver.Int("bufsize", &c.Resolver.BufSize)
+	if c.Resolver.BufSize != 0 && (c.Resolver.BufSize < 512 || c.Resolver.BufSize > 65535) {
+		resolver.fail("bufsize", "integer from 512 to 65535")
+	}
+
+	resolver.Int("retries", &c.Resolver.Retries)
+	resolver.Duration("backoff", &c.Resolver.Backoff)
+	resolver.Bool("iterative", &c.Resolver.Iterative)
+	resolver.Strings("root-hints", &c.Resolver.RootHints)
+
+	output := root.Table("output")
+	output.String("format", &c.Output.Format)
+
+	keys := pluginKeys()
+
+	categories := map[string]bool{}
+	for _, category := range plugins.Categories {
+		categories[string(category)] = true
+	}
+
+	scoring := root.Table("scoring")
+	for _, t := range []struct {
+		name    string
+		weights map[string]float64
+		known   map[string]bool
+		what    string
+	}{
+		{"categories", c.Scoring.Categories, categories, "category"},
+		{"checks", c.Scoring.Checks, keys, "plugin"},
+	} {
+		s := scoring.Table(t.name)
+		for _, key := range s.Keys() {
+			if !t.known[key] {
+				s.invalid(key, "unknown "+t.what)
+				continue
+			}
+
+			var weight float64
+			s.Float(key, &weight)
+			t.weights[key] = weight
+		}
+	}
+
+	exporter := root.Table("exporter")
+	exporter.Strings("domains", &c.Exporter.Domains)
+	exporter.Duration("interval", &c.Exporter.Interval)
+
+	watch := root.Table("watch")
+	watch.Strings("domains", &c.Watch.Domains)
+	watch.Duration("interval", &c.Watch.Interval)
+	watch.String("webhook", &c.Watch.Webhook)
+	watch.String("state", &c.Watch.State)
+
+	history := root.Table("history")
+	history.String("path", &c.History.Path)
+	history.Duration("retention", &c.History.Retention)
+	history.Int("max-scans", &c.History.MaxScans)
+
+	limits := root.Table("limits")
+	limits.Float("dns-qps", &c.Limits.DNSQueries)
+	limits.Float("smtp-cps", &c.Limits.SMTPConnections)
+
+	c.Suppressions = suppressions(root)
+
+	ps := root.Table("plugins")
+	for _, key := range ps.Keys() {
+		if !keys[key] {
+			ps.invalid(key, "unknown plugin")
+			continue
+		}
+
+		s := ps.Table(key)
+
+		p := c.Plugin(key)
+		s.Bool("enabled", &p.Enabled)
+		s.Duration("timeout", &p.Timeout)
+		s.Strings("selectors", &p.Selectors)
+		s.Ints("ports", &p.Ports)
+		s.String("ehlo", &p.EHLO)
+		s.Duration("smtp-timeout", &p.SMTPTimeout)
+
+		c.Plugins[key] = p
+	}
+
+	root.checkUnknown()
+
+	if err := root.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	return c, nil
+}
+
+// pluginKeys returns the keys of the registered plugins.
+func pluginKeys() map[string]bool {
+	keys := map[string]bool{}
+	for _, fn := range plugins.Plugins {
+		keys[plugins.Key(fn().Name())] = true
+	}
+
+	return keys
+}
+
+// decode parses the TOML document of r.
+func decode(r io.Reader) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	if _, err := toml.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// section reads typed values from a decoded table. The first error
+// encountered is kept, and returned by Err. Every key read is remembered, so
+// keys that were never read can be reported as unknown.
+type section struct {
+	name string
+	m    map[string]interface{}
+
+	err *error
+
+	// used holds the paths of the keys read, shared by all sections
+	used map[string]bool
+}
+
+func newSection(m map[string]interface{}) *section {
+	return &section{
+		m:    m,
+		err:  new(error),
+		used: map[string]bool{},
+	}
+}
+
+// child returns the section of table m at key.
+func (s *section) child(name string, m map[string]interface{}) *section {
+	return &section{
+		name: name,
+		m:    m,
+		err:  s.err,
+		used: s.used,
+	}
+}
+
+// value returns the value of key, marking it as read.
+func (s *section) value(key string) interface{} {
+	s.used[s.path(key)] = true
+	return s.m[key]
+}
+
+// checkUnknown fails on the first key of the section, or of its tables,
+// that was never read, like a misspelled key or section.
+func (s *section) checkUnknown() {
+	for _, key := range s.Keys() {
+		path := s.path(key)
+
+		switch v := s.m[key].(type) {
+		case map[string]interface{}:
+			if !s.used[path] {
+				s.invalid(key, "unknown section")
+				return
+			}
+
+			s.child(path, v).checkUnknown()
+		case []map[string]interface{}:
+			if !s.used[path] {
+				s.invalid(key, "unknown section")
+				return
+			}
+
+			for i, m := range v {
+				s.child(fmt.Sprintf("%s[%d]", path, i), m).checkUnknown()
+			}
+		default:
+			if !s.used[path] {
+				s.invalid(key, "unknown key")
+				return
+			}
+		}
+	}
+}
+
+func (s *section) path(key string) string {
+	if s.name == "" {
+		return key
+	}
+
+	return s.name + "." + key
+}
+
+func (s *section) fail(key string, expected string) {
+	s.invalid(key, "expected "+expected)
+}
+
+// invalid keeps the error message about key, unless an error was kept
+// before.
+func (s *section) invalid(key string, message string) {
+	if *s.err == nil {
+		*s.err = fmt.Errorf("%s: %s", s.path(key), message)
+	}
+}
+
+func (s *section) Err() error {
+	return *s.err
+}
+
+// Keys returns the keys of the section in sorted order.
+func (s *section) Keys() []string {
+	keys := []string{}
+	for key := range s.m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Table returns the sub table key, an empty section if it doesn't exist.
+func (s *section) Table(key string) *section {
+	t := s.child(s.path(key), map[string]interface{}{})
+
+	switch v := s.value(key).(type) {
+	case nil:
+	case map[string]interface{}:
+		t.m = v
+	default:
+		s.fail(key, "table")
+	}
+
+	return t
+}
+
+func (s *section) String(key string, v *string) {
+	switch value := s.value(key).(type) {
+	case nil:
+	case string:
+		*v = value
+	default:
+		s.fail(key, "string")
+	}
+}
+
+func (s *section) Bool(key string, v *bool) {
+	switch value := s.value(key).(type) {
+	case nil:
+	case bool:
+		*v = value
+	default:
+		s.fail(key, "boolean")
+	}
+}
+
+func (s *section) Int(key string, v *int) {
+	switch value := s.value(key).(type) {
+	case nil:
+	case int64:
+		*v = int(value)
+	default:
+		s.fail(key, "integer")
+	}
+}
+
+// Tables returns the array of tables key, as written with [[key]].
+func (s *section) Tables(key string) []*section {
+	tables := []*section{}
+
+	switch v := s.value(key).(type) {
+	case nil:
+	case []map[string]interface{}:
+		for i, m := range v {
+			tables = append(tables, s.child(fmt.Sprintf("%s[%d]", s.path(key), i), m))
+		}
+	default:
+		s.fail(key, "array of tables")
+	}
+
+	return tables
+}
+
+// Time reads a date or date and time.
+func (s *section) Time(key string, v *time.Time) {
+	switch value := s.value(key).(type) {
+	case nil:
+	case time.Time:
+		*v = value
+	default:
+		s.fail(key, "date")
+	}
+}
+
+// Float reads a number, integer or not.
+func (s *section) Float(key string, v *float64) {
+	switch value := s.value(key).(type) {
+	case nil:
+	case int64:
+		*v = float64(value)
+	case float64:
+		*v = value
+	default:
+		s.fail(key, "number")
+	}
+}
+
+// Duration reads a duration like "30s" or "5m".
+func (s *section) Duration(key string, v *time.Duration) {
+	switch value := s.value(key).(type) {
+	case nil:
+	case string:
+		d, err := ParseDuration(value)
+		if err != nil {
+			s.fail(key, "duration")
+			return
+		}
+
+		*v = d
+	default:
+		s.fail(key, "duration")
+	}
+}
+
+// ParseDuration parses a duration like time.ParseDuration, and days like
+// "90d".
+func ParseDuration(value string) (time.Duration, error) {
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("Invalid duration: %s", value)
+		}
+
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+func (s *section) Strings(key string, v *[]string) {
+	switch value := s.value(key).(type) {
+	case nil:
+	case []interface{}:
+		values := []string{}
+		for _, e := range value {
+			str, ok := e.(string)
+			if !ok {
+				s.fail(key, "array of strings")
+				return
+			}
+
+			values = append(values, str)
+		}
+
+		*v = values
+	default:
+		s.fail(key, "array of strings")
+	}
+}
+
+func (s *section) Ints(key string, v *[]int) {
+	switch value := s.value(key).(type) {
+	case nil:
+	case []interface{}:
+		values := []int{}
+		for _, e := range value {
+			i, ok := e.(int64)
+			if !ok {
+				s.fail(key, "array of integers")
+				return
+			}
+
+			values = append(values, int(i))
+		}
+
+		*v = values
+	default:
+		s.fail(key, "array of integers")
+	}
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkmail")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+
+	for _, tt := range []struct {
+		doc string
+		err string
+	}{
+		{"[resolver]\nbufsize = 4096\n[plugins.spf]\ntimeout = \"5s\"\n[scoring.checks]\nspf = 2.0", ""},
+		{"[resolverx]", path + ": resolverx: unknown section"},
+		{"[resolver]\nserverz = [\"192.0.2.1\"]", path + ": resolver.serverz: unknown key"},
+		{"[resolver]\nbufsize = 70000", path + ": resolver.bufsize: expected integer from 512 to 65535"},
+		{"[resolver]\nbufsize = \"large\"", path + ": resolver.bufsize: expected integer"},
+		{"[plugins.spff]", path + ": plugins.spff: unknown plugin"},
+		{"[plugins.spf]\nenable = false", path + ": plugins.spf.enable: unknown key"},
+		{"[scoring.checks]\nspff = 1.0", path + ": scoring.checks.spff: unknown plugin"},
+		{"[scoring.categories]\nspam = 1.0", path + ": scoring.categories.spam: unknown category"},
+		{"[[suppression]]\nplugin = \"spf\"\nfinding = \"SPF-MISSING\"\ndomain = \"*\"\njustification = \"parked\"\nexpires = 2030-01-01\nexpire = 2030-01-01", path + ": suppression[0].expire: unknown key"},
+		{"[[suppression]]\nplugin = \"spf\"\nfinding = \"SPF-MISSING\"\ndomain = \"*.example.[com\"\njustification = \"parked\"\nexpires = 2030-01-01", path + ": suppression[0].domain: expected glob like \"*.example.com\""},
+	} {
+		if err := ioutil.WriteFile(path, []byte(tt.doc), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := Load(path)
+		if tt.err == "" && err != nil {
+			t.Errorf("%q: got error %q", tt.doc, err)
+		} else if tt.err != "" && (err == nil || err.Error() != tt.err) {
+			t.Errorf("%q: got error %v, expected %q", tt.doc, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// Suppression accepts the risk of a finding, until it expires.
+type Suppression struct {
+	// Plugin is the key or name of the plugin reporting the finding.
+	Plugin string
+
+	// Finding is the ID of the finding.
+	Finding string
+
+	// Domain is a glob like "*.example.com" matching the domains.
+	Domain string
+
+	// Target optionally limits the suppression to findings about a
+	// specific target, like a mail server.
+	Target string
+
+	Justification string
+	Expires       time.Time
+}
+
+// LoadSuppressions reads the suppressions of the file at path, written as
+// [[suppression]] tables like in the configuration file.
+func LoadSuppressions(path string) ([]Suppression, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	m, err := decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	root := newSection(m)
+
+	result := suppressions(root)
+
+	root.checkUnknown()
+
+	if err := root.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	return result, nil
+}
+
+// suppressions reads the [[suppression]] tables of root. Every suppression
+// needs a justification, an expiry date and a valid domain glob.
+func suppressions(root *section) []Suppression {
+	result := []Suppression{}
+
+	for _, s := range root.Tables("suppression") {
+		sup := Suppression{}
+		s.String("plugin", &sup.Plugin)
+		s.String("finding", &sup.Finding)
+		s.String("domain", &sup.Domain)
+		s.String("target", &sup.Target)
+		s.String("justification", &sup.Justification)
+		s.Time("expires", &sup.Expires)
+
+		for _, field := range []struct {
+			key   string
+			value string
+		}{
+			{"plugin", sup.Plugin},
+			{"finding", sup.Finding},
+			{"domain", sup.Domain},
+			{"justification", sup.Justification},
+		} {
+			if field.value == "" {
+				s.fail(field.key, "non empty string")
+			}
+		}
+
+		// a malformed glob would never match, silently
+		if _, err := path.Match(sup.Domain, ""); err != nil {
+			s.fail("domain", "glob like \"*.example.com\"")
+		}
+
+		if sup.Expires.IsZero() {
+			s.fail("expires", "date")
+		}
+
+		result = append(result, sup)
+	}
+
+	return result
+}
@@ -0,0 +1,292 @@
+// Package diff compares the results of two runs, reporting new, resolved and
+// changed findings per domain.
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// Kind is the kind of a change.
+type Kind string
+
+const (
+	KindNew      Kind = "new"
+	KindResolved Kind = "resolved"
+	KindChanged  Kind = "changed"
+)
+
+// Domain status in the diff.
+const (
+	StatusAdded   = "added"
+	StatusRemoved = "removed"
+)
+
+// Diff holds the changes per domain.
+type Diff struct {
+	Domains []*Domain `json:"domains"`
+}
+
+// Domain holds the changes of a single domain. A domain only scanned in the
+// new run is added, all its findings are new. A domain only scanned in the
+// old run is removed, its findings are not compared.
+type Domain struct {
+	Domain string `json:"domain"`
+	Status string `json:"status,omitempty"`
+
+	New      []Change `json:"new"`
+	Resolved []Change `json:"resolved"`
+	Changed  []Change `json:"changed"`
+}
+
+// Empty returns whether nothing changed for the domain.
+func (d *Domain) Empty() bool {
+	return d.Status == "" && len(d.New) == 0 && len(d.Resolved) == 0 && len(d.Changed) == 0
+}
+
+// Change is a finding that appeared, disappeared or changed.
+type Change struct {
+	Kind     Kind   `json:"kind"`
+	Identity string `json:"identity"`
+
+	Before *plugins.Issue `json:"before,omitempty"`
+	After  *plugins.Issue `json:"after,omitempty"`
+
+	// Fields are the changed fields of a changed finding.
+	Fields []Field `json:"fields,omitempty"`
+}
+
+// Issue returns the issue after the change, or before if it was resolved.
+func (c Change) Issue() plugins.Issue {
+	if c.After != nil {
+		return *c.After
+	}
+
+	return *c.Before
+}
+
+// Field is a changed field, evidence is named by its key.
+type Field struct {
+	Name   string `json:"name"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// volatile evidence differs between runs without anything changing: the
+// server answering depends on the resolver used, and SMTP servers put the
+// current date or the address of the client in their greeting and replies.
+var volatile = map[string]bool{
+	"server": true,
+	"banner": true,
+	"ehlo":   true,
+	"help":   true,
+}
+
+// discriminators are the evidence keys telling apart findings with the same
+// ID and target, like the DKIM selector or the SMTP port.
+var discriminators = []string{"name", "selector", "port", "mechanism"}
+
+// Identities returns the issues of domain by stable identity: the plugin,
+// the finding ID, the target, the evidence telling instances apart and, for
+// findings about a record, the record itself. This way a record keeps its
+// identity when another record is added next to it. When this doesn't tell
+// issues apart the message is part of the identity. Debug issues are left
+// out.
+func Identities(d *report.Domain) map[string]plugins.Issue {
+	groups := map[string][]plugins.Issue{}
+	order := []string{}
+
+	for _, issue := range d.Issues() {
+		if issue.Severity == plugins.SeverityDebug {
+			continue
+		}
+
+		parts := []string{issue.Plugin, issue.ID, issue.Target}
+		for _, key := range discriminators {
+			if value, ok := issue.Evidence[key]; ok {
+				parts = append(parts, key+"="+value)
+			}
+		}
+
+		if record, ok := issue.Evidence["record"]; ok {
+			parts = append(parts, "record="+record)
+		}
+
+		key := strings.Join(parts, "|")
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+
+		groups[key] = append(groups[key], issue)
+	}
+
+	identities := map[string]plugins.Issue{}
+
+	for _, key := range order {
+		issues := groups[key]
+		if len(issues) == 1 {
+			identities[key] = issues[0]
+			continue
+		}
+
+		for i, issue := range issues {
+			id := fmt.Sprintf("%s|message=%s", key, issue.Message)
+			if _, ok := identities[id]; ok {
+				id = fmt.Sprintf("%s|%d", id, i)
+			}
+
+			identities[id] = issue
+		}
+	}
+
+	return identities
+}
+
+// Compare returns the changes from old to new.
+func Compare(old, new *report.Report) *Diff {
+	d := &Diff{
+		Domains: []*Domain{},
+	}
+
+	for _, nd := range new.Domains {
+		dd := &Domain{
+			Domain:   nd.Domain,
+			New:      []Change{},
+			Resolved: []Change{},
+			Changed:  []Change{},
+		}
+
+		before := map[string]plugins.Issue{}
+		if od := old.Domain(nd.Domain); od != nil {
+			before = Identities(od)
+		} else {
+			dd.Status = StatusAdded
+		}
+
+		// findings of checks that didn't run this time aren't resolved,
+		// checks that failed this time, like on a timeout, aren't
+		// compared at all
+		for id, issue := range before {
+			if c := nd.Check(issue.Plugin); c == nil || c.Failed() {
+				delete(before, id)
+			}
+		}
+
+		after := Identities(nd)
+		for id, issue := range after {
+			if c := nd.Check(issue.Plugin); c != nil && c.Failed() {
+				delete(after, id)
+			}
+		}
+
+		for _, id := range identities(after) {
+			a := after[id]
+
+			b, ok := before[id]
+			if !ok {
+				dd.New = append(dd.New, Change{Kind: KindNew, Identity: id, After: &a})
+				continue
+			}
+
+			if fields := compare(b, a); len(fields) > 0 {
+				dd.Changed = append(dd.Changed, Change{Kind: KindChanged, Identity: id, Before: &b, After: &a, Fields: fields})
+			}
+		}
+
+		for _, id := range identities(before) {
+			if _, ok := after[id]; ok {
+				continue
+			}
+
+			b := before[id]
+			dd.Resolved = append(dd.Resolved, Change{Kind: KindResolved, Identity: id, Before: &b})
+		}
+
+		d.Domains = append(d.Domains, dd)
+	}
+
+	for _, od := range old.Domains {
+		if new.Domain(od.Domain) != nil {
+			continue
+		}
+
+		d.Domains = append(d.Domains, &Domain{
+			Domain:   od.Domain,
+			Status:   StatusRemoved,
+			New:      []Change{},
+			Resolved: []Change{},
+			Changed:  []Change{},
+		})
+	}
+
+	return d
+}
+
+// compare returns the fields that differ between two instances of a finding.
+func compare(before, after plugins.Issue) []Field {
+	fields := []Field{}
+
+	if before.Severity != after.Severity {
+		fields = append(fields, Field{"severity", string(before.Severity), string(after.Severity)})
+	}
+
+	keys := []string{}
+	for key := range before.Evidence {
+		keys = append(keys, key)
+	}
+
+	for key := range after.Evidence {
+		if _, ok := before.Evidence[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if volatile[key] {
+			continue
+		}
+
+		b, bok := before.Evidence[key]
+		a, aok := after.Evidence[key]
+		if a != b || aok != bok {
+			fields = append(fields, Field{key, b, a})
+		}
+	}
+
+	// the message only counts when the evidence didn't explain the change,
+	// and it doesn't quote volatile evidence
+	if len(fields) == 0 && before.Message != after.Message && !quotesVolatile(before) && !quotesVolatile(after) {
+		fields = append(fields, Field{"message", before.Message, after.Message})
+	}
+
+	return fields
+}
+
+// quotesVolatile returns whether the message of issue quotes volatile
+// evidence, like the banner of an SMTP server.
+func quotesVolatile(issue plugins.Issue) bool {
+	for key := range volatile {
+		if value := issue.Evidence[key]; value != "" && strings.Contains(issue.Message, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// identities returns the identities in m in sorted order.
+func identities(m map[string]plugins.Issue) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,219 @@
+package diff
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+func issue(plugin, id string, severity plugins.Severity, message string, evidence ...string) plugins.Issue {
+	i := plugins.Issue{
+		ID:       id,
+		Plugin:   plugin,
+		Target:   "example.com",
+		Severity: severity,
+		Message:  message,
+	}
+
+	for n := 0; n+1 < len(evidence); n += 2 {
+		i = i.With(evidence[n], evidence[n+1])
+	}
+
+	return i
+}
+
+func timeout(plugin string) plugins.Issue {
+	i := plugins.FindingTimeout.Issue("example.com", "Timed out.")
+	i.Plugin = plugin
+	return i
+}
+
+func domain(name string, checks ...*report.Check) *report.Domain {
+	return &report.Domain{Domain: name, Checks: checks}
+}
+
+func check(plugin string, issues ...plugins.Issue) *report.Check {
+	return &report.Check{Plugin: plugin, Issues: issues}
+}
+
+func keys(m map[string]plugins.Issue) []string {
+	ids := []string{}
+	for id := range m {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+func TestIdentities(t *testing.T) {
+	d := domain("example.com",
+		check("DKIM",
+			issue("DKIM", "DKIM-WEAK-KEY", plugins.SeverityWarning, "Weak key.", "selector", "s1"),
+			issue("DKIM", "DKIM-WEAK-KEY", plugins.SeverityWarning, "Weak key.", "selector", "s2"),
+			issue("DKIM", "DKIM-DEBUG", plugins.SeverityDebug, "Queried."),
+		),
+		check("TXT",
+			issue("TXT", "TXT-RECORD", plugins.SeverityInfo, "Record.", "record", "v=spf1 -all"),
+			issue("TXT", "TXT-RECORD", plugins.SeverityInfo, "Record.", "record", "google-site-verification=x"),
+			issue("TXT", "TXT-NOTE", plugins.SeverityInfo, "First."),
+			issue("TXT", "TXT-NOTE", plugins.SeverityInfo, "Second."),
+			issue("TXT", "TXT-SAME", plugins.SeverityInfo, "Same."),
+			issue("TXT", "TXT-SAME", plugins.SeverityInfo, "Same."),
+		),
+	)
+
+	expected := []string{
+		"DKIM|DKIM-WEAK-KEY|example.com|selector=s1",
+		"DKIM|DKIM-WEAK-KEY|example.com|selector=s2",
+		"TXT|TXT-NOTE|example.com|message=First.",
+		"TXT|TXT-NOTE|example.com|message=Second.",
+		"TXT|TXT-RECORD|example.com|record=google-site-verification=x",
+		"TXT|TXT-RECORD|example.com|record=v=spf1 -all",
+		"TXT|TXT-SAME|example.com|message=Same.",
+		"TXT|TXT-SAME|example.com|message=Same.|1",
+	}
+
+	if ids := keys(Identities(d)); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("got identities %v, expected %v", ids, expected)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	old := &report.Report{Domains: []*report.Domain{
+		domain("example.com",
+			check("SPF",
+				issue("SPF", "SPF-ALL-SOFTFAIL", plugins.SeverityWarning, "Softfail.", "server", "192.0.2.1:53"),
+				issue("SPF", "SPF-INCLUDE", plugins.SeverityInfo, "Include.", "mechanism", "include:a.example.com"),
+			),
+			check("DMARC",
+				issue("DMARC", "DMARC-POLICY", plugins.SeverityOK, "Reject.", "policy", "reject"),
+			),
+			check("MX",
+				issue("MX", "MX-RECORD", plugins.SeverityInfo, "MX.", "host", "mail.example.com"),
+			),
+			check("DKIM",
+				issue("DKIM", "DKIM-MISSING", plugins.SeverityWarning, "Missing."),
+			),
+		),
+		domain("removed.example.com"),
+	}}
+
+	new := &report.Report{Domains: []*report.Domain{
+		domain("example.com",
+			check("SPF",
+				// the server answering differs between runs
+				issue("SPF", "SPF-ALL-SOFTFAIL", plugins.SeverityWarning, "Softfail.", "server", "192.0.2.2:53"),
+				issue("SPF", "SPF-INCLUDE", plugins.SeverityInfo, "Include.", "mechanism", "include:b.example.com"),
+			),
+			check("DMARC",
+				issue("DMARC", "DMARC-POLICY", plugins.SeverityWarning, "None.", "policy", "none"),
+			),
+			// failed, not compared
+			check("MX", timeout("MX")),
+			// the DKIM check didn't run
+		),
+		domain("added.example.com",
+			check("SPF", issue("SPF", "SPF-MISSING", plugins.SeverityError, "Missing.")),
+		),
+	}}
+
+	d := Compare(old, new)
+
+	changes := map[string][]string{}
+	for _, dd := range d.Domains {
+		ids := []string{dd.Status}
+		for _, changes := range [][]Change{dd.New, dd.Resolved, dd.Changed} {
+			for _, c := range changes {
+				ids = append(ids, string(c.Kind)+" "+c.Identity)
+			}
+		}
+
+		changes[dd.Domain] = ids
+	}
+
+	expected := map[string][]string{
+		"example.com": {
+			"",
+			"new SPF|SPF-INCLUDE|example.com|mechanism=include:b.example.com",
+			"resolved SPF|SPF-INCLUDE|example.com|mechanism=include:a.example.com",
+			"changed DMARC|DMARC-POLICY|example.com",
+		},
+		"added.example.com": {
+			StatusAdded,
+			"new SPF|SPF-MISSING|example.com",
+		},
+		"removed.example.com": {
+			StatusRemoved,
+		},
+	}
+
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("got changes %v, expected %v", changes, expected)
+	}
+
+	for _, dd := range d.Domains {
+		for _, c := range dd.Changed {
+			fields := []Field{{"severity", "OK", "WARNING"}, {"policy", "reject", "none"}}
+			if !reflect.DeepEqual(c.Fields, fields) {
+				t.Errorf("%s: got fields %v, expected %v", c.Identity, c.Fields, fields)
+			}
+		}
+	}
+}
+
+func TestCompareRecordAdded(t *testing.T) {
+	spf := issue("TXT", "TXT-RECORD", plugins.SeverityInfo, "v=spf1 -all", "name", "example.com.", "record", "v=spf1 -all")
+	verification := issue("TXT", "TXT-RECORD", plugins.SeverityInfo, "google-site-verification=x", "name", "example.com.", "record", "google-site-verification=x")
+
+	old := &report.Report{Domains: []*report.Domain{domain("example.com", check("TXT", spf))}}
+	new := &report.Report{Domains: []*report.Domain{domain("example.com", check("TXT", spf, verification))}}
+
+	dd := Compare(old, new).Domains[0]
+
+	// the first record is unchanged, only the second is new
+	if len(dd.New) != 1 || len(dd.Resolved) != 0 || len(dd.Changed) != 0 {
+		t.Fatalf("got new %v, resolved %v and changed %v, expected only the added record as new", dd.New, dd.Resolved, dd.Changed)
+	}
+
+	if record := dd.New[0].Issue().Evidence["record"]; record != "google-site-verification=x" {
+		t.Errorf("got new record %q, expected the added record", record)
+	}
+
+	// and the other way around only the removed record is resolved
+	dd = Compare(new, old).Domains[0]
+	if len(dd.New) != 0 || len(dd.Resolved) != 1 || len(dd.Changed) != 0 {
+		t.Errorf("got new %v, resolved %v and changed %v, expected only the removed record as resolved", dd.New, dd.Resolved, dd.Changed)
+	}
+}
+
+func TestCompareVolatile(t *testing.T) {
+	banner := func(banner, ehlo string) plugins.Issue {
+		i := issue("Banner grabbing", "SMTP-BANNER", plugins.SeverityInfo, "Banner mail.example.com(192.0.2.25) "+banner, "port", "25", "banner", banner)
+		return i.With("ehlo", ehlo)
+	}
+
+	old := &report.Report{Domains: []*report.Domain{domain("example.com",
+		check("Banner grabbing", banner("220 mail.example.com ESMTP Exim 4.96 Thu, 01 Oct 2026 12:00:00 +0000", "250-mail.example.com Hello [192.0.2.1]")),
+	)}}
+	new := &report.Report{Domains: []*report.Domain{domain("example.com",
+		check("Banner grabbing", banner("220 mail.example.com ESMTP Exim 4.96 Thu, 08 Oct 2026 12:00:00 +0000", "250-mail.example.com Hello [192.0.2.2]")),
+	)}}
+
+	if dd := Compare(old, new).Domains[0]; !dd.Empty() {
+		t.Errorf("got new %v, resolved %v and changed %v, expected the banner date not to count", dd.New, dd.Resolved, dd.Changed)
+	}
+
+	// the severity still counts
+	warning := banner("220 mail.example.com ESMTP Exim 4.96 Thu, 08 Oct 2026 12:00:00 +0000", "")
+	warning.Severity = plugins.SeverityWarning
+
+	new.Domains[0].Checks[0].Issues = []plugins.Issue{warning}
+
+	if dd := Compare(old, new).Domains[0]; len(dd.Changed) != 1 || !reflect.DeepEqual(dd.Changed[0].Fields, []Field{{"severity", "INFO", "WARNING"}}) {
+		t.Errorf("got changed %v, expected the severity to change", dd.Changed)
+	}
+}
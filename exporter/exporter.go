@@ -0,0 +1,287 @@
+// Package exporter rescans a list of domains on an interval and exposes the
+// results of the last scan as Prometheus metrics.
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+var log = logging.MustGetLogger("check/exporter")
+
+// DefaultInterval is the default interval between scans.
+const DefaultInterval = time.Hour
+
+const namespace = "checkmail"
+
+// ScanFunc runs the checks of domains, returning the finished report.
+type ScanFunc func(ctx context.Context, domains []string) (*report.Report, error)
+
+// Exporter scans Domains every Interval, and collects the metrics of the last
+// scan.
+type Exporter struct {
+	Scan    ScanFunc
+	Domains []string
+
+	Interval time.Duration
+
+	// Timeout is the time budget of a single scan, 0 disables.
+	Timeout time.Duration
+
+	m    sync.Mutex
+	last *report.Report
+
+	scans          *prometheus.CounterVec
+	resolverErrors *prometheus.CounterVec
+}
+
+var (
+	checkStatusDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "check", "status"),
+		"Status of the check of a domain, 1 for the current status pass, warn or fail.",
+		[]string{"domain", "plugin", "status"}, nil,
+	)
+	findingsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "findings"),
+		"Number of findings of a check of a domain, by severity.",
+		[]string{"domain", "plugin", "severity"}, nil,
+	)
+	suppressedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "findings_suppressed"),
+		"Number of suppressed findings of a check of a domain.",
+		[]string{"domain", "plugin"}, nil,
+	)
+	scoreDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "score"),
+		"Score of a domain, from 0 to 100.",
+		[]string{"domain", "grade"}, nil,
+	)
+	spfLookupsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "spf", "dns_lookups"),
+		"Number of DNS lookups evaluating the SPF record of a domain takes, at most 10 are allowed.",
+		[]string{"domain"}, nil,
+	)
+	certificateExpiryDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "mx", "certificate_expiry_days"),
+		"Days until the TLS certificate of a mail server of a domain expires.",
+		[]string{"domain", "mx", "ip", "port"}, nil,
+	)
+	scanDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scan", "duration_seconds"),
+		"Duration of the last scan of a domain.",
+		[]string{"domain"}, nil,
+	)
+	checkDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "check", "duration_seconds"),
+		"Duration of the last check of a domain.",
+		[]string{"domain", "plugin"}, nil,
+	)
+	lastScanDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scan", "last_timestamp_seconds"),
+		"Time the last scan of a domain finished.",
+		[]string{"domain"}, nil,
+	)
+)
+
+// severities are the severities counted, debug findings are left out.
+var severities = []plugins.Severity{
+	plugins.SeverityError,
+	plugins.SeverityWarning,
+	plugins.SeverityInfo,
+	plugins.SeverityOK,
+}
+
+// New returns an exporter scanning domains with scan.
+func New(scan ScanFunc, domains []string) *Exporter {
+	return &Exporter{
+		Scan:     scan,
+		Domains:  domains,
+		Interval: DefaultInterval,
+		scans: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "scans_total",
+			Help:      "Number of scans of all domains, by result.",
+		}, []string{"result"}),
+		resolverErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "resolver",
+			Name:      "errors_total",
+			Help:      "Number of failed DNS lookups, by outcome.",
+		}, []string{"outcome"}),
+	}
+}
+
+// Observe counts the failed lookups, it is passed to the resolver.
+func (e *Exporter) Observe(name string, qtype uint16, outcome plugins.Outcome) {
+	switch outcome {
+	case plugins.OutcomeSuccess, plugins.OutcomeNoData, plugins.OutcomeNXDomain:
+		return
+	}
+
+	e.resolverErrors.WithLabelValues(string(outcome)).Inc()
+}
+
+// Handler returns the handler serving the metrics.
+func (e *Exporter) Handler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(e, e.scans, e.resolverErrors)
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Run scans the domains right away and then every interval, until ctx is
+// done.
+func (e *Exporter) Run(ctx context.Context) {
+	interval := e.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		e.scan(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scan runs a single scan, keeping its report for the metrics.
+func (e *Exporter) scan(ctx context.Context) {
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+
+	rep, err := e.Scan(ctx, e.Domains)
+	if err != nil {
+		log.Errorf("Error scanning: %s", err.Error())
+
+		e.scans.WithLabelValues("error").Inc()
+		return
+	}
+
+	if rep.Failed() {
+		e.scans.WithLabelValues("failed").Inc()
+	} else {
+		e.scans.WithLabelValues("done").Inc()
+	}
+
+	e.m.Lock()
+	e.last = rep
+	e.m.Unlock()
+}
+
+// Describe implements prometheus.Collector.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		checkStatusDesc,
+		findingsDesc,
+		suppressedDesc,
+		scoreDesc,
+		spfLookupsDesc,
+		certificateExpiryDesc,
+		scanDurationDesc,
+		checkDurationDesc,
+		lastScanDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector, collecting the metrics of the
+// last scan.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.m.Lock()
+	rep := e.last
+	e.m.Unlock()
+
+	if rep == nil {
+		return
+	}
+
+	now := time.Now()
+
+	gauge := func(desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+	}
+
+	for _, d := range rep.Domains {
+		gauge(scanDurationDesc, time.Duration(d.Duration).Seconds(), d.Domain)
+		gauge(lastScanDesc, float64(d.Finished.Unix()), d.Domain)
+
+		if s := d.Score; s != nil {
+			gauge(scoreDesc, float64(s.Score), d.Domain, s.Grade)
+		}
+
+		for _, c := range d.Checks {
+			gauge(checkDurationDesc, time.Duration(c.Duration).Seconds(), d.Domain, c.Plugin)
+
+			status := c.Status()
+			for _, s := range []report.Status{report.StatusPass, report.StatusWarn, report.StatusFail} {
+				value := 0.0
+				if s == status {
+					value = 1
+				}
+
+				gauge(checkStatusDesc, value, d.Domain, c.Plugin, string(s))
+			}
+
+			counts := map[plugins.Severity]int{}
+			for _, issue := range c.Issues {
+				counts[issue.Severity]++
+			}
+
+			for _, severity := range severities {
+				gauge(findingsDesc, float64(counts[severity]), d.Domain, c.Plugin, string(severity))
+			}
+
+			gauge(suppressedDesc, float64(len(c.Suppressed)), d.Domain, c.Plugin)
+		}
+
+		e.collectEvidence(d, now, gauge)
+	}
+}
+
+// collectEvidence collects the metrics read from the evidence of findings:
+// the SPF lookups and certificate expiry.
+func (e *Exporter) collectEvidence(d *report.Domain, now time.Time, gauge func(*prometheus.Desc, float64, ...string)) {
+	lookups := -1
+
+	for _, issue := range d.Issues() {
+		switch issue.ID {
+		case "SPF-RECORD":
+			if n, err := strconv.Atoi(issue.Evidence["lookups"]); err == nil && n > lookups {
+				lookups = n
+			}
+		case "SMTP-TLS-CERTIFICATE":
+			notAfter, err := time.Parse(time.RFC3339, issue.Evidence["not_after"])
+			if err != nil {
+				continue
+			}
+
+			days := notAfter.Sub(now).Hours() / 24
+			gauge(certificateExpiryDesc, days, d.Domain, issue.Evidence["mx"], issue.Evidence["ip"], issue.Evidence["port"])
+		}
+	}
+
+	if lookups >= 0 {
+		gauge(spfLookupsDesc, float64(lookups), d.Domain)
+	}
+}
@@ -0,0 +1,115 @@
+package exporter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+func TestCollect(t *testing.T) {
+	finished := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	rep := &report.Report{
+		Domains: []*report.Domain{
+			{
+				Domain:   "example.com",
+				Finished: finished,
+				Duration: report.Duration(2 * time.Second),
+				Score:    &report.Score{Score: 85, Grade: "B"},
+				Checks: []*report.Check{
+					{
+						Plugin:   "SPF",
+						Duration: report.Duration(500 * time.Millisecond),
+						Issues: []plugins.Issue{
+							plugins.Finding{ID: "SPF-RECORD", Severity: plugins.SeverityInfo}.Issue("example.com", "v=spf1 include:_spf.example.net ~all").With("lookups", "4"),
+							plugins.Finding{ID: "SPF-ALL-SOFTFAIL", Severity: plugins.SeverityWarning}.Issue("example.com", "Softfail."),
+						},
+					},
+					{
+						Plugin:   "DMARC",
+						Duration: report.Duration(time.Second),
+						Issues: []plugins.Issue{
+							plugins.Finding{ID: "DMARC-MISSING", Severity: plugins.SeverityError}.Issue("_dmarc.example.com", "Missing."),
+						},
+						Suppressed: []report.Suppressed{
+							{Issue: plugins.Finding{ID: "DMARC-RUA", Severity: plugins.SeverityWarning}.Issue("_dmarc.example.com", "No reports.")},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	e := New(func(ctx context.Context, domains []string) (*report.Report, error) {
+		return rep, nil
+	}, []string{"example.com"})
+
+	e.Observe("example.com", 16, plugins.OutcomeSuccess)
+	e.Observe("example.com", 16, plugins.OutcomeTimeout)
+	e.Observe("example.com", 15, plugins.OutcomeTimeout)
+	e.Observe("example.com", 15, plugins.OutcomeServFail)
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(e, e.scans, e.resolverErrors)
+
+	e.scan(context.Background())
+
+	expected := `
+# HELP checkmail_check_duration_seconds Duration of the last check of a domain.
+# TYPE checkmail_check_duration_seconds gauge
+checkmail_check_duration_seconds{domain="example.com",plugin="DMARC"} 1
+checkmail_check_duration_seconds{domain="example.com",plugin="SPF"} 0.5
+# HELP checkmail_check_status Status of the check of a domain, 1 for the current status pass, warn or fail.
+# TYPE checkmail_check_status gauge
+checkmail_check_status{domain="example.com",plugin="DMARC",status="fail"} 1
+checkmail_check_status{domain="example.com",plugin="DMARC",status="pass"} 0
+checkmail_check_status{domain="example.com",plugin="DMARC",status="warn"} 0
+checkmail_check_status{domain="example.com",plugin="SPF",status="fail"} 0
+checkmail_check_status{domain="example.com",plugin="SPF",status="pass"} 0
+checkmail_check_status{domain="example.com",plugin="SPF",status="warn"} 1
+# HELP checkmail_findings Number of findings of a check of a domain, by severity.
+# TYPE checkmail_findings gauge
+checkmail_findings{domain="example.com",plugin="DMARC",severity="ERROR"} 1
+checkmail_findings{domain="example.com",plugin="DMARC",severity="INFO"} 0
+checkmail_findings{domain="example.com",plugin="DMARC",severity="OK"} 0
+checkmail_findings{domain="example.com",plugin="DMARC",severity="WARNING"} 0
+checkmail_findings{domain="example.com",plugin="SPF",severity="ERROR"} 0
+checkmail_findings{domain="example.com",plugin="SPF",severity="INFO"} 1
+checkmail_findings{domain="example.com",plugin="SPF",severity="OK"} 0
+checkmail_findings{domain="example.com",plugin="SPF",severity="WARNING"} 1
+# HELP checkmail_findings_suppressed Number of suppressed findings of a check of a domain.
+# TYPE checkmail_findings_suppressed gauge
+checkmail_findings_suppressed{domain="example.com",plugin="DMARC"} 1
+checkmail_findings_suppressed{domain="example.com",plugin="SPF"} 0
+# HELP checkmail_resolver_errors_total Number of failed DNS lookups, by outcome.
+# TYPE checkmail_resolver_errors_total counter
+checkmail_resolver_errors_total{outcome="SERVFAIL"} 1
+checkmail_resolver_errors_total{outcome="TIMEOUT"} 2
+# HELP checkmail_scan_duration_seconds Duration of the last scan of a domain.
+# TYPE checkmail_scan_duration_seconds gauge
+checkmail_scan_duration_seconds{domain="example.com"} 2
+# HELP checkmail_scan_last_timestamp_seconds Time the last scan of a domain finished.
+# TYPE checkmail_scan_last_timestamp_seconds gauge
+checkmail_scan_last_timestamp_seconds{domain="example.com"} 1.790856e+09
+# HELP checkmail_scans_total Number of scans of all domains, by result.
+# TYPE checkmail_scans_total counter
+checkmail_scans_total{result="done"} 1
+# HELP checkmail_score Score of a domain, from 0 to 100.
+# TYPE checkmail_score gauge
+checkmail_score{domain="example.com",grade="B"} 85
+# HELP checkmail_spf_dns_lookups Number of DNS lookups evaluating the SPF record of a domain takes, at most 10 are allowed.
+# TYPE checkmail_spf_dns_lookups gauge
+checkmail_spf_dns_lookups{domain="example.com"} 4
+`
+
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
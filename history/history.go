@@ -0,0 +1,392 @@
+// Package history keeps the results of every scan per domain on disk, and
+// answers timeline queries on them.
+//
+// The store is a directory with a directory per domain, holding every scan
+// of the domain as a JSON report named by the time the scan finished, so
+// scans sort by time and are removed one by one on retention.
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dutchcoders/checkmail/diff"
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// layout names the scan files, it sorts by time.
+const layout = "20060102T150405.000000000Z"
+
+// pruneInterval is the interval between prunes of all domains while adding
+// scans.
+const pruneInterval = time.Hour
+
+// Store keeps the scans in Dir.
+type Store struct {
+	Dir string
+
+	// Retention is how long scans are kept, 0 keeps them forever.
+	Retention time.Duration
+
+	// MaxScans is the number of scans kept per domain, 0 keeps all.
+	MaxScans int
+
+	m      sync.Mutex
+	pruned time.Time
+}
+
+// Open returns the store in dir, creating it if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Store{Dir: dir}, nil
+}
+
+// name returns the directory name of domain.
+func name(domain string) (string, error) {
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("Invalid domain: %s", domain)
+	}
+
+	return name, nil
+}
+
+// Add stores the scan d, and removes the scans of the domain beyond
+// retention. The other domains are pruned every pruneInterval, so domains
+// that are no longer scanned don't keep their scans.
+func (s *Store) Add(version string, d *report.Domain) error {
+	n, err := name(d.Domain)
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	dir := filepath.Join(s.Dir, n)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&report.Report{
+		Version:  version,
+		Started:  d.Started,
+		Finished: d.Finished,
+		Duration: d.Duration,
+		Domains:  []*report.Domain{d},
+	})
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, d.Finished.UTC().Format(layout)+".json")
+
+	// write and rename, so readers never see a partial scan
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	if time.Since(s.pruned) >= pruneInterval {
+		return s.pruneAll()
+	}
+
+	return s.prune(dir)
+}
+
+// Prune removes the scans beyond retention of every domain, and the
+// directories of the domains left without scans.
+func (s *Store) Prune() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.pruneAll()
+}
+
+func (s *Store) pruneAll() error {
+	domains, err := s.Domains()
+	if err != nil {
+		return err
+	}
+
+	for _, domain := range domains {
+		dir := filepath.Join(s.Dir, domain)
+		if err := s.prune(dir); err != nil {
+			return err
+		}
+
+		paths, _, err := files(dir)
+		if err != nil {
+			return err
+		} else if len(paths) == 0 {
+			// fails when other files are left, which are kept
+			os.Remove(dir)
+		}
+	}
+
+	s.pruned = time.Now()
+	return nil
+}
+
+// files returns the scan files in dir, oldest first, with their times.
+func files(dir string) ([]string, []time.Time, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	paths := []string{}
+	times := []time.Time{}
+
+	for _, fi := range infos {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+
+		t, err := time.Parse(layout, strings.TrimSuffix(fi.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+
+		paths = append(paths, filepath.Join(dir, fi.Name()))
+		times = append(times, t)
+	}
+
+	// ReadDir sorts by name, which sorts by time
+	return paths, times, nil
+}
+
+// prune removes the scans in dir older than the retention, or beyond the
+// maximum number of scans.
+func (s *Store) prune(dir string) error {
+	paths, times, err := files(dir)
+	if err != nil {
+		return err
+	}
+
+	for i, path := range paths {
+		expired := s.Retention > 0 && time.Since(times[i]) > s.Retention
+		excess := s.MaxScans > 0 && len(paths)-i > s.MaxScans
+
+		if !expired && !excess {
+			break
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Domains returns the domains with stored scans.
+func (s *Store) Domains() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := []string{}
+	for _, fi := range infos {
+		if fi.IsDir() {
+			domains = append(domains, fi.Name())
+		}
+	}
+
+	return domains, nil
+}
+
+// Scans returns the scans of domain finished since since, oldest first.
+func (s *Store) Scans(domain string, since time.Time) ([]*report.Domain, error) {
+	n, err := name(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, times, err := files(filepath.Join(s.Dir, n))
+	if err != nil {
+		return nil, err
+	}
+
+	scans := []*report.Domain{}
+
+	for i, path := range paths {
+		if times[i].Before(since) {
+			continue
+		}
+
+		rep, err := report.Load(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range rep.Domains {
+			scans = append(scans, d)
+		}
+	}
+
+	return scans, nil
+}
+
+// Entry is a scan in the timeline of a domain.
+type Entry struct {
+	Time time.Time `json:"time"`
+
+	Score int    `json:"score,omitempty"`
+	Grade string `json:"grade,omitempty"`
+
+	// Counts are the number of findings by severity.
+	Counts map[plugins.Severity]int `json:"counts"`
+
+	// Changes are the changes since the previous scan, nil for the first
+	// scan.
+	Changes *diff.Domain `json:"changes,omitempty"`
+}
+
+// Timeline returns the timeline of the scans of a domain, a single entry per
+// scan.
+func Timeline(scans []*report.Domain) []Entry {
+	entries := []Entry{}
+
+	for i, d := range scans {
+		e := Entry{
+			Time:   d.Finished,
+			Counts: map[plugins.Severity]int{},
+		}
+
+		if d.Score != nil {
+			e.Score, e.Grade = d.Score.Score, d.Score.Grade
+		}
+
+		for _, issue := range d.Issues() {
+			if issue.Severity != plugins.SeverityDebug {
+				e.Counts[issue.Severity]++
+			}
+		}
+
+		if i > 0 {
+			changes := diff.Compare(single(scans[i-1]), single(d))
+			for _, dd := range changes.Domains {
+				if dd.Domain == d.Domain {
+					e.Changes = dd
+				}
+			}
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries
+}
+
+// single returns a report of the single domain d.
+func single(d *report.Domain) *report.Report {
+	return &report.Report{
+		Domains: []*report.Domain{d},
+	}
+}
+
+// Period is a stretch of consecutive scans of a domain reporting a finding.
+type Period struct {
+	Domain string `json:"domain"`
+	Plugin string `json:"plugin"`
+	ID     string `json:"id"`
+	Target string `json:"target"`
+
+	Severity plugins.Severity `json:"severity"`
+	Message  string           `json:"message"`
+
+	// First and Last are the first and last scan reporting the finding,
+	// Resolved the first scan after not reporting it, if any.
+	First    time.Time  `json:"first"`
+	Last     time.Time  `json:"last"`
+	Resolved *time.Time `json:"resolved,omitempty"`
+
+	Scans int `json:"scans"`
+}
+
+// Occurrences returns the periods the finding with ID id was reported in the
+// scans of a domain. Scans in which the check reporting it failed or didn't
+// run don't resolve it.
+func Occurrences(id string, scans []*report.Domain) []Period {
+	periods := []Period{}
+
+	// open periods by target
+	open := map[string]*Period{}
+
+	for _, d := range scans {
+		seen := map[string]bool{}
+
+		for _, issue := range d.Issues() {
+			if !strings.EqualFold(issue.ID, id) || seen[issue.Target] {
+				continue
+			}
+
+			seen[issue.Target] = true
+
+			p, ok := open[issue.Target]
+			if !ok {
+				p = &Period{
+					Domain: d.Domain,
+					Plugin: issue.Plugin,
+					ID:     issue.ID,
+					Target: issue.Target,
+					First:  d.Finished,
+				}
+
+				open[issue.Target] = p
+			}
+
+			p.Severity, p.Message = issue.Severity, issue.Message
+			p.Last = d.Finished
+			p.Scans++
+		}
+
+		for target, p := range open {
+			if seen[target] {
+				continue
+			}
+
+			if c := d.Check(p.Plugin); c == nil || c.Failed() {
+				continue
+			}
+
+			resolved := d.Finished
+			p.Resolved = &resolved
+
+			periods = append(periods, *p)
+			delete(open, target)
+		}
+	}
+
+	for _, p := range open {
+		periods = append(periods, *p)
+	}
+
+	sort.SliceStable(periods, func(i, j int) bool {
+		if !periods[i].First.Equal(periods[j].First) {
+			return periods[i].First.Before(periods[j].First)
+		}
+
+		return periods[i].Target < periods[j].Target
+	})
+
+	return periods
+}
@@ -0,0 +1,274 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+var epoch = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// scan returns a scan of example.com finished day days after epoch.
+func scan(day int, checks ...*report.Check) *report.Domain {
+	return &report.Domain{
+		Domain:   "example.com",
+		Finished: epoch.AddDate(0, 0, day),
+		Checks:   checks,
+	}
+}
+
+func check(plugin string, issues ...plugins.Issue) *report.Check {
+	return &report.Check{Plugin: plugin, Issues: issues}
+}
+
+func issue(id, target string, severity plugins.Severity) plugins.Issue {
+	return plugins.Issue{
+		ID:       id,
+		Plugin:   "DMARC",
+		Target:   target,
+		Severity: severity,
+		Message:  id + ".",
+	}
+}
+
+func timeout() plugins.Issue {
+	i := plugins.FindingTimeout.Issue("example.com", "Timed out.")
+	i.Plugin = "DMARC"
+	return i
+}
+
+func TestOccurrences(t *testing.T) {
+	missing := issue("DMARC-MISSING", "example.com", plugins.SeverityError)
+	ok := issue("DMARC-POLICY", "example.com", plugins.SeverityOK)
+
+	// period is first, last, resolved as days after epoch and the number of
+	// scans, resolved -1 when still open
+	type period [4]int
+
+	for _, tt := range []struct {
+		name     string
+		scans    []*report.Domain
+		expected []period
+	}{
+		{"never", []*report.Domain{
+			scan(0, check("DMARC", ok)),
+		}, []period{}},
+		{"open", []*report.Domain{
+			scan(0, check("DMARC", ok)),
+			scan(1, check("DMARC", missing)),
+			scan(2, check("DMARC", missing)),
+		}, []period{{1, 2, -1, 2}}},
+		{"resolved", []*report.Domain{
+			scan(0, check("DMARC", missing)),
+			scan(1, check("DMARC", missing)),
+			scan(2, check("DMARC", ok)),
+		}, []period{{0, 1, 2, 2}}},
+		{"reopened", []*report.Domain{
+			scan(0, check("DMARC", missing)),
+			scan(1, check("DMARC", ok)),
+			scan(2, check("DMARC", missing)),
+		}, []period{{0, 0, 1, 1}, {2, 2, -1, 1}}},
+		// failed checks and checks that didn't run don't resolve
+		{"failed", []*report.Domain{
+			scan(0, check("DMARC", missing)),
+			scan(1, check("DMARC", timeout())),
+			scan(2),
+			scan(3, check("DMARC", missing)),
+			scan(4, check("DMARC", ok)),
+		}, []period{{0, 3, 4, 2}}},
+	} {
+		periods := []period{}
+		for _, p := range Occurrences("dmarc-missing", tt.scans) {
+			resolved := -1
+			if p.Resolved != nil {
+				resolved = int(p.Resolved.Sub(epoch) / (24 * time.Hour))
+			}
+
+			periods = append(periods, period{
+				int(p.First.Sub(epoch) / (24 * time.Hour)),
+				int(p.Last.Sub(epoch) / (24 * time.Hour)),
+				resolved,
+				p.Scans,
+			})
+
+			if p.Domain != "example.com" || p.ID != "DMARC-MISSING" || p.Severity != plugins.SeverityError {
+				t.Errorf("%s: got period %+v, expected DMARC-MISSING of example.com", tt.name, p)
+			}
+		}
+
+		if !reflect.DeepEqual(periods, tt.expected) {
+			t.Errorf("%s: got periods %v, expected %v", tt.name, periods, tt.expected)
+		}
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	missing := issue("DMARC-MISSING", "example.com", plugins.SeverityError)
+	ok := issue("DMARC-POLICY", "example.com", plugins.SeverityOK)
+	debug := issue("DMARC-QUERY", "example.com", plugins.SeverityDebug)
+
+	scans := []*report.Domain{
+		scan(0, check("DMARC", missing, debug)),
+		scan(1, check("DMARC", missing, debug)),
+		scan(2, check("DMARC", ok)),
+	}
+	scans[2].Score = &report.Score{Score: 100, Grade: "A"}
+
+	entries := Timeline(scans)
+	if len(entries) != len(scans) {
+		t.Fatalf("got %d entries, expected %d", len(entries), len(scans))
+	}
+
+	for i, tt := range []struct {
+		counts   map[plugins.Severity]int
+		grade    string
+		changes  bool
+		new      int
+		resolved int
+	}{
+		{map[plugins.Severity]int{plugins.SeverityError: 1}, "", false, 0, 0},
+		{map[plugins.Severity]int{plugins.SeverityError: 1}, "", true, 0, 0},
+		{map[plugins.Severity]int{plugins.SeverityOK: 1}, "A", true, 1, 1},
+	} {
+		e := entries[i]
+
+		if !e.Time.Equal(scans[i].Finished) {
+			t.Errorf("entry %d: got time %s, expected %s", i, e.Time, scans[i].Finished)
+		}
+
+		if !reflect.DeepEqual(e.Counts, tt.counts) {
+			t.Errorf("entry %d: got counts %v, expected %v", i, e.Counts, tt.counts)
+		}
+
+		if e.Grade != tt.grade {
+			t.Errorf("entry %d: got grade %q, expected %q", i, e.Grade, tt.grade)
+		}
+
+		if (e.Changes != nil) != tt.changes {
+			t.Errorf("entry %d: got changes %v, expected changes %t", i, e.Changes, tt.changes)
+		} else if e.Changes != nil && (len(e.Changes.New) != tt.new || len(e.Changes.Resolved) != tt.resolved) {
+			t.Errorf("entry %d: got new %v and resolved %v, expected %d new and %d resolved", i, e.Changes.New, e.Changes.Resolved, tt.new, tt.resolved)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+
+	for _, tt := range []struct {
+		name      string
+		retention time.Duration
+		maxScans  int
+		// ages of the scans of the domains, in hours
+		domains  map[string][]int
+		expected map[string]int
+	}{
+		{"keep", 0, 0,
+			map[string][]int{"example.com": {3, 2, 1}},
+			map[string]int{"example.com": 3},
+		},
+		{"retention", 90 * time.Minute, 0,
+			map[string][]int{"example.com": {3, 2, 1}},
+			map[string]int{"example.com": 1},
+		},
+		{"max scans", 0, 2,
+			map[string][]int{"example.com": {3, 2, 1}, "example.org": {1}},
+			map[string]int{"example.com": 2, "example.org": 1},
+		},
+		// domains no longer scanned are removed
+		{"stale", 150 * time.Minute, 0,
+			map[string][]int{"example.com": {3, 2, 1}, "example.org": {4, 3}},
+			map[string]int{"example.com": 2},
+		},
+	} {
+		dir, err := ioutil.TempDir("", "history")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer os.RemoveAll(dir)
+
+		s, err := Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for domain, ages := range tt.domains {
+			for _, age := range ages {
+				d := &report.Domain{Domain: domain, Finished: now.Add(-time.Duration(age) * time.Hour)}
+				if err := s.Add("test", d); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		s.Retention, s.MaxScans = tt.retention, tt.maxScans
+
+		if err := s.Prune(); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+
+		scans := map[string]int{}
+
+		domains, err := s.Domains()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, domain := range domains {
+			paths, _, err := files(filepath.Join(dir, domain))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			scans[domain] = len(paths)
+		}
+
+		if !reflect.DeepEqual(scans, tt.expected) {
+			t.Errorf("%s: got scans %v, expected %v", tt.name, scans, tt.expected)
+		}
+	}
+}
+
+func TestAddPrunesAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	if err := s.Add("test", &report.Domain{Domain: "example.org", Finished: now.Add(-2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Retention = time.Hour
+
+	// not due yet, only the added domain is pruned
+	if err := s.Add("test", &report.Domain{Domain: "example.com", Finished: now}); err != nil {
+		t.Fatal(err)
+	} else if domains, _ := s.Domains(); len(domains) != 2 {
+		t.Errorf("got domains %v, expected example.org to be kept until the next prune", domains)
+	}
+
+	s.pruned = now.Add(-pruneInterval)
+
+	if err := s.Add("test", &report.Domain{Domain: "example.com", Finished: now.Add(time.Second)}); err != nil {
+		t.Fatal(err)
+	} else if domains, _ := s.Domains(); !reflect.DeepEqual(domains, []string{"example.com"}) {
+		t.Errorf("got domains %v, expected the expired scans of example.org to be removed", domains)
+	}
+}
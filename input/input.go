@@ -0,0 +1,250 @@
+// Package input reads the domains to check from lists and CSV files, like
+// the exports of an asset inventory.
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	dns "github.com/miekg/dns"
+	"github.com/op/go-logging"
+)
+
+var log = logging.MustGetLogger("check/input")
+
+// Formats of the input.
+const (
+	FormatAuto = "auto"
+	FormatList = "list"
+	FormatCSV  = "csv"
+)
+
+// Formats are the supported input formats.
+var Formats = []string{FormatAuto, FormatList, FormatCSV}
+
+// DefaultColumn is the default name of the CSV column holding the domains.
+const DefaultColumn = "domain"
+
+// Target is a domain to check, with the other columns of its CSV row.
+type Target struct {
+	Domain string
+
+	// Fields are the other columns of the CSV row, by header.
+	Fields map[string]string
+}
+
+// Normalize returns domain lower cased, without surrounding whitespace and
+// trailing dot.
+func Normalize(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// Valid returns whether the normalized domain is a valid host name.
+func Valid(domain string) bool {
+	if domain == "" {
+		return false
+	}
+
+	for _, label := range strings.Split(domain, ".") {
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+	}
+
+	for _, r := range domain {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+
+	_, ok := dns.IsDomainName(domain)
+	return ok
+}
+
+// Read reads the targets of r in format, the domains of CSV files from
+// column. Empty lines and lines starting with # are skipped, lines with an
+// invalid domain are logged and skipped. Auto reads CSV when the first line
+// holds a comma.
+func Read(r io.Reader, format string, column string) ([]Target, error) {
+	if column == "" {
+		column = DefaultColumn
+	}
+
+	br := bufio.NewReader(r)
+
+	switch format {
+	case FormatList:
+		return readList(br)
+	case FormatCSV:
+		return readCSV(br, column)
+	case FormatAuto, "":
+		head, isCSV, err := sniff(br, column)
+		if err != nil {
+			return nil, err
+		}
+
+		r := io.MultiReader(bytes.NewReader(head), br)
+		if isCSV {
+			return readCSV(r, column)
+		}
+
+		return readList(r)
+	}
+
+	return nil, fmt.Errorf("Unsupported input format: %s", format)
+}
+
+// sniff reads r up to and including the first line that isn't empty or a
+// comment, and returns what it read and whether that line holds a comma or
+// is column, as a header of a single column.
+func sniff(r *bufio.Reader, column string) ([]byte, bool, error) {
+	head := []byte{}
+
+	for {
+		line, err := r.ReadBytes('\n')
+		head = append(head, line...)
+
+		if text := strings.TrimSpace(string(line)); text != "" && !strings.HasPrefix(text, "#") {
+			return head, strings.Contains(text, ",") || strings.EqualFold(text, column), nil
+		}
+
+		if err == io.EOF {
+			return head, false, nil
+		} else if err != nil {
+			return nil, false, err
+		}
+	}
+}
+
+// index returns the index of column in header, ignoring case, or -1.
+func index(header []string, column string) int {
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(name), column) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// readList reads a domain per line, text after # is a comment.
+func readList(r io.Reader) ([]Target, error) {
+	targets := []Target{}
+
+	scanner := bufio.NewScanner(r)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i != -1 {
+			text = text[:i]
+		}
+
+		domain := Normalize(text)
+		if domain == "" {
+			continue
+		}
+
+		if !Valid(domain) {
+			log.Warningf("Skipping line %d, invalid domain: %s", line, strings.TrimSpace(text))
+			continue
+		}
+
+		targets = append(targets, Target{Domain: domain})
+	}
+
+	return targets, scanner.Err()
+}
+
+// readCSV reads a CSV file with a header row, the domains from column and
+// the other columns as fields.
+func readCSV(rd io.Reader, column string) ([]Target, error) {
+	r := csv.NewReader(rd)
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return []Target{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	col := index(header, column)
+	if col == -1 {
+		return nil, fmt.Errorf("No %s column in CSV header", column)
+	}
+
+	targets := []Target{}
+
+	for {
+		record, err := r.Read()
+
+		var pe *csv.ParseError
+		if err == io.EOF {
+			break
+		} else if errors.As(err, &pe) {
+			log.Warningf("Skipping line %d: %s", pe.StartLine, pe.Err.Error())
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		line, _ := r.FieldPos(0)
+
+		if col >= len(record) {
+			log.Warningf("Skipping line %d, missing %s column", line, column)
+			continue
+		}
+
+		domain := Normalize(record[col])
+		if domain == "" {
+			continue
+		}
+
+		if !Valid(domain) {
+			log.Warningf("Skipping line %d, invalid domain: %s", line, strings.TrimSpace(record[col]))
+			continue
+		}
+
+		fields := map[string]string{}
+		for i, value := range record {
+			if i == col || i >= len(header) {
+				continue
+			}
+
+			fields[strings.TrimSpace(header[i])] = value
+		}
+
+		targets = append(targets, Target{Domain: domain, Fields: fields})
+	}
+
+	return targets, nil
+}
+
+// Dedupe returns targets without duplicate domains, keeping the first.
+func Dedupe(targets []Target) []Target {
+	seen := map[string]bool{}
+
+	result := []Target{}
+	for _, t := range targets {
+		if seen[t.Domain] {
+			continue
+		}
+
+		seen[t.Domain] = true
+		result = append(result, t)
+	}
+
+	return result
+}
@@ -0,0 +1,123 @@
+package input
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	for _, tt := range []struct {
+		domain string
+		valid  bool
+	}{
+		{"example.com", true},
+		{"mail-1.example.com", true},
+		{"_dmarc.example.com", true},
+		{"xn--bcher-kva.example", true},
+		{"", false},
+		{"-example.com", false},
+		{"example-.com", false},
+		{"mail.-example.com", false},
+		{"example..com", false},
+		{"example.com,owner", false},
+		{"exam ple.com", false},
+		{strings.Repeat("a", 64) + ".com", false},
+	} {
+		if valid := Valid(tt.domain); valid != tt.valid {
+			t.Errorf("%q: got valid %t, expected %t", tt.domain, valid, tt.valid)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		format  string
+		column  string
+		input   string
+		targets []Target
+	}{
+		{
+			"list", FormatAuto, "",
+			"# inventory\n\nExample.com.\n  mail.example.com # mail\n-bad.example.com\nexample.org\n",
+			[]Target{{Domain: "example.com"}, {Domain: "mail.example.com"}, {Domain: "example.org"}},
+		},
+		{
+			"csv", FormatAuto, "",
+			"# export\nowner,Domain\nalice,example.com\nbob,bad-.example.com\ncarol\ndave,example.org\n",
+			[]Target{
+				{Domain: "example.com", Fields: map[string]string{"owner": "alice"}},
+				{Domain: "example.org", Fields: map[string]string{"owner": "dave"}},
+			},
+		},
+		{
+			"csv column", FormatAuto, "hostname",
+			"domain,hostname\nexample.com,mail.example.com\nexample.org,\"bad host\"\nexample.net,mx.example.net\n",
+			[]Target{
+				{Domain: "mail.example.com", Fields: map[string]string{"domain": "example.com"}},
+				{Domain: "mx.example.net", Fields: map[string]string{"domain": "example.net"}},
+			},
+		},
+		{
+			"csv single column", FormatAuto, "",
+			"domain\nexample.com\n",
+			[]Target{{Domain: "example.com", Fields: map[string]string{}}},
+		},
+		{
+			"csv parse error", FormatCSV, "",
+			"domain,owner\nexample.com,\"alice\nexample.org,bob\n",
+			[]Target{},
+		},
+		{
+			"forced list", FormatList, "",
+			"example.com\nexample.org,owner\n",
+			[]Target{{Domain: "example.com"}},
+		},
+		{
+			"empty", FormatAuto, "",
+			"# nothing\n",
+			[]Target{},
+		},
+	} {
+		targets, err := Read(strings.NewReader(tt.input), tt.format, tt.column)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		} else if !reflect.DeepEqual(targets, tt.targets) {
+			t.Errorf("%s: got %v, expected %v", tt.name, targets, tt.targets)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		input  string
+		err    string
+	}{
+		{FormatCSV, "owner,hostname\nalice,example.com\n", "No domain column in CSV header"},
+		{"xml", "<domains/>", "Unsupported input format: xml"},
+	} {
+		_, err := Read(strings.NewReader(tt.input), tt.format, "")
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%s: got error %v, expected %q", tt.format, err, tt.err)
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	targets := Dedupe([]Target{
+		{Domain: "example.com", Fields: map[string]string{"owner": "alice"}},
+		{Domain: "example.org"},
+		{Domain: "example.com", Fields: map[string]string{"owner": "bob"}},
+	})
+
+	expected := []Target{
+		{Domain: "example.com", Fields: map[string]string{"owner": "alice"}},
+		{Domain: "example.org"},
+	}
+
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("got %v, expected %v", targets, expected)
+	}
+}
@@ -1,8 +1,16 @@
 package main
 
-import "github.com/dutchcoders/checkmail/cmd"
+import (
+	"fmt"
+	"os"
+
+	"github.com/dutchcoders/checkmail/cmd"
+)
 
 func main() {
 	app := cmd.New()
-	app.RunAndExitOnError()
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(cmd.ExitFailed)
+	}
 }
@@ -0,0 +1,115 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"github.com/dutchcoders/checkmail/diff"
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// DiffFormats are the output formats supported for diffs.
+var DiffFormats = []string{"text", "json"}
+
+// WriteDiff writes d in format to w.
+func WriteDiff(format string, w io.Writer, d *diff.Diff) error {
+	switch format {
+	case "text":
+		return writeTextDiff(w, d)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+
+	return fmt.Errorf("Unsupported output format for diffs: %s", format)
+}
+
+func writeTextDiff(w io.Writer, d *diff.Diff) error {
+	changes := 0
+
+	for _, dd := range d.Domains {
+		if dd.Empty() {
+			continue
+		}
+
+		title := dd.Domain
+		if dd.Status != "" {
+			title = fmt.Sprintf("%s (%s)", dd.Domain, dd.Status)
+		}
+
+		fmt.Fprintf(w, "==== %s %s\n", title, strings.Repeat("=", rule(title)))
+
+		for _, c := range dd.New {
+			fmt.Fprintf(w, "[%s] %s\n", color.RedString("+"), textChange(c))
+		}
+
+		for _, c := range dd.Resolved {
+			fmt.Fprintf(w, "[%s] %s\n", color.GreenString("-"), textChange(c))
+		}
+
+		for _, c := range dd.Changed {
+			fmt.Fprintf(w, "[%s] %s\n", color.YellowString("~"), textChange(c))
+
+			for _, f := range c.Fields {
+				fmt.Fprintf(w, "        %s: %s -> %s\n", f.Name, f.Before, f.After)
+			}
+		}
+
+		if dd.Status == diff.StatusRemoved {
+			fmt.Fprintln(w, "")
+			continue
+		}
+
+		fmt.Fprintf(w, "%d new, %d resolved, %d changed\n\n", len(dd.New), len(dd.Resolved), len(dd.Changed))
+		changes += len(dd.New) + len(dd.Resolved) + len(dd.Changed)
+	}
+
+	if changes == 0 {
+		fmt.Fprintln(w, "No changes.")
+	}
+
+	return nil
+}
+
+func textChange(c diff.Change) string {
+	issue := c.Issue()
+	return fmt.Sprintf("[%s] %s %s: %s", issue.Plugin, issue.Severity, issue.ID, issue.Message)
+}
+
+// diffRenderer renders the changes of a run compared to a baseline, instead
+// of the run itself.
+type diffRenderer struct {
+	w        io.Writer
+	format   string
+	baseline *report.Report
+}
+
+// NewDiff returns a renderer writing the changes compared to baseline in
+// format.
+func NewDiff(format string, w io.Writer, baseline *report.Report) (Renderer, error) {
+	for _, f := range DiffFormats {
+		if f == format {
+			return &diffRenderer{w: w, format: format, baseline: baseline}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Unsupported output format for diffs: %s", format)
+}
+
+func (d *diffRenderer) Start(r *report.Report) error {
+	return nil
+}
+
+func (d *diffRenderer) Issue(domain string, plugin plugins.Plugin, issue plugins.Issue) error {
+	return nil
+}
+
+func (d *diffRenderer) Finish(r *report.Report) error {
+	return WriteDiff(d.format, d.w, diff.Compare(d.baseline, r))
+}
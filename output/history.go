@@ -0,0 +1,125 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"github.com/dutchcoders/checkmail/history"
+	"github.com/dutchcoders/checkmail/plugins"
+)
+
+// Timeline is the timeline of a single domain.
+type Timeline struct {
+	Domain  string          `json:"domain"`
+	Entries []history.Entry `json:"entries"`
+}
+
+// historyTime formats the times of the history.
+const historyTime = "2006-01-02 15:04:05"
+
+// WriteTimelines writes the timelines in format to w.
+func WriteTimelines(format string, w io.Writer, timelines []Timeline) error {
+	switch format {
+	case "text":
+		return writeTextTimelines(w, timelines)
+	case "json":
+		return writeJSON(w, timelines)
+	}
+
+	return fmt.Errorf("Unsupported output format for history: %s", format)
+}
+
+// WriteOccurrences writes the periods finding was reported in format to w.
+func WriteOccurrences(format string, w io.Writer, finding string, periods []history.Period) error {
+	switch format {
+	case "text":
+		return writeTextOccurrences(w, finding, periods)
+	case "json":
+		return writeJSON(w, periods)
+	}
+
+	return fmt.Errorf("Unsupported output format for history: %s", format)
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeTextTimelines(w io.Writer, timelines []Timeline) error {
+	for _, t := range timelines {
+		fmt.Fprintf(w, "==== %s %s\n", t.Domain, strings.Repeat("=", rule(t.Domain)))
+
+		if len(t.Entries) == 0 {
+			fmt.Fprintln(w, "No scans.")
+		}
+
+		for _, e := range t.Entries {
+			score := ""
+			if e.Grade != "" {
+				score = fmt.Sprintf("[%s] %d/100, ", grade(e.Grade), e.Score)
+			}
+
+			fmt.Fprintf(w, "%s %s%s, %s\n", e.Time.Local().Format(historyTime), score, plural(e.Counts[plugins.SeverityError], "error"), plural(e.Counts[plugins.SeverityWarning], "warning"))
+
+			if e.Changes == nil {
+				continue
+			}
+
+			for _, c := range e.Changes.New {
+				fmt.Fprintf(w, "    [%s] %s\n", color.RedString("+"), textChange(c))
+			}
+
+			for _, c := range e.Changes.Resolved {
+				fmt.Fprintf(w, "    [%s] %s\n", color.GreenString("-"), textChange(c))
+			}
+
+			for _, c := range e.Changes.Changed {
+				fmt.Fprintf(w, "    [%s] %s\n", color.YellowString("~"), textChange(c))
+
+				for _, f := range c.Fields {
+					fmt.Fprintf(w, "            %s: %s -> %s\n", f.Name, f.Before, f.After)
+				}
+			}
+		}
+
+		fmt.Fprintln(w, "")
+	}
+
+	return nil
+}
+
+func writeTextOccurrences(w io.Writer, finding string, periods []history.Period) error {
+	fmt.Fprintf(w, "==== %s %s\n", finding, strings.Repeat("=", rule(finding)))
+
+	if len(periods) == 0 {
+		fmt.Fprintln(w, "Not reported.")
+	}
+
+	for _, p := range periods {
+		fmt.Fprintf(w, "[%s] [%s] %s: %s\n", p.Domain, p.Target, p.Severity, p.Message)
+
+		state := color.RedString("still reported")
+		if p.Resolved != nil {
+			state = color.GreenString("resolved %s", p.Resolved.Local().Format(historyTime))
+		}
+
+		fmt.Fprintf(w, "        %s - %s, %s, %s\n", p.First.Local().Format(historyTime), p.Last.Local().Format(historyTime), plural(p.Scans, "scan"), state)
+	}
+
+	return nil
+}
+
+// plural formats a count of word, like "1 error" or "2 errors".
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+
+	return fmt.Sprintf("%d %ss", n, word)
+}
@@ -0,0 +1,179 @@
+package output
+
+import (
+	"html/template"
+	"io"
+	"sort"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// htmlRenderer writes the report as a single static HTML page, without any
+// external assets, with a summary table and a section per domain.
+type htmlRenderer struct {
+	w io.Writer
+}
+
+type htmlEvidence struct {
+	Key   string
+	Value string
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"evidence": func(issue plugins.Issue) []htmlEvidence {
+		keys := []string{}
+		for key := range issue.Evidence {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		evidence := []htmlEvidence{}
+		for _, key := range keys {
+			evidence = append(evidence, htmlEvidence{key, issue.Evidence[key]})
+		}
+
+		return evidence
+	},
+	"visible": func(issues []plugins.Issue) []plugins.Issue {
+		visible := []plugins.Issue{}
+		for _, issue := range issues {
+			if issue.Severity != plugins.SeverityDebug {
+				visible = append(visible, issue)
+			}
+		}
+
+		return visible
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>checkmail report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.6em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+.pass { background: #dff0d8; }
+.warn { background: #fcf8e3; }
+.fail { background: #f2dede; }
+.grade-A, .grade-B { background: #dff0d8; }
+.grade-C, .grade-D { background: #fcf8e3; }
+.grade-F { background: #f2dede; }
+.ERROR { color: #a94442; font-weight: bold; }
+.WARNING { color: #8a6d3b; font-weight: bold; }
+.OK { color: #3c763d; font-weight: bold; }
+.INFO { color: #31708f; }
+details { margin: 0.5em 0; }
+details > summary { cursor: pointer; font-weight: bold; }
+details details { margin-left: 1.5em; }
+.issue { margin: 0.5em 0 1em 1.5em; }
+.evidence td { font-family: monospace; font-size: 0.9em; word-break: break-all; }
+.meta { color: #666; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>checkmail report</h1>
+<p class="meta">Started {{ .Started.Format "2006-01-02 15:04:05 MST" }}, took {{ .Duration }}, checkmail {{ .Version }}.</p>
+
+<h2>Summary</h2>
+<table>
+<tr>
+<th>Domain</th>
+<th>Score</th>
+{{- if .Domains }}{{ range (index .Domains 0).Checks }}
+<th>{{ .Plugin }}</th>
+{{- end }}{{ end }}
+</tr>
+{{- range .Domains }}
+<tr>
+<td><a href="#{{ .Domain }}">{{ .Domain }}</a></td>
+<td class="grade-{{ with .Score }}{{ .Grade }}{{ end }}">{{ with .Score }}{{ .Score }} ({{ .Grade }}{{ if .Partial }}, partial{{ end }}){{ end }}</td>
+{{- range .Checks }}
+<td class="{{ .Status }}">{{ .Status }}</td>
+{{- end }}
+</tr>
+{{- end }}
+</table>
+
+<h2>Domains</h2>
+{{- range .Domains }}
+<details id="{{ .Domain }}">
+<summary>{{ .Domain }}</summary>
+<p class="meta">Took {{ .Duration }}.</p>
+{{- with .Score }}
+<p>Score <b>{{ .Score }}/100</b>, grade <b>{{ .Grade }}</b>{{ if .Partial }}, partial: checks that could not be completed are left out{{ end }}.</p>
+<table>
+{{- range .Categories }}
+<tr><th>{{ .Title }}</th><td>{{ .Score }}</td></tr>
+{{- end }}
+</table>
+{{- if .Costs }}
+<table>
+<tr><th>Points</th><th>Finding</th><th>Message</th></tr>
+{{- range .Costs }}
+<tr><td>-{{ printf "%.1f" .Points }}</td><td><code>{{ .ID }}</code></td><td>{{ .Message }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- end }}
+{{- range .Checks }}
+<details{{ if ne .Status "pass" }} open{{ end }}>
+<summary class="{{ .Status }}">{{ .Plugin }} ({{ .Status }})</summary>
+{{- range (visible .Issues) }}
+<div class="issue">
+<div><span class="{{ .Severity }}">{{ .Severity }}</span> <code>{{ .ID }}</code> {{ .Message }}</div>
+{{- if .Target }}
+<div class="meta">Target: {{ .Target }}</div>
+{{- end }}
+{{- with (evidence .) }}
+<table class="evidence">
+{{- range . }}
+<tr><th>{{ .Key }}</th><td>{{ .Value }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Description }}
+<div>{{ .Description }}</div>
+{{- end }}
+{{- if .Remediation }}
+<div><b>Remediation:</b> {{ .Remediation }}</div>
+{{- end }}
+{{- range .References }}
+<div class="meta"><a href="{{ . }}">{{ . }}</a></div>
+{{- end }}
+</div>
+{{- end }}
+</details>
+{{- end }}
+{{- with .Suppressed }}
+<details>
+<summary>Suppressed ({{ len . }})</summary>
+<table>
+<tr><th>Finding</th><th>Message</th><th>Justification</th><th>Expires</th></tr>
+{{- range . }}
+<tr><td><code>{{ .ID }}</code></td><td>{{ .Message }}</td><td>{{ .Justification }}</td><td>{{ .Expires.Format "2006-01-02" }}</td></tr>
+{{- end }}
+</table>
+</details>
+{{- end }}
+</details>
+{{- end }}
+</body>
+</html>
+`))
+
+func (h *htmlRenderer) Start(r *report.Report) error {
+	return nil
+}
+
+func (h *htmlRenderer) Issue(domain string, plugin plugins.Plugin, issue plugins.Issue) error {
+	return nil
+}
+
+func (h *htmlRenderer) Finish(r *report.Report) error {
+	return htmlTemplate.Execute(h.w, r)
+}
@@ -0,0 +1,44 @@
+package output
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	got := render(t, "html", testReport())
+
+	golden(t, "report.html", got)
+
+	page := string(got)
+
+	// markup in messages and justifications is escaped
+	for _, s := range []string{"<script>", "<the vendor>"} {
+		if strings.Contains(page, s) {
+			t.Errorf("got unescaped %q", s)
+		}
+	}
+
+	for _, s := range []string{"&lt;script&gt;alert(1)&lt;/script&gt;", "&lt;the vendor&gt;"} {
+		if !strings.Contains(page, s) {
+			t.Errorf("expected escaped %q", s)
+		}
+	}
+
+	// the page is self-contained: no scripts, stylesheets, images or
+	// fonts are loaded
+	external := regexp.MustCompile(`(?i)<script|<link|<img|<iframe|<object|\bsrc=|@import|url\(`)
+	if m := external.FindString(page); m != "" {
+		t.Errorf("got %q, expected no external assets", m)
+	}
+
+	// debug findings are left out, the timed out check fails
+	if strings.Contains(page, "SPF-DEBUG") {
+		t.Errorf("got a debug finding, expected it left out")
+	}
+
+	if !strings.Contains(page, `<summary class="fail">MX (fail)</summary>`) {
+		t.Errorf("expected the timed out check to fail")
+	}
+}
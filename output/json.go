@@ -0,0 +1,68 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// jsonRenderer writes the complete report as a single JSON document when the
+// run has finished.
+type jsonRenderer struct {
+	w io.Writer
+}
+
+func (j *jsonRenderer) Start(r *report.Report) error {
+	return nil
+}
+
+func (j *jsonRenderer) Issue(domain string, plugin plugins.Plugin, issue plugins.Issue) error {
+	return nil
+}
+
+func (j *jsonRenderer) Finish(r *report.Report) error {
+	enc := json.NewEncoder(j.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// ndjsonRenderer streams every issue as a JSON object on its own line, as
+// soon as it is reported.
+type ndjsonRenderer struct {
+	w io.Writer
+
+	// fields are the input fields by domain.
+	fields map[string]map[string]string
+}
+
+type ndjsonIssue struct {
+	Time   time.Time         `json:"time"`
+	Domain string            `json:"domain"`
+	Fields map[string]string `json:"fields,omitempty"`
+	plugins.Issue
+}
+
+func (n *ndjsonRenderer) Start(r *report.Report) error {
+	n.fields = map[string]map[string]string{}
+	for _, d := range r.Domains {
+		n.fields[d.Domain] = d.Fields
+	}
+
+	return nil
+}
+
+func (n *ndjsonRenderer) Issue(domain string, plugin plugins.Plugin, issue plugins.Issue) error {
+	return json.NewEncoder(n.w).Encode(ndjsonIssue{
+		Time:   time.Now().UTC(),
+		Domain: domain,
+		Fields: n.fields[domain],
+		Issue:  issue,
+	})
+}
+
+func (n *ndjsonRenderer) Finish(r *report.Report) error {
+	return nil
+}
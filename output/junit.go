@@ -0,0 +1,197 @@
+package output
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// junitRenderer writes the report as JUnit XML, with a testsuite per domain
+// and a testcase per plugin. Errors and warnings fail the testcase, checks
+// that could not be completed are testcases in error.
+type junitRenderer struct {
+	w io.Writer
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",cdata"`
+}
+
+func (j *junitRenderer) Start(r *report.Report) error {
+	return nil
+}
+
+func (j *junitRenderer) Issue(domain string, plugin plugins.Plugin, issue plugins.Issue) error {
+	return nil
+}
+
+func (j *junitRenderer) Finish(r *report.Report) error {
+	suites := junitTestSuites{
+		Name:   "checkmail",
+		Time:   seconds(r.Duration),
+		Suites: []junitTestSuite{},
+	}
+
+	for _, d := range r.Domains {
+		suite := junitTestSuite{
+			Name:      d.Domain,
+			Time:      seconds(d.Duration),
+			Timestamp: d.Started.UTC().Format("2006-01-02T15:04:05"),
+			Cases:     []junitTestCase{},
+		}
+
+		for _, c := range d.Checks {
+			tc := junitTestCase{
+				Name:      c.Plugin,
+				ClassName: d.Domain,
+				Time:      seconds(c.Duration),
+			}
+
+			failures := []plugins.Issue{}
+			body := []string{}
+			out := []string{}
+
+			for _, issue := range c.Issues {
+				switch issue.Severity {
+				case plugins.SeverityError, plugins.SeverityWarning:
+					failures = append(failures, issue)
+					body = append(body, junitIssue(issue))
+				case plugins.SeverityInfo:
+					out = append(out, junitIssue(issue))
+				}
+			}
+
+			for _, sup := range c.Suppressed {
+				out = append(out, fmt.Sprintf("suppressed until %s (%s): %s", sup.Expires.Format("2006-01-02"), sup.Justification, junitIssue(sup.Issue)))
+			}
+
+			if len(failures) > 0 {
+				message := failures[0].Message
+				if len(failures) > 1 {
+					message = fmt.Sprintf("%s (and %d more)", message, len(failures)-1)
+				}
+
+				failure := &junitFailure{
+					Message: message,
+					Type:    string(worst(failures)),
+					Body:    strings.Join(body, "\n"),
+				}
+
+				if c.Failed() {
+					tc.Error = failure
+					suite.Errors++
+				} else {
+					tc.Failure = failure
+					suite.Failures++
+				}
+			}
+
+			if len(out) > 0 {
+				tc.SystemOut = &junitOutput{strings.Join(out, "\n")}
+			}
+
+			suite.Cases = append(suite.Cases, tc)
+			suite.Tests++
+		}
+
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(j.w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(j.w)
+	enc.Indent("", "  ")
+
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(j.w, "\n")
+	return err
+}
+
+// junitIssue formats an issue with its evidence for a failure body or
+// system-out.
+func junitIssue(issue plugins.Issue) string {
+	lines := []string{
+		fmt.Sprintf("[%s] %s: %s", issue.Severity, issue.ID, issue.Message),
+	}
+
+	keys := []string{}
+	for key := range issue.Evidence {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("    %s: %s", key, issue.Evidence[key]))
+	}
+
+	if issue.Remediation != "" {
+		lines = append(lines, fmt.Sprintf("    remediation: %s", issue.Remediation))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// worst returns the most severe severity of the failing issues.
+func worst(issues []plugins.Issue) plugins.Severity {
+	for _, issue := range issues {
+		if issue.Severity == plugins.SeverityError {
+			return plugins.SeverityError
+		}
+	}
+
+	return plugins.SeverityWarning
+}
+
+func seconds(d report.Duration) string {
+	return fmt.Sprintf("%.3f", time.Duration(d).Seconds())
+}
@@ -0,0 +1,26 @@
+package output
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestJUnit(t *testing.T) {
+	got := render(t, "junit", testReport())
+
+	golden(t, "report.junit.xml", got)
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal(got, &suites); err != nil {
+		t.Fatal(err)
+	}
+
+	// the SPF warning and DMARC error fail, the MX timeout is an error
+	if suites.Tests != 3 || suites.Failures != 2 || suites.Errors != 1 {
+		t.Errorf("got %d tests, %d failures and %d errors, expected 3, 2 and 1", suites.Tests, suites.Failures, suites.Errors)
+	}
+
+	if tc := suites.Suites[0].Cases[2]; tc.Error == nil || tc.Failure != nil {
+		t.Errorf("got %+v, expected the timed out check in error", tc)
+	}
+}
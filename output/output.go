@@ -0,0 +1,71 @@
+// Package output renders the results of a checkmail run.
+package output
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+	"github.com/dutchcoders/checkmail/zone"
+)
+
+// Renderer renders a run. Start is called before the first check, Issue for
+// every issue of a check as soon as the check finished and Finish with the
+// complete report. Checks finish in any order, unless the renderer is
+// Ordered. Calls are never concurrent.
+type Renderer interface {
+	Start(r *report.Report) error
+	Issue(domain string, plugin plugins.Plugin, issue plugins.Issue) error
+	Finish(r *report.Report) error
+}
+
+// Formats are the supported output formats.
+var Formats = []string{"text", "json", "ndjson", "sarif", "junit", "html"}
+
+type OptionFn func(interface{})
+
+// Zones sets the zone files findings are located in, for renderers pointing
+// at the line defining a record.
+func Zones(idx *zone.Index) OptionFn {
+	return func(r interface{}) {
+		if s, ok := r.(*sarifRenderer); ok {
+			s.zones = idx
+		}
+	}
+}
+
+// Ordered returns whether r needs the issues in domain then plugin order,
+// like the text renderer printing a section per domain and plugin.
+func Ordered(r Renderer) bool {
+	_, ok := r.(*textRenderer)
+	return ok
+}
+
+// New returns the renderer for format, writing to w.
+func New(format string, w io.Writer, options ...OptionFn) (Renderer, error) {
+	var r Renderer
+
+	switch format {
+	case "text":
+		r = &textRenderer{w: w}
+	case "json":
+		r = &jsonRenderer{w: w}
+	case "ndjson":
+		r = &ndjsonRenderer{w: w}
+	case "sarif":
+		r = &sarifRenderer{w: w}
+	case "junit":
+		r = &junitRenderer{w: w}
+	case "html":
+		r = &htmlRenderer{w: w}
+	default:
+		return nil, fmt.Errorf("Unsupported output format: %s", format)
+	}
+
+	for _, fn := range options {
+		fn(r)
+	}
+
+	return r, nil
+}
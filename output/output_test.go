@@ -0,0 +1,143 @@
+package output
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// testReport returns a report of a single domain, with findings of every
+// severity, a suppressed finding, a check that timed out and markup in the
+// messages.
+func testReport() *report.Report {
+	started := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	second := report.Duration(time.Second)
+
+	spf := plugins.Finding{
+		ID:          "SPF-ALL-SOFTFAIL",
+		Severity:    plugins.SeverityWarning,
+		Remediation: "End the SPF record with \"-all\".",
+		References:  []string{"https://tools.ietf.org/html/rfc7208#section-5.1"},
+	}
+
+	return &report.Report{
+		Version:  "test",
+		Started:  started,
+		Finished: started.Add(3 * time.Second),
+		Duration: 3 * second,
+		Domains: []*report.Domain{
+			{
+				Domain:   "example.com",
+				Started:  started,
+				Finished: started.Add(3 * time.Second),
+				Duration: 3 * second,
+				Score: &report.Score{
+					Score:   62,
+					Grade:   "C",
+					Partial: true,
+					Categories: []report.CategoryScore{
+						{Category: plugins.CategoryAuthentication, Title: "Authentication", Score: 62, Weight: 1},
+					},
+					Costs: []report.Cost{
+						{ID: "DMARC-MISSING", Message: "No DMARC record at _dmarc.example.com", Points: 30},
+					},
+				},
+				Checks: []*report.Check{
+					{
+						Plugin:   "SPF",
+						Key:      "spf",
+						Category: plugins.CategoryAuthentication,
+						Started:  started,
+						Finished: started.Add(time.Second),
+						Duration: second,
+						Issues: []plugins.Issue{
+							plugins.Finding{ID: "SPF-RECORD", Severity: plugins.SeverityInfo}.Issue("example.com", "v=spf1 mx ~all").
+								With("name", "example.com.").With("type", "TXT").With("record", "v=spf1 mx ~all"),
+							spf.Issue("example.com", "SPF record ends with ~all").
+								With("name", "example.com.").With("type", "TXT").With("record", "v=spf1 mx ~all"),
+							plugins.Finding{ID: "SPF-DEBUG", Severity: plugins.SeverityDebug}.Issue("example.com", "Not rendered."),
+						},
+					},
+					{
+						Plugin:   "DMARC",
+						Key:      "dmarc",
+						Category: plugins.CategoryAuthentication,
+						Started:  started,
+						Finished: started.Add(time.Second),
+						Duration: second,
+						Issues: []plugins.Issue{
+							plugins.Finding{ID: "DMARC-MISSING", Severity: plugins.SeverityError}.Issue("_dmarc.example.com", `No DMARC record at _dmarc.example.com, found "<script>alert(1)</script>" & more`),
+						},
+						Suppressed: []report.Suppressed{
+							{
+								Issue:         plugins.Finding{ID: "DMARC-RUA", Severity: plugins.SeverityWarning}.Issue("_dmarc.example.com", "No aggregate reports requested."),
+								Justification: "Reports go to <the vendor>",
+								Expires:       time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+							},
+						},
+					},
+					{
+						Plugin:   "MX",
+						Key:      "mx",
+						Category: plugins.CategoryTransport,
+						Started:  started,
+						Finished: started.Add(3 * time.Second),
+						Duration: 3 * second,
+						Issues: []plugins.Issue{
+							plugins.FindingTimeout.Issue("example.com", "Check timed out after 3s."),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// golden compares got with the golden file name in testdata, or updates it
+// when -update is given.
+func golden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", name)
+
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, expected) {
+		t.Errorf("output does not match %s, got:\n%s", path, got)
+	}
+}
+
+// render renders r in format.
+func render(t *testing.T, format string, r *report.Report, options ...OptionFn) []byte {
+	var buf bytes.Buffer
+
+	renderer, err := New(format, &buf, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := renderer.Start(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := renderer.Finish(r); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,280 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	dns "github.com/miekg/dns"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+	"github.com/dutchcoders/checkmail/zone"
+)
+
+// sarifRenderer writes the report as SARIF 2.1.0 log, with a rule per
+// plugin, for code scanning dashboards.
+type sarifRenderer struct {
+	w io.Writer
+
+	zones *zone.Index
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string                 `json:"id"`
+	Name             string                 `json:"name"`
+	ShortDescription sarifMessage           `json:"shortDescription"`
+	Properties       map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string                 `json:"ruleId"`
+	RuleIndex           int                    `json:"ruleIndex"`
+	Level               string                 `json:"level"`
+	Message             sarifMessage           `json:"message"`
+	Locations           []sarifLocation        `json:"locations"`
+	PartialFingerprints map[string]string      `json:"partialFingerprints"`
+	Suppressions        []sarifSuppression     `json:"suppressions,omitempty"`
+	Properties          map[string]interface{} `json:"properties"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// sarifLevels maps severities to SARIF levels, debug issues are left out.
+var sarifLevels = map[plugins.Severity]string{
+	plugins.SeverityError:   "error",
+	plugins.SeverityWarning: "warning",
+	plugins.SeverityInfo:    "note",
+	plugins.SeverityOK:      "none",
+}
+
+func (s *sarifRenderer) Start(r *report.Report) error {
+	return nil
+}
+
+func (s *sarifRenderer) Issue(domain string, plugin plugins.Plugin, issue plugins.Issue) error {
+	return nil
+}
+
+func (s *sarifRenderer) Finish(r *report.Report) error {
+	available := map[string]plugins.Plugin{}
+	for _, fn := range plugins.Plugins {
+		p := fn()
+		available[p.Name()] = p
+	}
+
+	rules := []sarifRule{}
+	index := map[string]int{}
+
+	results := []sarifResult{}
+
+	for _, d := range r.Domains {
+		for _, c := range d.Checks {
+			if _, ok := index[c.Plugin]; !ok {
+				rule := sarifRule{
+					ID:   c.Key,
+					Name: c.Plugin,
+					Properties: map[string]interface{}{
+						"category": c.Category,
+					},
+				}
+
+				if p, ok := available[c.Plugin]; ok {
+					rule.ShortDescription.Text = p.Description()
+				}
+
+				index[c.Plugin] = len(rules)
+				rules = append(rules, rule)
+			}
+
+			for _, issue := range c.Issues {
+				if result, ok := s.result(d.Domain, c, index[c.Plugin], issue); ok {
+					results = append(results, result)
+				}
+			}
+
+			// suppressed findings are kept, marked as suppressed externally
+			for _, sup := range c.Suppressed {
+				if result, ok := s.result(d.Domain, c, index[c.Plugin], sup.Issue); ok {
+					result.Suppressions = []sarifSuppression{
+						{
+							Kind:          "external",
+							Justification: sup.Justification,
+						},
+					}
+
+					results = append(results, result)
+				}
+			}
+		}
+	}
+
+	enc := json.NewEncoder(s.w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{
+			{
+				Tool: sarifTool{
+					Driver: sarifDriver{
+						Name:           "checkmail",
+						Version:        r.Version,
+						InformationURI: "https://github.com/dutchcoders/checkmail",
+						Rules:          rules,
+					},
+				},
+				Results: results,
+			},
+		},
+	})
+}
+
+// result returns the result of issue, false for issues without SARIF level.
+func (s *sarifRenderer) result(domain string, c *report.Check, rule int, issue plugins.Issue) (sarifResult, bool) {
+	level, ok := sarifLevels[issue.Severity]
+	if !ok {
+		return sarifResult{}, false
+	}
+
+	return sarifResult{
+		RuleID:    c.Key,
+		RuleIndex: rule,
+		Level:     level,
+		Message:   sarifMessage{issue.Message},
+		Locations: []sarifLocation{s.location(domain, issue)},
+		PartialFingerprints: map[string]string{
+			"checkmail/v1": fmt.Sprintf("%s/%s/%s/%s", domain, c.Key, issue.ID, issue.Target),
+		},
+		Properties: s.properties(domain, issue),
+	}, true
+}
+
+// location returns the record of the issue as logical location, like
+// "_dmarc.example.com TXT", and the zone file line defining it if known.
+func (s *sarifRenderer) location(domain string, issue plugins.Issue) sarifLocation {
+	name, typ := issue.Evidence["name"], issue.Evidence["type"]
+	if name == "" {
+		target := issue.Target
+		if target == "" {
+			target = domain
+		}
+
+		return sarifLocation{
+			LogicalLocations: []sarifLogicalLocation{
+				{
+					Name:               target,
+					FullyQualifiedName: target,
+					Kind:               "resource",
+				},
+			},
+		}
+	}
+
+	loc := sarifLocation{
+		LogicalLocations: []sarifLogicalLocation{
+			{
+				Name:               fmt.Sprintf("%s %s", strings.TrimSuffix(name, "."), typ),
+				FullyQualifiedName: fmt.Sprintf("%s %s", dns.Fqdn(name), typ),
+				Kind:               "resource",
+			},
+		},
+	}
+
+	// only issues about a record present in the zone can point at its line
+	record := issue.Evidence["record"]
+	if s.zones == nil || record == "" {
+		return loc
+	}
+
+	if l, ok := s.zones.Locate(name, dns.StringToType[typ], record); ok {
+		loc.PhysicalLocation = &sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: l.File},
+			Region:           sarifRegion{StartLine: l.Line},
+		}
+	}
+
+	return loc
+}
+
+func (s *sarifRenderer) properties(domain string, issue plugins.Issue) map[string]interface{} {
+	properties := map[string]interface{}{
+		"domain":   domain,
+		"finding":  issue.ID,
+		"severity": issue.Severity,
+		"target":   issue.Target,
+	}
+
+	if issue.Description != "" {
+		properties["description"] = issue.Description
+	}
+
+	if issue.Remediation != "" {
+		properties["remediation"] = issue.Remediation
+	}
+
+	if len(issue.References) > 0 {
+		properties["references"] = issue.References
+	}
+
+	if len(issue.Evidence) > 0 {
+		properties["evidence"] = issue.Evidence
+	}
+
+	return properties
+}
@@ -0,0 +1,93 @@
+package output
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/dutchcoders/checkmail/zone"
+)
+
+func TestSARIF(t *testing.T) {
+	idx := zone.NewIndex()
+	if err := idx.Load("testdata/example.com.zone", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	got := render(t, "sarif", testReport(), Zones(idx))
+
+	golden(t, "report.sarif", got)
+
+	var log sarifLog
+	if err := json.Unmarshal(got, &log); err != nil {
+		t.Fatal(err)
+	}
+
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("got version %s with %d runs, expected a single 2.1.0 run", log.Version, len(log.Runs))
+	}
+
+	run := log.Runs[0]
+
+	rules := []string{}
+	for _, rule := range run.Tool.Driver.Rules {
+		rules = append(rules, rule.ID)
+	}
+
+	if len(rules) != 3 || rules[0] != "spf" || rules[1] != "dmarc" || rules[2] != "mx" {
+		t.Errorf("got rules %v, expected a rule per plugin", rules)
+	}
+
+	for _, tt := range []struct {
+		finding    string
+		rule       int
+		level      string
+		logical    string
+		file       string
+		line       int
+		suppressed bool
+	}{
+		// records present in the zone point at their line
+		{"SPF-RECORD", 0, "note", "example.com TXT", "testdata/example.com.zone", 6, false},
+		{"SPF-ALL-SOFTFAIL", 0, "warning", "example.com TXT", "testdata/example.com.zone", 6, false},
+		// missing records only have the target as logical location
+		{"DMARC-MISSING", 1, "error", "_dmarc.example.com", "", 0, false},
+		{"DMARC-RUA", 1, "warning", "_dmarc.example.com", "", 0, true},
+		{"CHECK-TIMEOUT", 2, "error", "example.com", "", 0, false},
+	} {
+		var result *sarifResult
+		for i := range run.Results {
+			if run.Results[i].Properties["finding"] == tt.finding {
+				result = &run.Results[i]
+			}
+		}
+
+		if result == nil {
+			t.Errorf("%s: no result", tt.finding)
+			continue
+		}
+
+		if result.RuleIndex != tt.rule || result.Level != tt.level {
+			t.Errorf("%s: got rule %d level %s, expected %d and %s", tt.finding, result.RuleIndex, result.Level, tt.rule, tt.level)
+		}
+
+		loc := result.Locations[0]
+		if loc.LogicalLocations[0].Name != tt.logical {
+			t.Errorf("%s: got logical location %s, expected %s", tt.finding, loc.LogicalLocations[0].Name, tt.logical)
+		}
+
+		if tt.file == "" && loc.PhysicalLocation != nil {
+			t.Errorf("%s: got physical location %+v, expected none", tt.finding, loc.PhysicalLocation)
+		} else if tt.file != "" && (loc.PhysicalLocation == nil || loc.PhysicalLocation.ArtifactLocation.URI != tt.file || loc.PhysicalLocation.Region.StartLine != tt.line) {
+			t.Errorf("%s: got physical location %+v, expected %s:%d", tt.finding, loc.PhysicalLocation, tt.file, tt.line)
+		}
+
+		if suppressed := len(result.Suppressions) > 0; suppressed != tt.suppressed {
+			t.Errorf("%s: got suppressed %t, expected %t", tt.finding, suppressed, tt.suppressed)
+		}
+	}
+
+	// debug findings are left out
+	if n := len(run.Results); n != 5 {
+		t.Errorf("got %d results, expected 5", n)
+	}
+}
@@ -0,0 +1,67 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/dutchcoders/checkmail/batch"
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// WriteSummary writes the summary of a scan in format to w.
+func WriteSummary(format string, w io.Writer, s *batch.Summary) error {
+	switch format {
+	case "text":
+		return writeTextSummary(w, s)
+	case "json":
+		return writeJSON(w, s)
+	}
+
+	return fmt.Errorf("Unsupported output format for summary: %s", format)
+}
+
+func writeTextSummary(w io.Writer, s *batch.Summary) error {
+	fmt.Fprintf(w, "==== Summary %s\n", strings.Repeat("=", rule("Summary")))
+
+	duration := s.Finished.Sub(s.Started).Round(time.Second)
+	fmt.Fprintf(w, "%s, %s failed, in %s\n", plural(s.Domains, "domain"), color.RedString("%d", s.Failed), duration)
+
+	if s.Domains == 0 {
+		return nil
+	}
+
+	grades := []string{}
+	for _, g := range []string{"A", "B", "C", "D", "F"} {
+		grades = append(grades, fmt.Sprintf("[%s] %d", grade(g), s.Grades[g]))
+	}
+
+	fmt.Fprintf(w, "%s, %.1f/100 on average\n", strings.Join(grades, " "), s.Score)
+	fmt.Fprintf(w, "%s, %s\n", plural(s.Findings[plugins.SeverityError], "error"), plural(s.Findings[plugins.SeverityWarning], "warning"))
+
+	fmt.Fprintf(w, "---- Checks %s\n", strings.Repeat("-", rule("Checks")))
+
+	for _, c := range s.Checks {
+		fmt.Fprintf(w, "%-20s %s %d  %s %d  %s %d  failed %d\n", c.Plugin,
+			color.GreenString("pass"), c.Status[report.StatusPass],
+			color.YellowString("warn"), c.Status[report.StatusWarn],
+			color.RedString("fail"), c.Status[report.StatusFail],
+			c.Failed)
+	}
+
+	if len(s.Top) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "---- Top findings %s\n", strings.Repeat("-", rule("Top findings")))
+
+	for _, f := range s.Top {
+		fmt.Fprintf(w, "%7d [%s] %s (%s)\n", f.Domains, f.Severity, f.ID, f.Plugin)
+	}
+
+	return nil
+}
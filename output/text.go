@@ -0,0 +1,147 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// textRenderer prints issues for the terminal as they are reported, in a
+// section per domain and plugin. It relies on the issues being passed in
+// domain then plugin order, see Ordered.
+type textRenderer struct {
+	w io.Writer
+
+	domain string
+	plugin string
+}
+
+func (t *textRenderer) Start(r *report.Report) error {
+	fmt.Fprintln(t.w, "Check Email")
+	fmt.Fprintln(t.w, "Verify configuration of domain and email settings.")
+	fmt.Fprintln(t.w, "by DutchSec")
+	fmt.Fprintln(t.w, "----------------")
+	return nil
+}
+
+func (t *textRenderer) Issue(domain string, plugin plugins.Plugin, issue plugins.Issue) error {
+	if domain != t.domain {
+		if t.domain != "" {
+			fmt.Fprintln(t.w, "")
+		}
+
+		fmt.Fprintf(t.w, "==== %s %s\n", domain, strings.Repeat("=", rule(domain)))
+		t.domain = domain
+		t.plugin = ""
+	}
+
+	if name := plugin.Name(); name != t.plugin {
+		fmt.Fprintf(t.w, "---- %s %s\n", name, strings.Repeat("-", rule(name)))
+		t.plugin = name
+	}
+
+	switch issue.Severity {
+	case plugins.SeverityError:
+		fmt.Fprintf(t.w, "[%s] [%s] %s \n", color.RedString("!!"), domain, issue.Message)
+	case plugins.SeverityWarning:
+		fmt.Fprintf(t.w, "[%s] [%s] %s \n", color.RedString("! "), domain, issue.Message)
+	case plugins.SeverityOK:
+		fmt.Fprintf(t.w, "[%s] [%s] %s \n", color.GreenString("OK"), domain, issue.Message)
+	case plugins.SeverityInfo:
+		fmt.Fprintf(t.w, "[%s] [%s] %s \n", "  ", domain, issue.Message)
+	}
+
+	return nil
+}
+
+// textCosts is the number of most expensive findings shown per score.
+const textCosts = 3
+
+func (t *textRenderer) Finish(r *report.Report) error {
+	if t.domain != "" {
+		fmt.Fprintln(t.w, "")
+	}
+
+	suppressed := false
+
+	for _, d := range r.Domains {
+		for _, c := range d.Checks {
+			for _, s := range c.Suppressed {
+				if !suppressed {
+					fmt.Fprintf(t.w, "==== Suppressed %s\n", strings.Repeat("=", rule("Suppressed")))
+					suppressed = true
+				}
+
+				fmt.Fprintf(t.w, "[%s] [%s] %s \n", "--", d.Domain, s.Message)
+				fmt.Fprintf(t.w, "       until %s: %s\n", s.Expires.Format("2006-01-02"), s.Justification)
+			}
+		}
+	}
+
+	if suppressed {
+		fmt.Fprintln(t.w, "")
+	}
+
+	if r.Scored() {
+		fmt.Fprintf(t.w, "==== Score %s\n", strings.Repeat("=", rule("Score")))
+
+		for _, d := range r.Domains {
+			s := d.Score
+			if s == nil {
+				fmt.Fprintf(t.w, "[%s] [%s] not scored, checks could not be completed\n", "  ", d.Domain)
+				continue
+			}
+
+			categories := []string{}
+			for _, c := range s.Categories {
+				categories = append(categories, fmt.Sprintf("%s %d", c.Title, c.Score))
+			}
+
+			partial := ""
+			if s.Partial {
+				partial = " (partial, failed checks left out)"
+			}
+
+			fmt.Fprintf(t.w, "[%s] [%s] %d/100%s %s\n", grade(s.Grade), d.Domain, s.Score, partial, strings.Join(categories, ", "))
+
+			for i, cost := range s.Costs {
+				if i == textCosts {
+					break
+				}
+
+				fmt.Fprintf(t.w, "       -%.1f %s: %s\n", cost.Points, cost.ID, cost.Message)
+			}
+		}
+
+		fmt.Fprintln(t.w, "")
+	}
+
+	fmt.Fprintln(t.w, "--------")
+	return nil
+}
+
+// rule returns the length of the rule following title in a section header.
+func rule(title string) int {
+	if len(title) > 80 {
+		return 0
+	}
+
+	return 80 - len(title)
+}
+
+// grade colors a letter grade.
+func grade(g string) string {
+	switch g {
+	case "A", "B":
+		return color.GreenString("%s ", g)
+	case "C", "D":
+		return color.YellowString("%s ", g)
+	}
+
+	return color.RedString("%s ", g)
+}
@@ -0,0 +1,264 @@
+package plugins
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	dns "github.com/miekg/dns"
+)
+
+const (
+	// maxCacheTTL caps the time answers are cached, whatever their TTL.
+	maxCacheTTL = 24 * time.Hour
+
+	// maxCacheEntries bounds the number of cached answers.
+	maxCacheEntries = 100000
+
+	// sweepInterval is the interval between sweeps of expired entries.
+	sweepInterval = time.Minute
+)
+
+type cacheKey struct {
+	name  string
+	qtype uint16
+}
+
+type cacheEntry struct {
+	msg     *dns.Msg
+	stored  time.Time
+	expires time.Time
+}
+
+// cache is an in memory cache of answers, respecting the TTLs of the answer.
+// Negative answers (NXDOMAIN and NODATA) are cached for the TTL of the SOA
+// record in the authority section, as described in RFC 2308. Expired answers
+// are swept every sweepInterval, and once size answers are cached an
+// arbitrary answer makes room for a new one.
+type cache struct {
+	m       sync.Mutex
+	entries map[cacheKey]cacheEntry
+	size    int
+	swept   time.Time
+}
+
+func newCache(size int) *cache {
+	return &cache{
+		entries: map[cacheKey]cacheEntry{},
+		size:    size,
+		swept:   time.Now(),
+	}
+}
+
+// Get returns a copy of the cached answer with TTLs decreased by the time
+// spent in the cache, or nil.
+func (c *cache) Get(name string, qtype uint16) *dns.Msg {
+	key := cacheKey{strings.ToLower(name), qtype}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	if !now.Before(entry.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+
+	msg := entry.msg.Copy()
+
+	elapsed := uint32(now.Sub(entry.stored) / time.Second)
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+
+			if rr.Header().Ttl > elapsed {
+				rr.Header().Ttl -= elapsed
+			} else {
+				rr.Header().Ttl = 0
+			}
+		}
+	}
+
+	return msg
+}
+
+// Set caches msg, if it is cacheable.
+func (c *cache) Set(msg *dns.Msg) {
+	if len(msg.Question) != 1 || msg.Truncated {
+		return
+	}
+
+	ttl, ok := cacheTTL(msg)
+	if !ok || ttl <= 0 {
+		return
+	}
+
+	if ttl > maxCacheTTL {
+		ttl = maxCacheTTL
+	}
+
+	q := msg.Question[0]
+
+	now := time.Now()
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.sweep(now)
+
+	key := cacheKey{strings.ToLower(q.Name), q.Qtype}
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+
+	c.entries[key] = cacheEntry{
+		msg:     msg.Copy(),
+		stored:  now,
+		expires: now.Add(ttl),
+	}
+}
+
+// sweep removes the expired answers, at most once every sweepInterval. The
+// lock has to be held.
+func (c *cache) sweep(now time.Time) {
+	if now.Sub(c.swept) < sweepInterval {
+		return
+	}
+
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+
+	c.swept = now
+}
+
+// Len returns the number of cached answers, including expired answers not
+// swept yet.
+func (c *cache) Len() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return len(c.entries)
+}
+
+// cacheTTL returns how long msg can be cached.
+func cacheTTL(msg *dns.Msg) (time.Duration, bool) {
+	switch {
+	case msg.Rcode == dns.RcodeSuccess && len(msg.Answer) > 0:
+		ttl := msg.Answer[0].Header().Ttl
+		for _, rr := range msg.Answer {
+			if rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+			}
+		}
+
+		return time.Duration(ttl) * time.Second, true
+	case msg.Rcode == dns.RcodeSuccess, msg.Rcode == dns.RcodeNameError:
+		// RFC 2308 section 5, negative answers are cached for the
+		// minimum of the SOA TTL and the SOA MINIMUM field.
+		for _, rr := range msg.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttl := soa.Hdr.Ttl
+				if soa.Minttl < ttl {
+					ttl = soa.Minttl
+				}
+
+				return time.Duration(ttl) * time.Second, true
+			}
+		}
+
+		// without SOA negative answers should not be cached
+		return 0, false
+	}
+
+	return 0, false
+}
+
+// flights shares the lookups in flight between concurrent lookups of the same
+// question, so the question is sent once.
+type flights struct {
+	m     sync.Mutex
+	calls map[cacheKey]*flight
+}
+
+type flight struct {
+	done chan struct{}
+
+	msg *dns.Msg
+	err error
+
+	// aborted is set when the context of the lookup was done
+	aborted bool
+}
+
+func newFlights() *flights {
+	return &flights{
+		calls: map[cacheKey]*flight{},
+	}
+}
+
+// Do looks up the question with fn, or waits for the lookup of the question
+// in flight. Every caller gets its own copy of the answer. When the lookup in
+// flight is aborted because its context is done, the waiting callers look up
+// the question themselves.
+func (f *flights) Do(ctx context.Context, name string, qtype uint16, fn func() (*dns.Msg, error)) (*dns.Msg, error) {
+	key := cacheKey{strings.ToLower(name), qtype}
+
+	for {
+		f.m.Lock()
+
+		if fl, ok := f.calls[key]; ok {
+			f.m.Unlock()
+
+			select {
+			case <-fl.done:
+			case <-ctx.Done():
+				return nil, lookupError(name, qtype, nil, ctx.Err())
+			}
+
+			if fl.aborted {
+				continue
+			}
+
+			return fl.result()
+		}
+
+		fl := &flight{done: make(chan struct{})}
+		f.calls[key] = fl
+
+		f.m.Unlock()
+
+		fl.msg, fl.err = fn()
+		fl.aborted = ctx.Err() != nil
+
+		f.m.Lock()
+		delete(f.calls, key)
+		f.m.Unlock()
+
+		close(fl.done)
+
+		return fl.result()
+	}
+}
+
+func (fl *flight) result() (*dns.Msg, error) {
+	if fl.msg == nil {
+		return nil, fl.err
+	}
+
+	return fl.msg.Copy(), fl.err
+}
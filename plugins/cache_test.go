@@ -0,0 +1,149 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dns "github.com/miekg/dns"
+)
+
+func answer(name string, ttl uint32) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), dns.TypeA)
+	m.Response = true
+	m.Answer = append(m.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: dns.Fqdn(name), Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+	})
+
+	return m
+}
+
+func TestCacheSize(t *testing.T) {
+	c := newCache(2)
+
+	for i := 0; i < 5; i++ {
+		c.Set(answer(fmt.Sprintf("%d.example.com", i), 300))
+	}
+
+	if n := c.Len(); n != 2 {
+		t.Errorf("got %d cached answers, expected 2", n)
+	}
+
+	if c.Get("4.example.com.", dns.TypeA) == nil {
+		t.Errorf("expected the last answer to be cached")
+	}
+}
+
+func TestCacheSweep(t *testing.T) {
+	c := newCache(maxCacheEntries)
+
+	c.Set(answer("old.example.com", 300))
+
+	// expire the answer, and let a sweep be due
+	c.entries[cacheKey{"old.example.com.", dns.TypeA}] = cacheEntry{
+		msg:     answer("old.example.com", 300),
+		expires: time.Now().Add(-time.Second),
+	}
+	c.swept = time.Now().Add(-sweepInterval)
+
+	c.Set(answer("new.example.com", 300))
+
+	if n := c.Len(); n != 1 {
+		t.Errorf("got %d cached answers, expected the expired answer to be swept", n)
+	}
+}
+
+// countingUpstream answers every question after release is closed, or aborts
+// when the context is done.
+type countingUpstream struct {
+	exchanges int32
+	release   chan struct{}
+}
+
+func (u *countingUpstream) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	atomic.AddInt32(&u.exchanges, 1)
+
+	select {
+	case <-u.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return answer(m.Question[0].Name, 300), nil
+}
+
+func (u *countingUpstream) String() string {
+	return "counting"
+}
+
+func TestResolverSharesLookupsInFlight(t *testing.T) {
+	u := &countingUpstream{release: make(chan struct{})}
+
+	res := newResolver()
+	res.upstreams = []upstream{u}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if msg, err := res.Resolve(context.Background(), "example.com.", dns.TypeA); err != nil || len(msg.Answer) != 1 {
+				t.Errorf("got %v %v, expected an answer", msg, err)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(u.release)
+
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&u.exchanges); n != 1 {
+		t.Errorf("got %d exchanges, expected the question to be sent once", n)
+	}
+}
+
+func TestResolverRetriesAbortedLookupInFlight(t *testing.T) {
+	u := &countingUpstream{release: make(chan struct{})}
+
+	res := newResolver()
+	res.upstreams = []upstream{u}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	aborted := make(chan error)
+	go func() {
+		_, err := res.Resolve(ctx, "example.com.", dns.TypeA)
+		aborted <- err
+	}()
+
+	for atomic.LoadInt32(&u.exchanges) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	answered := make(chan error)
+	go func() {
+		_, err := res.Resolve(context.Background(), "example.com.", dns.TypeA)
+		answered <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if err := <-aborted; err == nil {
+		t.Errorf("expected the canceled lookup to fail")
+	}
+
+	close(u.release)
+
+	if err := <-answered; err != nil {
+		t.Errorf("got %s, expected the waiting lookup to get an answer", err)
+	}
+}
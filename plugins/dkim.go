@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 	"github.com/miekg/dns"
 	"strings"
@@ -10,56 +11,93 @@ var (
 	_ = Register(DKIMPlugin)
 )
 
+var (
+	dkimSelectorFound = Finding{
+		ID:         "DKIM-SELECTOR-FOUND",
+		Severity:   SeverityInfo,
+		References: []string{"https://tools.ietf.org/html/rfc6376#section-3.6.2"},
+	}
+	dkimDefaultSelectorsFound = Finding{
+		ID:         "DKIM-DEFAULT-SELECTORS-FOUND",
+		Severity:   SeverityOK,
+		References: []string{"https://tools.ietf.org/html/rfc6376"},
+	}
+	dkimDefaultSelectorsMissing = Finding{
+		ID:          "DKIM-DEFAULT-SELECTORS-MISSING",
+		Severity:    SeverityWarning,
+		Description: "Only a few default selectors are checked, DKIM may be configured using other selectors.",
+		Remediation: "Sign outgoing mail with DKIM and publish the public key as TXT record at <selector>._domainkey.<domain>.",
+		References:  []string{"https://tools.ietf.org/html/rfc6376"},
+	}
+)
+
 func DKIMPlugin(options ...OptionFn) Plugin {
-	return &dkimPlugin{}
+	p := &dkimPlugin{
+		selectors: []string{"dkim", "default"},
+	}
+
+	for _, optionFn := range options {
+		optionFn(p)
+	}
+
+	return p
 }
 
 type dkimPlugin struct {
+	selectors []string
 }
 
 func (d *dkimPlugin) Name() string {
 	return "DKIM"
 }
 
-func (d *dkimPlugin) Check(domain string) <-chan Issue {
+func (d *dkimPlugin) Description() string {
+	return "Checks for DKIM public keys published at the configured selectors."
+}
+
+func (d *dkimPlugin) Category() Category {
+	return CategoryAuthentication
+}
+
+func (d *dkimPlugin) Findings() []Finding {
+	return []Finding{
+		dkimSelectorFound,
+		dkimDefaultSelectorsFound,
+		dkimDefaultSelectorsMissing,
+		FindingLookupError,
+	}
+}
+
+func (d *dkimPlugin) Check(ctx context.Context, domain string) <-chan Issue {
 	issuesChan := make(chan Issue)
 
 	go func() {
 		defer close(issuesChan)
 
+		scan := scanFrom(ctx, domain)
+
 		found := false
+		failed := false
 
 		defer func() {
 			if found {
-				issuesChan <- Issue{
-					Severity: SeverityOK,
-					Message:  fmt.Sprintf("Found default DKIM Records configured"),
-				}
-			} else {
-				issuesChan <- Issue{
-					Severity: SeverityWarning,
-					Message:  fmt.Sprintf("No default DKIM records configured."),
-				}
+				issuesChan <- dkimDefaultSelectorsFound.Issue(domain, fmt.Sprintf("Found default DKIM Records configured"))
+			} else if !failed {
+				issuesChan <- dkimDefaultSelectorsMissing.Issue(domain, fmt.Sprintf("No default DKIM records configured."))
 			}
 		}()
 
-		for _, selector := range []string{"dkim", "default"} {
-			r, err := r.Resolve(fmt.Sprintf("%s._domainkey.%s.", selector, domain), dns.TypeTXT)
-			if err != nil {
-				issuesChan <- Issue{
-					Severity: SeverityError,
-					Message:  fmt.Sprintf("Error retrieving record for selector '%s': %s", selector, err.Error()),
-				}
+		for _, selector := range d.selectors {
+			name := fmt.Sprintf("%s._domainkey.%s.", selector, domain)
 
+			r, err := scan.lookup(ctx, name, dns.TypeTXT)
+			if IsNotFound(err) {
 				continue
-			}
-
-			if r.Rcode != dns.RcodeSuccess {
-				issuesChan <- Issue{
-					Severity: SeverityDebug,
-					Message:  fmt.Sprintf("Error retrieving record for selector '%s': %s", selector, dns.RcodeToString[r.Rcode]),
-				}
+			} else if err != nil {
+				issuesChan <- lookupIssue(domain, fmt.Sprintf("DKIM selector '%s'", selector), name, dns.TypeTXT, err).
+					With("selector", selector)
 
+				failed = true
 				continue
 			}
 
@@ -67,10 +105,11 @@ func (d *dkimPlugin) Check(domain string) <-chan Issue {
 				if txt, ok := a.(*dns.TXT); ok {
 					str := strings.Join(txt.Txt, "")
 
-					issuesChan <- Issue{
-						Severity: SeverityInfo,
-						Message:  fmt.Sprintf("DKIM record for selector '%s': %s", selector, str),
-					}
+					issuesChan <- dkimSelectorFound.Issue(domain, fmt.Sprintf("DKIM record for selector '%s': %s", selector, str)).
+						With("name", name).
+						With("type", "TXT").
+						With("selector", selector).
+						With("record", str)
 
 					found = true
 				}
@@ -1,7 +1,9 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	dns "github.com/miekg/dns"
 )
@@ -10,8 +12,34 @@ var (
 	_ = Register(DMARCPlugin)
 )
 
+var (
+	dmarcRecord = Finding{
+		ID:         "DMARC-RECORD",
+		Severity:   SeverityInfo,
+		References: []string{"https://tools.ietf.org/html/rfc7489#section-6.3"},
+	}
+	dmarcConfigured = Finding{
+		ID:         "DMARC-CONFIGURED",
+		Severity:   SeverityOK,
+		References: []string{"https://tools.ietf.org/html/rfc7489"},
+	}
+	dmarcMissing = Finding{
+		ID:          "DMARC-MISSING",
+		Severity:    SeverityError,
+		Description: "Without DMARC receivers have no policy for mail failing SPF and DKIM alignment.",
+		Remediation: "Publish a TXT record at _dmarc.<domain>, for example \"v=DMARC1; p=none; rua=mailto:dmarc@<domain>\", and tighten the policy to quarantine or reject.",
+		References:  []string{"https://tools.ietf.org/html/rfc7489#section-6.1"},
+	}
+)
+
 func DMARCPlugin(options ...OptionFn) Plugin {
-	return &dmarcPlugin{}
+	p := &dmarcPlugin{}
+
+	for _, optionFn := range options {
+		optionFn(p)
+	}
+
+	return p
 }
 
 type dmarcPlugin struct {
@@ -21,42 +49,53 @@ func (d *dmarcPlugin) Name() string {
 	return "DMARC"
 }
 
-func (p *dmarcPlugin) Check(domain string) <-chan Issue {
+func (d *dmarcPlugin) Description() string {
+	return "Checks the DMARC policy published at _dmarc.<domain>."
+}
+
+func (d *dmarcPlugin) Category() Category {
+	return CategoryAuthentication
+}
+
+func (d *dmarcPlugin) Findings() []Finding {
+	return []Finding{
+		dmarcRecord,
+		dmarcConfigured,
+		dmarcMissing,
+		FindingLookupError,
+	}
+}
+
+func (p *dmarcPlugin) Check(ctx context.Context, domain string) <-chan Issue {
 	issuesChan := make(chan Issue)
 
 	go func() {
 		defer close(issuesChan)
 
+		scan := scanFrom(ctx, domain)
+
 		found := false
+		failed := false
+
+		name := fmt.Sprintf("_dmarc.%s.", domain)
 
 		defer func() {
 			if found {
-				issuesChan <- Issue{
-					Severity: SeverityOK,
-					Message:  fmt.Sprintf("DMARC Records configured"),
-				}
-			} else {
-				issuesChan <- Issue{
-					Severity: SeverityError,
-					Message:  fmt.Sprintf("No DMARC records configured."),
-				}
+				issuesChan <- dmarcConfigured.Issue(domain, fmt.Sprintf("DMARC Records configured"))
+			} else if !failed {
+				issuesChan <- dmarcMissing.Issue(domain, fmt.Sprintf("No DMARC records configured.")).
+					With("name", name).
+					With("type", "TXT")
 			}
 		}()
 
-		r, err := r.Resolve(fmt.Sprintf("_dmarc.%s.", domain), dns.TypeTXT)
-		if err != nil {
-			issuesChan <- Issue{
-				Severity: SeverityError,
-				Message:  fmt.Sprintf("Error retrieving TXT records: %s", err.Error()),
-			}
+		r, err := scan.lookup(ctx, name, dns.TypeTXT)
+		if IsNotFound(err) {
 			return
-		}
+		} else if err != nil {
+			issuesChan <- lookupIssue(domain, "DMARC", name, dns.TypeTXT, err)
 
-		if r.Rcode != dns.RcodeSuccess {
-			issuesChan <- Issue{
-				Severity: SeverityDebug,
-				Message:  fmt.Sprintf("Error retrieving TXT record: %s", dns.RcodeToString[r.Rcode]),
-			}
+			failed = true
 			return
 		}
 
@@ -64,11 +103,19 @@ func (p *dmarcPlugin) Check(domain string) <-chan Issue {
 			if txt, ok := a.(*dns.TXT); ok {
 				found = true
 
-				// todo(nl5887): reverse dns
-				issuesChan <- Issue{
-					Severity: SeverityInfo,
-					Message:  fmt.Sprintf("DMARC %s", txt.Txt),
+				str := strings.Join(txt.Txt, "")
+
+				issue := dmarcRecord.Issue(domain, fmt.Sprintf("DMARC %s", str)).
+					With("name", name).
+					With("type", "TXT").
+					With("record", str)
+
+				if policy, ok := parseTags(str)["p"]; ok {
+					issue = issue.With("p", policy)
 				}
+
+				// todo(nl5887): reverse dns
+				issuesChan <- issue
 			}
 		}
 
@@ -76,3 +123,19 @@ func (p *dmarcPlugin) Check(domain string) <-chan Issue {
 
 	return issuesChan
 }
+
+// parseTags parses a tag-value list like "v=DMARC1; p=none" into a map.
+func parseTags(str string) map[string]string {
+	tags := map[string]string{}
+
+	for _, part := range strings.Split(str, ";") {
+		parts := strings.SplitN(part, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		tags[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return tags
+}
@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	dns "github.com/miekg/dns"
@@ -10,8 +11,34 @@ var (
 	_ = Register(DNSSecPlugin)
 )
 
+var (
+	dnssecKey = Finding{
+		ID:         "DNSSEC-DNSKEY",
+		Severity:   SeverityInfo,
+		References: []string{"https://tools.ietf.org/html/rfc4034#section-2"},
+	}
+	dnssecEnabled = Finding{
+		ID:         "DNSSEC-ENABLED",
+		Severity:   SeverityOK,
+		References: []string{"https://tools.ietf.org/html/rfc4033"},
+	}
+	dnssecMissing = Finding{
+		ID:          "DNSSEC-MISSING",
+		Severity:    SeverityError,
+		Description: "Without DNSSEC the mail related records of the domain can be spoofed.",
+		Remediation: "Sign the zone and publish the DS record at the parent zone.",
+		References:  []string{"https://tools.ietf.org/html/rfc4033"},
+	}
+)
+
 func DNSSecPlugin(options ...OptionFn) Plugin {
-	return &dnssecPlugin{}
+	p := &dnssecPlugin{}
+
+	for _, optionFn := range options {
+		optionFn(p)
+	}
+
+	return p
 }
 
 type dnssecPlugin struct {
@@ -21,42 +48,53 @@ func (d *dnssecPlugin) Name() string {
 	return "DNSSec"
 }
 
-func (p *dnssecPlugin) Check(domain string) <-chan Issue {
+func (d *dnssecPlugin) Description() string {
+	return "Checks whether the zone publishes DNSSEC keys."
+}
+
+func (d *dnssecPlugin) Category() Category {
+	return CategoryDNS
+}
+
+func (d *dnssecPlugin) Findings() []Finding {
+	return []Finding{
+		dnssecKey,
+		dnssecEnabled,
+		dnssecMissing,
+		FindingLookupError,
+	}
+}
+
+func (p *dnssecPlugin) Check(ctx context.Context, domain string) <-chan Issue {
 	issuesChan := make(chan Issue)
 
 	go func() {
 		defer close(issuesChan)
 
+		scan := scanFrom(ctx, domain)
+
 		found := false
+		failed := false
+
+		name := fmt.Sprintf("%s.", domain)
 
 		defer func() {
 			if found {
-				issuesChan <- Issue{
-					Severity: SeverityOK,
-					Message:  fmt.Sprintf("DNS Sec(urity) implemented"),
-				}
-			} else {
-				issuesChan <- Issue{
-					Severity: SeverityError,
-					Message:  fmt.Sprintf("DNS Sec(urity) not implemented."),
-				}
+				issuesChan <- dnssecEnabled.Issue(domain, fmt.Sprintf("DNS Sec(urity) implemented"))
+			} else if !failed {
+				issuesChan <- dnssecMissing.Issue(domain, fmt.Sprintf("DNS Sec(urity) not implemented.")).
+					With("name", name).
+					With("type", "DNSKEY")
 			}
 		}()
 
-		result, err := r.Resolve(fmt.Sprintf("%s.", domain), dns.TypeDNSKEY)
-		if err != nil {
-			issuesChan <- Issue{
-				Severity: SeverityError,
-				Message:  fmt.Sprintf("Error retrieving DNSKey records: %s", err.Error()),
-			}
+		result, err := scan.lookup(ctx, name, dns.TypeDNSKEY)
+		if IsNotFound(err) {
 			return
-		}
+		} else if err != nil {
+			issuesChan <- lookupIssue(domain, "DNSKEY", name, dns.TypeDNSKEY, err)
 
-		if result.Rcode != dns.RcodeSuccess {
-			issuesChan <- Issue{
-				Severity: SeverityError,
-				Message:  fmt.Sprintf("Error retrieving DNSKey record: %s", dns.RcodeToString[result.Rcode]),
-			}
+			failed = true
 			return
 		}
 
@@ -64,10 +102,10 @@ func (p *dnssecPlugin) Check(domain string) <-chan Issue {
 			if key, ok := a.(*dns.DNSKEY); ok {
 				found = true
 
-				issuesChan <- Issue{
-					Severity: SeverityInfo,
-					Message:  fmt.Sprintf("public key: %s", key.PublicKey),
-				}
+				issuesChan <- dnssecKey.Issue(domain, fmt.Sprintf("public key: %s", key.PublicKey)).
+					With("name", name).
+					With("type", "DNSKEY").
+					With("record", key.String())
 			}
 		}
 	}()
@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	"bufio"
@@ -12,8 +13,75 @@ var (
 	_ = Register(DomainKeyPlugin)
 )
 
+var (
+	domainKeyRecord = Finding{
+		ID:         "DOMAINKEY-RECORD",
+		Severity:   SeverityInfo,
+		References: []string{"https://tools.ietf.org/html/rfc4870#section-3.6.2"},
+	}
+	domainKeyConfigured = Finding{
+		ID:         "DOMAINKEY-CONFIGURED",
+		Severity:   SeverityOK,
+		References: []string{"https://tools.ietf.org/html/rfc4870"},
+	}
+	domainKeyMissing = Finding{
+		ID:          "DOMAINKEY-MISSING",
+		Severity:    SeverityWarning,
+		Description: "DomainKeys has been superseded by DKIM.",
+		Remediation: "Publish a DomainKeys policy at _domainkey.<domain>, or rely on DKIM instead.",
+		References:  []string{"https://tools.ietf.org/html/rfc4870#section-3.6.2", "https://tools.ietf.org/html/rfc6376"},
+	}
+	domainKeySomeSigned = Finding{
+		ID:       "DOMAINKEY-SOME-SIGNED",
+		Severity: SeverityInfo,
+	}
+	domainKeyAllSigned = Finding{
+		ID:       "DOMAINKEY-ALL-SIGNED",
+		Severity: SeverityInfo,
+	}
+	domainKeyUnknownPolicy = Finding{
+		ID:          "DOMAINKEY-UNKNOWN-POLICY",
+		Severity:    SeverityWarning,
+		Remediation: "Set the o parameter of the DomainKeys policy to either \"-\" or \"~\".",
+		References:  []string{"https://tools.ietf.org/html/rfc4870#section-3.6.2.1"},
+	}
+	domainKeyTestMode = Finding{
+		ID:          "DOMAINKEY-TEST-MODE",
+		Severity:    SeverityError,
+		Description: "Receivers ignore DomainKeys signatures of domains in test mode.",
+		Remediation: "Remove t=y from the DomainKeys policy.",
+		References:  []string{"https://tools.ietf.org/html/rfc4870#section-3.6.2.1"},
+	}
+	domainKeyUnknownTest = Finding{
+		ID:          "DOMAINKEY-UNKNOWN-TEST",
+		Severity:    SeverityWarning,
+		Remediation: "Remove the t parameter from the DomainKeys policy, or set it to y while testing.",
+		References:  []string{"https://tools.ietf.org/html/rfc4870#section-3.6.2.1"},
+	}
+	domainKeyResponsible = Finding{
+		ID:       "DOMAINKEY-RESPONSIBLE",
+		Severity: SeverityInfo,
+	}
+	domainKeyNotes = Finding{
+		ID:       "DOMAINKEY-NOTES",
+		Severity: SeverityInfo,
+	}
+	domainKeyMalformedTag = Finding{
+		ID:          "DOMAINKEY-MALFORMED-TAG",
+		Severity:    SeverityWarning,
+		Remediation: "Give every tag of the DomainKeys policy a name and a value, like \"o=-\".",
+		References:  []string{"https://tools.ietf.org/html/rfc4870#section-3.6.2.1"},
+	}
+)
+
 func DomainKeyPlugin(options ...OptionFn) Plugin {
-	return &domainKeyPlugin{}
+	p := &domainKeyPlugin{}
+
+	for _, optionFn := range options {
+		optionFn(p)
+	}
+
+	return p
 }
 
 type domainKeyPlugin struct {
@@ -23,42 +91,61 @@ func (d *domainKeyPlugin) Name() string {
 	return "DomainKey"
 }
 
-func (p *domainKeyPlugin) Check(domain string) <-chan Issue {
+func (d *domainKeyPlugin) Description() string {
+	return "Checks the legacy DomainKeys policy published at _domainkey.<domain>."
+}
+
+func (d *domainKeyPlugin) Category() Category {
+	return CategoryAuthentication
+}
+
+func (d *domainKeyPlugin) Findings() []Finding {
+	return []Finding{
+		domainKeyRecord,
+		domainKeyConfigured,
+		domainKeyMissing,
+		domainKeySomeSigned,
+		domainKeyAllSigned,
+		domainKeyUnknownPolicy,
+		domainKeyTestMode,
+		domainKeyUnknownTest,
+		domainKeyResponsible,
+		domainKeyNotes,
+		domainKeyMalformedTag,
+		FindingLookupError,
+	}
+}
+
+func (p *domainKeyPlugin) Check(ctx context.Context, domain string) <-chan Issue {
 	issuesChan := make(chan Issue)
 
 	go func() {
 		defer close(issuesChan)
 
+		scan := scanFrom(ctx, domain)
+
 		found := false
+		failed := false
+
+		name := fmt.Sprintf("_domainkey.%s.", domain)
 
 		defer func() {
 			if found {
-				issuesChan <- Issue{
-					Severity: SeverityOK,
-					Message:  fmt.Sprintf("DomainKey Records configured"),
-				}
-			} else {
-				issuesChan <- Issue{
-					Severity: SeverityWarning,
-					Message:  fmt.Sprintf("No DomainKey records configured, defaults to o=~. DomainKeys has been superseded by dkim."),
-				}
+				issuesChan <- domainKeyConfigured.Issue(domain, fmt.Sprintf("DomainKey Records configured"))
+			} else if !failed {
+				issuesChan <- domainKeyMissing.Issue(domain, fmt.Sprintf("No DomainKey records configured, defaults to o=~. DomainKeys has been superseded by dkim.")).
+					With("name", name).
+					With("type", "TXT")
 			}
 		}()
 
-		r, err := r.Resolve(fmt.Sprintf("_domainkey.%s.", domain), dns.TypeTXT)
-		if err != nil {
-			issuesChan <- Issue{
-				Severity: SeverityError,
-				Message:  fmt.Sprintf("Error retrieving TXT records: %s", err.Error()),
-			}
+		r, err := scan.lookup(ctx, name, dns.TypeTXT)
+		if IsNotFound(err) {
 			return
-		}
+		} else if err != nil {
+			issuesChan <- lookupIssue(domain, "DomainKey", name, dns.TypeTXT, err)
 
-		if r.Rcode != dns.RcodeSuccess {
-			issuesChan <- Issue{
-				Severity: SeverityDebug,
-				Message:  fmt.Sprintf("Error retrieving TXT record: %s", dns.RcodeToString[r.Rcode]),
-			}
+			failed = true
 			return
 		}
 
@@ -68,10 +155,10 @@ func (p *domainKeyPlugin) Check(domain string) <-chan Issue {
 			if txt, ok := a.(*dns.TXT); ok {
 				policy = strings.Join(txt.Txt, "")
 
-				issuesChan <- Issue{
-					Severity: SeverityInfo,
-					Message:  fmt.Sprintf("DomainKey %s", txt.Txt),
-				}
+				issuesChan <- domainKeyRecord.Issue(domain, fmt.Sprintf("DomainKey %s", txt.Txt)).
+					With("name", name).
+					With("type", "TXT").
+					With("record", policy)
 
 			}
 		}
@@ -109,49 +196,42 @@ func (p *domainKeyPlugin) Check(domain string) <-chan Issue {
 				continue
 			}
 
-			switch parts[0][0] {
+			key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			if key == "" || value == "" {
+				issuesChan <- domainKeyMalformedTag.Issue(domain, fmt.Sprintf("Malformed DomainKey tag: %s", text)).
+					With("tag", text)
+				continue
+			}
+
+			switch key[0] {
 			case 'o':
-				if parts[1][0] == '~' {
-					issuesChan <- Issue{
-						Severity: SeverityInfo,
-						Message:  fmt.Sprintf("Some e-mails from this domain are signed."),
-					}
+				if value[0] == '~' {
+					issuesChan <- domainKeySomeSigned.Issue(domain, fmt.Sprintf("Some e-mails from this domain are signed.")).
+						With("o", value)
 
-				} else if parts[1][0] == '-' {
+				} else if value[0] == '-' {
 					found = true
 
-					issuesChan <- Issue{
-						Severity: SeverityInfo,
-						Message:  fmt.Sprintf("All e-mails from this domain are signed."),
-					}
+					issuesChan <- domainKeyAllSigned.Issue(domain, fmt.Sprintf("All e-mails from this domain are signed.")).
+						With("o", value)
 				} else {
-					issuesChan <- Issue{
-						Severity: SeverityWarning,
-						Message:  fmt.Sprintf("Unknown modifier for o parameter: %s", parts[1]),
-					}
+					issuesChan <- domainKeyUnknownPolicy.Issue(domain, fmt.Sprintf("Unknown modifier for o parameter: %s", value)).
+						With("o", value)
 				}
 			case 't':
-				if parts[1][0] == 'y' {
-					issuesChan <- Issue{
-						Severity: SeverityError,
-						Message:  fmt.Sprintf("DomainKey in test mode, domain key has no effect."),
-					}
+				if value[0] == 'y' {
+					issuesChan <- domainKeyTestMode.Issue(domain, fmt.Sprintf("DomainKey in test mode, domain key has no effect.")).
+						With("t", value)
 				} else {
-					issuesChan <- Issue{
-						Severity: SeverityWarning,
-						Message:  fmt.Sprintf("Unknown modifier for test parameter: %s", parts[1]),
-					}
+					issuesChan <- domainKeyUnknownTest.Issue(domain, fmt.Sprintf("Unknown modifier for test parameter: %s", value)).
+						With("t", value)
 				}
 			case 'r':
-				issuesChan <- Issue{
-					Severity: SeverityInfo,
-					Message:  fmt.Sprintf("DomainKey responsible e-mail address: %s", parts[1]),
-				}
+				issuesChan <- domainKeyResponsible.Issue(domain, fmt.Sprintf("DomainKey responsible e-mail address: %s", value)).
+					With("r", value)
 			case 'n':
-				issuesChan <- Issue{
-					Severity: SeverityInfo,
-					Message:  fmt.Sprintf("DomainKey notes: %s", parts[1]),
-				}
+				issuesChan <- domainKeyNotes.Issue(domain, fmt.Sprintf("DomainKey notes: %s", value)).
+					With("n", value)
 			}
 		}
 	}()
@@ -0,0 +1,33 @@
+package plugins
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestDomainKeyPolicy(t *testing.T) {
+	defer SetResolver(r)
+
+	for _, tt := range []struct {
+		policy string
+		ids    []string
+	}{
+		{"o=-", []string{"DOMAINKEY-RECORD", "DOMAINKEY-ALL-SIGNED", "DOMAINKEY-CONFIGURED"}},
+		{"o=~; t=y", []string{"DOMAINKEY-RECORD", "DOMAINKEY-SOME-SIGNED", "DOMAINKEY-TEST-MODE", "DOMAINKEY-MISSING"}},
+		{"o=; t=", []string{"DOMAINKEY-RECORD", "DOMAINKEY-MALFORMED-TAG", "DOMAINKEY-MALFORMED-TAG", "DOMAINKEY-MISSING"}},
+		{"=-;", []string{"DOMAINKEY-RECORD", "DOMAINKEY-MALFORMED-TAG", "DOMAINKEY-MISSING"}},
+		{"o = - ; n=notes", []string{"DOMAINKEY-RECORD", "DOMAINKEY-ALL-SIGNED", "DOMAINKEY-NOTES", "DOMAINKEY-CONFIGURED"}},
+	} {
+		SetResolver(txtRecords{"_domainkey.example.com.": {tt.policy}})
+
+		ids := []string{}
+		for issue := range DomainKeyPlugin().Check(context.Background(), "example.com") {
+			ids = append(ids, issue.ID)
+		}
+
+		if !reflect.DeepEqual(ids, tt.ids) {
+			t.Errorf("policy %q: got %v, expected %v", tt.policy, ids, tt.ids)
+		}
+	}
+}
@@ -1,15 +1,10 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
-
-	"github.com/zmap/zgrab/zlib"
-	"os"
-	"time"
-
-	"github.com/zmap/zgrab/ztools/zlog"
-	"github.com/zmap/zgrab/ztools/ztls"
 	"net"
+	"time"
 
 	dns "github.com/miekg/dns"
 )
@@ -18,135 +13,212 @@ var (
 	_ = Register(GrabPlugin)
 )
 
+var (
+	smtpConnectError = Finding{
+		ID:          "SMTP-CONNECT-ERROR",
+		Severity:    SeverityError,
+		Remediation: "Verify the mail server accepts connections on port 25.",
+		References:  []string{"https://tools.ietf.org/html/rfc5321#section-3.1"},
+	}
+	smtpBanner = Finding{
+		ID:         "SMTP-BANNER",
+		Severity:   SeverityInfo,
+		References: []string{"https://tools.ietf.org/html/rfc5321#section-4.2"},
+	}
+	smtpEHLO = Finding{
+		ID:       "SMTP-EHLO",
+		Severity: SeverityDebug,
+	}
+	smtpHelp = Finding{
+		ID:       "SMTP-HELP",
+		Severity: SeverityDebug,
+	}
+	smtpStartTLS = Finding{
+		ID:         "SMTP-STARTTLS",
+		Severity:   SeverityDebug,
+		References: []string{"https://tools.ietf.org/html/rfc3207"},
+	}
+	smtpStartTLSMissing = Finding{
+		ID:          "SMTP-STARTTLS-MISSING",
+		Severity:    SeverityError,
+		Description: "Mail to this server is transferred unencrypted.",
+		Remediation: "Enable STARTTLS with TLS 1.2 or later on the mail server.",
+		References:  []string{"https://tools.ietf.org/html/rfc3207", "https://tools.ietf.org/html/rfc8314"},
+	}
+	smtpCertificate = Finding{
+		ID:       "SMTP-TLS-CERTIFICATE",
+		Severity: SeverityInfo,
+	}
+)
+
 func GrabPlugin(options ...OptionFn) Plugin {
-	return &grabPlugin{}
+	p := &grabPlugin{
+		ports: []int{25},
+		ehlo:  "amazonaws.com",
+		// some smtp servers have really large timeouts
+		timeout: time.Duration(5) * time.Minute,
+	}
+
+	for _, optionFn := range options {
+		optionFn(p)
+	}
+
+	return p
 }
 
 type grabPlugin struct {
+	ports   []int
+	ehlo    string
+	timeout time.Duration
 }
 
 func (d *grabPlugin) Name() string {
 	return "Banner grabbing"
 }
 
-func (p *grabPlugin) Check(domain string) <-chan Issue {
+func (d *grabPlugin) Description() string {
+	return "Connects to the mail servers to grab the SMTP banner and verify STARTTLS support."
+}
+
+func (d *grabPlugin) Category() Category {
+	return CategoryTransport
+}
+
+func (d *grabPlugin) Requires() []Fact {
+	return []Fact{FactMX, FactMXIPs}
+}
+
+func (d *grabPlugin) Findings() []Finding {
+	return []Finding{
+		smtpConnectError,
+		smtpBanner,
+		smtpEHLO,
+		smtpHelp,
+		smtpStartTLS,
+		smtpStartTLSMissing,
+		smtpCertificate,
+		FindingLookupError,
+	}
+}
+
+func (p *grabPlugin) Check(ctx context.Context, domain string) <-chan Issue {
 	issuesChan := make(chan Issue)
 
 	go func() {
 		defer close(issuesChan)
 
-		r, err := r.Resolve(fmt.Sprintf("%s.", domain), dns.TypeMX)
+		name := fmt.Sprintf("%s.", domain)
+
+		scan := scanFrom(ctx, domain)
+
+		records, err := scan.MX(ctx)
 		if err != nil {
-			issuesChan <- Issue{
-				Severity: SeverityError,
-				Message:  fmt.Sprintf("Error retrieving MX records: %s", err.Error()),
-			}
+			issuesChan <- lookupIssue(domain, "MX", name, dns.TypeMX, err)
 			return
 		}
 
-		if r.Rcode != dns.RcodeSuccess {
-			issuesChan <- Issue{
-				Severity: SeverityError,
-				Message:  fmt.Sprintf("Error retrieving MX record: %s", dns.RcodeToString[r.Rcode]),
+		for _, mx := range records {
+			if ctx.Err() != nil {
+				return
 			}
-			return
-		}
 
-		for _, a := range r.Answer {
-			if mx, ok := a.(*dns.MX); ok {
-				addrs, err := net.LookupIP(mx.Mx)
-				if err != nil {
-					continue
+			addrs, err := scan.IPs(ctx, mx.Mx)
+			if err != nil {
+				continue
+			}
+
+			for _, target := range grabTargets(addrs, p.ports) {
+				// zgrab doesn't follow ctx, every grab gets the time
+				// left of the check at most
+				timeout, ok := budget(ctx, p.timeout)
+				if !ok {
+					return
 				}
 
-				config := &zlib.Config{
-					Port:               25,
-					Timeout:            time.Duration(5) * time.Minute, // some smtp servers have really large timeouts
-					TLS:                false,
-					TLSVerbose:         false,
-					TLSVersion:         ztls.VersionTLS12,
-					Banners:            true,
-					Heartbleed:         true,
-					Senders:            1,
-					ConnectionsPerHost: 1,
-					SMTP:               true,
-					SMTPHelp:           true,
-					StartTLS:           true,
-					EHLO:               true,
-					EHLODomain:         "amazonaws.com",
-					ErrorLog:           zlog.New(os.Stderr, "banner-grab"),
-					GOMAXPROCS:         1,
+				addr, port := target.addr, target.port
+
+				issue := func(f Finding, message string) Issue {
+					return f.Issue(addr.String(), message).
+						With("mx", mx.Mx).
+						With("ip", addr.String()).
+						With("port", fmt.Sprintf("%d", port))
 				}
 
-				for _, addr := range addrs {
-					target := &zlib.GrabTarget{
-						Addr:   addr,
-						Domain: "localhost",
-					}
-
-					grab := zlib.GrabBanner(config, target)
-					if grab.Error != nil {
-						issuesChan <- Issue{
-							Severity: SeverityError,
-							Message:  fmt.Sprintf("Error grabbing banner %s(%s): %s: %s", mx.Mx, addr.String(), grab.ErrorComponent, grab.Error.Error()),
-						}
-					}
-
-					if grab.Data.Banner != "" {
-						issuesChan <- Issue{
-							Severity: SeverityInfo,
-							Message:  fmt.Sprintf("Banner %s(%s) %s", mx.Mx, addr.String(), grab.Data.Banner),
-						}
-					}
-
-					if grab.Data.EHLO != "" {
-						issuesChan <- Issue{
-							Severity: SeverityDebug,
-							Message:  fmt.Sprintf("EHLO %s(%s) %s", mx.Mx, addr.String(), grab.Data.EHLO),
-						}
-					}
-
-					if grab.Data.SMTPHelp != nil {
-						issuesChan <- Issue{
-							Severity: SeverityDebug,
-							Message:  fmt.Sprintf("SMTP HELP %s(%s) %s", mx.Mx, addr.String(), *grab.Data.SMTPHelp),
-						}
-					}
-
-					if grab.Data.StartTLS != "" {
-						issuesChan <- Issue{
-							Severity: SeverityDebug,
-							Message:  fmt.Sprintf("TLS12 %s(%s) %s", mx.Mx, addr.String(), grab.Data.StartTLS),
-						}
-					} else {
-						issuesChan <- Issue{
-							Severity: SeverityError,
-							Message:  fmt.Sprintf("TLS12 not supported by server %s(%s)", mx.Mx, addr.String()),
-						}
-					}
-
-					if grab.Data.TLSHandshake != nil {
-						// table.Append([]string{"Grab", "Server certificates", color.YellowString(fmt.Sprintf("%#v (%#v) %s\n", mx.Mx, addr.String(), grab.Data.TLSHandshake.ServerCertificates.Certificate.Parsed.Subject.String()))})
-
-						issuesChan <- Issue{
-							Severity: SeverityInfo,
-							Message:  fmt.Sprintf("TLS Handshake: %s(%s) %s", mx.Mx, addr.String(), grab.Data.TLSHandshake.ServerCertificates.Certificate.Parsed.Subject.String()),
-						}
-						for _, sc := range grab.Data.TLSHandshake.ServerCertificates.Chain {
-							// table.Append([]string{"Grab", "Server certificates", color.YellowString(fmt.Sprintf("%#v (%#v) %s\n", mx.Mx, addr.String(), sc.Parsed.Subject.String()))})
-							_ = sc
-						}
-					}
-
-					if grab.Data.Heartbleed == nil {
-					} else if grab.Data.Heartbleed.Vulnerable {
-						// table.Append([]string{"Grab", "Heartbleed", color.YellowString(fmt.Sprintf("%#v (%#v) %s\n", mx.Mx, addr.String(), "Heartbleed vulnerable"))})
-					}
+				t := g.Grab(ctx, addr, port, p.ehlo, timeout)
+				if t.Error != "" {
+					issuesChan <- issue(smtpConnectError, fmt.Sprintf("Error grabbing banner %s(%s): %s: %s", mx.Mx, addr.String(), t.ErrorComponent, t.Error)).
+						With("error", t.Error)
+				}
+
+				if t.Banner != "" {
+					issuesChan <- issue(smtpBanner, fmt.Sprintf("Banner %s(%s) %s", mx.Mx, addr.String(), t.Banner)).
+						With("banner", t.Banner)
+				}
+
+				if t.EHLO != "" {
+					issuesChan <- issue(smtpEHLO, fmt.Sprintf("EHLO %s(%s) %s", mx.Mx, addr.String(), t.EHLO)).
+						With("ehlo", t.EHLO)
+				}
+
+				if t.Help != "" {
+					issuesChan <- issue(smtpHelp, fmt.Sprintf("SMTP HELP %s(%s) %s", mx.Mx, addr.String(), t.Help)).
+						With("help", t.Help)
+				}
+
+				if t.StartTLS != "" {
+					issuesChan <- issue(smtpStartTLS, fmt.Sprintf("TLS12 %s(%s) %s", mx.Mx, addr.String(), t.StartTLS)).
+						With("starttls", t.StartTLS)
+				} else {
+					issuesChan <- issue(smtpStartTLSMissing, fmt.Sprintf("TLS12 not supported by server %s(%s)", mx.Mx, addr.String()))
+				}
+
+				if cert := t.Certificate; cert != nil {
+					issuesChan <- issue(smtpCertificate, fmt.Sprintf("TLS Handshake: %s(%s) %s", mx.Mx, addr.String(), cert.Subject)).
+						With("subject", cert.Subject).
+						With("issuer", cert.Issuer).
+						With("not_after", cert.NotAfter.UTC().Format(time.RFC3339))
 				}
-				//todo(nl5887): summary? found critical issues
 			}
+			//todo(nl5887): summary? found critical issues
 		}
 	}()
 
 	return issuesChan
 }
+
+// budget returns timeout, capped to the time left until the deadline of ctx,
+// or false when the time budget of ctx is spent.
+func budget(ctx context.Context, timeout time.Duration) (time.Duration, bool) {
+	if ctx.Err() != nil {
+		return 0, false
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return 0, false
+		}
+
+		if left < timeout {
+			timeout = left
+		}
+	}
+
+	return timeout, true
+}
+
+type grabTarget struct {
+	addr net.IP
+	port int
+}
+
+func grabTargets(addrs []net.IP, ports []int) []grabTarget {
+	targets := []grabTarget{}
+	for _, addr := range addrs {
+		for _, port := range ports {
+			targets = append(targets, grabTarget{addr, port})
+		}
+	}
+
+	return targets
+}
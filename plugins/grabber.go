@@ -0,0 +1,115 @@
+package plugins
+
+import (
+	"context"
+	"net"
+	"os"
+	"time"
+
+	"github.com/zmap/zgrab/zlib"
+	"github.com/zmap/zgrab/ztools/zlog"
+	"github.com/zmap/zgrab/ztools/ztls"
+)
+
+var (
+	g = DefaultGrabber
+)
+
+// DefaultGrabber grabs transcripts from the network using zgrab.
+var DefaultGrabber Grabber = zgrabber{}
+
+// Grabber grabs the SMTP transcript of a mail server.
+type Grabber interface {
+	Grab(ctx context.Context, addr net.IP, port int, ehlo string, timeout time.Duration) *Transcript
+}
+
+// SetGrabber sets the grabber used by all plugins.
+func SetGrabber(gr Grabber) {
+	g = gr
+}
+
+// Transcript is what a mail server told during a banner grab.
+type Transcript struct {
+	IP   string `json:"ip"`
+	Port int    `json:"port"`
+
+	Banner   string `json:"banner,omitempty"`
+	EHLO     string `json:"ehlo,omitempty"`
+	Help     string `json:"help,omitempty"`
+	StartTLS string `json:"starttls,omitempty"`
+
+	Certificate *Certificate `json:"certificate,omitempty"`
+
+	Error          string `json:"error,omitempty"`
+	ErrorComponent string `json:"error_component,omitempty"`
+}
+
+// Certificate is the certificate presented after STARTTLS.
+type Certificate struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"not_after"`
+	Raw      []byte    `json:"raw,omitempty"`
+}
+
+// zgrabber grabs transcripts using zgrab.
+type zgrabber struct{}
+
+func (zgrabber) Grab(ctx context.Context, addr net.IP, port int, ehlo string, timeout time.Duration) *Transcript {
+	config := zlib.Config{
+		Port:               uint16(port),
+		Timeout:            timeout,
+		TLS:                false,
+		TLSVerbose:         false,
+		TLSVersion:         ztls.VersionTLS12,
+		Banners:            true,
+		Heartbleed:         true,
+		Senders:            1,
+		ConnectionsPerHost: 1,
+		SMTP:               true,
+		SMTPHelp:           true,
+		StartTLS:           true,
+		EHLO:               true,
+		EHLODomain:         ehlo,
+		ErrorLog:           zlog.New(os.Stderr, "banner-grab"),
+		GOMAXPROCS:         1,
+	}
+
+	target := &zlib.GrabTarget{
+		Addr:   addr,
+		Domain: "localhost",
+	}
+
+	grab := zlib.GrabBanner(&config, target)
+
+	t := &Transcript{
+		IP:       addr.String(),
+		Port:     port,
+		Banner:   grab.Data.Banner,
+		EHLO:     grab.Data.EHLO,
+		StartTLS: grab.Data.StartTLS,
+	}
+
+	if grab.Error != nil {
+		t.Error = grab.Error.Error()
+		t.ErrorComponent = grab.ErrorComponent
+	}
+
+	if grab.Data.SMTPHelp != nil {
+		t.Help = grab.Data.SMTPHelp.Response
+	}
+
+	if grab.Data.TLSHandshake != nil && grab.Data.TLSHandshake.ServerCertificates != nil {
+		sc := grab.Data.TLSHandshake.ServerCertificates.Certificate
+		if cert := sc.Parsed; cert != nil {
+			t.Certificate = &Certificate{
+				Subject:  cert.Subject.String(),
+				Issuer:   cert.Issuer.String(),
+				NotAfter: cert.NotAfter.UTC(),
+				Raw:      sc.Raw,
+			}
+		}
+	}
+
+	return t
+}
@@ -0,0 +1,413 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	dns "github.com/miekg/dns"
+)
+
+// DefaultRootHints are the IPv4 addresses of the root servers.
+var DefaultRootHints = []string{
+	"198.41.0.4",     // a.root-servers.net
+	"199.9.14.201",   // b.root-servers.net
+	"192.33.4.12",    // c.root-servers.net
+	"199.7.91.13",    // d.root-servers.net
+	"192.203.230.10", // e.root-servers.net
+	"192.5.5.241",    // f.root-servers.net
+	"192.112.36.4",   // g.root-servers.net
+	"198.97.190.53",  // h.root-servers.net
+	"192.36.148.17",  // i.root-servers.net
+	"192.58.128.30",  // j.root-servers.net
+	"193.0.14.129",   // k.root-servers.net
+	"199.7.83.42",    // l.root-servers.net
+	"202.12.27.33",   // m.root-servers.net
+}
+
+const (
+	// maxReferrals bounds the number of delegations followed for a name.
+	maxReferrals = 16
+
+	// maxCNAMEs bounds the length of followed CNAME chains.
+	maxCNAMEs = 8
+
+	// maxDepth bounds the nesting of lookups of glueless nameservers.
+	maxDepth = 4
+
+	// serverTimeout bounds the time spent waiting for a single server.
+	serverTimeout = 3 * time.Second
+
+	// maxDelegations bounds the number of known delegations.
+	maxDelegations = 10000
+)
+
+// Response is an answer of an authoritative server.
+type Response struct {
+	Msg *dns.Msg
+
+	// Server is the address of the server that gave the answer.
+	Server string
+
+	// Zone is the zone the server is authoritative for.
+	Zone string
+}
+
+// AuthoritativeResolver is implemented by resolvers that query the
+// authoritative servers directly, and know which server gave an answer.
+type AuthoritativeResolver interface {
+	Resolver
+
+	ResolveAuthoritative(ctx context.Context, name string, qtype uint16) (*Response, error)
+}
+
+// IterativeResolver returns a resolver that walks the delegation from the
+// root hints, given as host or host:port, down to the authoritative servers
+// of a name instead of relying on a recursive resolver. The port of the first
+// root hint is used for all nameservers, which allows running against a
+// stand-in hierarchy.
+func IterativeResolver(rootHints []string, options ...OptionFn) AuthoritativeResolver {
+	if len(rootHints) == 0 {
+		rootHints = DefaultRootHints
+	}
+
+	res := &iterativeResolver{
+		bufSize:     DefaultBufSize,
+		concurrency: DefaultConcurrency,
+		port:        "53",
+		delegations: map[string]delegation{},
+		swept:       time.Now(),
+	}
+
+	for _, optionFn := range options {
+		optionFn(res)
+	}
+
+	for _, hint := range rootHints {
+		res.roots = append(res.roots, withPort(hint, "53"))
+	}
+
+	if _, port, err := net.SplitHostPort(res.roots[0]); err == nil {
+		res.port = port
+	}
+
+	res.sem = make(chan struct{}, res.concurrency)
+	return res
+}
+
+type delegation struct {
+	servers []string
+	expires time.Time
+}
+
+type iterativeResolver struct {
+	roots []string
+	port  string
+
+	bufSize     uint16
+	concurrency int
+
+	// sem bounds the number of queries in flight
+	sem chan struct{}
+
+	// limit spaces the queries, if set
+	limit *Limiter
+
+	// delegations are the servers of zones, until the TTL of their NS
+	// records expires. Expired delegations are swept every sweepInterval.
+	m           sync.Mutex
+	delegations map[string]delegation
+	swept       time.Time
+}
+
+func (r *iterativeResolver) Resolve(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	resp, err := r.ResolveAuthoritative(ctx, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Msg, nil
+}
+
+func (r *iterativeResolver) ResolveAuthoritative(ctx context.Context, name string, qtype uint16) (*Response, error) {
+	name = dns.Fqdn(strings.ToLower(name))
+
+	resp, err := r.resolve(ctx, name, qtype, 0)
+	if err != nil {
+		return nil, lookupError(name, qtype, nil, err)
+	}
+
+	return resp, nil
+}
+
+func (r *iterativeResolver) resolve(ctx context.Context, name string, qtype uint16, depth int) (*Response, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("Too many nested lookups resolving %s", name)
+	}
+
+	original := name
+	chain := []dns.RR{}
+
+	for i := 0; i <= maxCNAMEs; i++ {
+		resp, err := r.walk(ctx, name, qtype, depth)
+		if err != nil {
+			return nil, err
+		}
+
+		target := ""
+		found := false
+
+		for _, rr := range resp.Msg.Answer {
+			if !strings.EqualFold(rr.Header().Name, name) {
+				continue
+			}
+
+			if rr.Header().Rrtype == qtype {
+				found = true
+			} else if cname, ok := rr.(*dns.CNAME); ok {
+				target = dns.Fqdn(strings.ToLower(cname.Target))
+			}
+		}
+
+		if found || target == "" || qtype == dns.TypeCNAME || resp.Msg.Rcode != dns.RcodeSuccess {
+			if len(chain) > 0 {
+				msg := resp.Msg.Copy()
+				msg.Answer = append(chain, msg.Answer...)
+				msg.Question = []dns.Question{{Name: original, Qtype: qtype, Qclass: dns.ClassINET}}
+				resp = &Response{Msg: msg, Server: resp.Server, Zone: resp.Zone}
+			}
+
+			return resp, nil
+		}
+
+		// follow the cname, the target can live in another zone
+		chain = append(chain, resp.Msg.Answer...)
+		name = target
+	}
+
+	return nil, fmt.Errorf("CNAME chain too long resolving %s", original)
+}
+
+// walk follows the delegations for name, starting at the closest known
+// enclosing zone, until an authoritative answer is found.
+func (r *iterativeResolver) walk(ctx context.Context, name string, qtype uint16, depth int) (*Response, error) {
+	zone, servers := r.closest(name)
+
+	for i := 0; i < maxReferrals; i++ {
+		msg, server, err := r.query(ctx, servers, name, qtype)
+		if err != nil {
+			return nil, err
+		}
+
+		if msg.Rcode != dns.RcodeSuccess || len(msg.Answer) > 0 || msg.Authoritative {
+			return &Response{
+				Msg:    msg,
+				Server: server,
+				Zone:   zone,
+			}, nil
+		}
+
+		child, names, ttl := referral(msg, zone, name)
+		if child == "" {
+			return nil, fmt.Errorf("%w: %s answered neither authoritative nor with a referral for %s", errLame, server, name)
+		}
+
+		addrs := r.glue(ctx, msg, names, depth)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		} else if len(addrs) == 0 {
+			return nil, fmt.Errorf("%w: could not resolve any nameserver of %s", errLame, child)
+		}
+
+		r.delegate(child, addrs, ttl)
+
+		zone, servers = child, addrs
+	}
+
+	return nil, fmt.Errorf("Too many referrals resolving %s", name)
+}
+
+// delegate stores the servers of zone for ttl. Once maxDelegations are known,
+// an arbitrary delegation makes room for the new one.
+func (r *iterativeResolver) delegate(zone string, servers []string, ttl time.Duration) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(r.swept) >= sweepInterval {
+		for zone, d := range r.delegations {
+			if !now.Before(d.expires) {
+				delete(r.delegations, zone)
+			}
+		}
+
+		r.swept = now
+	}
+
+	if _, ok := r.delegations[zone]; !ok && len(r.delegations) >= maxDelegations {
+		for zone := range r.delegations {
+			delete(r.delegations, zone)
+			break
+		}
+	}
+
+	r.delegations[zone] = delegation{
+		servers: servers,
+		expires: now.Add(ttl),
+	}
+}
+
+// closest returns the closest enclosing zone of name with known servers,
+// dropping the expired delegations it passes.
+func (r *iterativeResolver) closest(name string) (string, []string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	now := time.Now()
+
+	labels := dns.SplitDomainName(name)
+	for i := range labels {
+		zone := dns.Fqdn(strings.Join(labels[i:], "."))
+
+		d, ok := r.delegations[zone]
+		if !ok {
+			continue
+		} else if !now.Before(d.expires) {
+			delete(r.delegations, zone)
+			continue
+		}
+
+		return zone, d.servers
+	}
+
+	return ".", r.roots
+}
+
+// query sends the question to servers in order, until one answers.
+func (r *iterativeResolver) query(ctx context.Context, servers []string, name string, qtype uint16) (*dns.Msg, string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.RecursionDesired = false
+	m.SetEdns0(r.bufSize, false)
+
+	select {
+	case r.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+
+	defer func() {
+		<-r.sem
+	}()
+
+	var lastErr error
+	for _, server := range servers {
+		if err := r.limit.Wait(ctx); err != nil {
+			return nil, "", err
+		}
+
+		sctx, cancel := context.WithTimeout(ctx, serverTimeout)
+		msg, err := (&dnsUpstream{addr: server, bufSize: r.bufSize}).Exchange(sctx, m)
+		cancel()
+
+		if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		} else if err != nil {
+			lastErr = err
+			continue
+		}
+
+		// try another server of the zone
+		if msg.Rcode == dns.RcodeServerFailure || msg.Rcode == dns.RcodeRefused {
+			lastErr = fmt.Errorf("%s answered %s", server, dns.RcodeToString[msg.Rcode])
+
+			if server == servers[len(servers)-1] {
+				return msg, server, nil
+			}
+
+			continue
+		}
+
+		return msg, server, nil
+	}
+
+	return nil, "", lastErr
+}
+
+// referral returns the child zone and its nameservers of a referral for
+// name, or an empty child when msg is not a referral.
+func referral(msg *dns.Msg, zone string, name string) (string, []string, time.Duration) {
+	child := ""
+	names := []string{}
+
+	ttl := uint32(0)
+	for _, rr := range msg.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+
+		owner := dns.Fqdn(strings.ToLower(ns.Hdr.Name))
+		if owner == zone || !dns.IsSubDomain(zone, owner) || !dns.IsSubDomain(owner, name) {
+			continue
+		}
+
+		child = owner
+		names = append(names, dns.Fqdn(strings.ToLower(ns.Ns)))
+
+		if ttl == 0 || ns.Hdr.Ttl < ttl {
+			ttl = ns.Hdr.Ttl
+		}
+	}
+
+	return child, names, time.Duration(ttl) * time.Second
+}
+
+// glue returns the addresses of the nameservers names, from the additional
+// section or by resolving them.
+func (r *iterativeResolver) glue(ctx context.Context, msg *dns.Msg, names []string, depth int) []string {
+	addrs := []string{}
+
+	for _, name := range names {
+		for _, rr := range msg.Extra {
+			if !strings.EqualFold(rr.Header().Name, name) {
+				continue
+			}
+
+			switch rr := rr.(type) {
+			case *dns.A:
+				addrs = append(addrs, net.JoinHostPort(rr.A.String(), r.port))
+			case *dns.AAAA:
+				addrs = append(addrs, net.JoinHostPort(rr.AAAA.String(), r.port))
+			}
+		}
+	}
+
+	if len(addrs) > 0 {
+		return addrs
+	}
+
+	for _, name := range names {
+		resp, err := r.resolve(ctx, name, dns.TypeA, depth+1)
+		if err != nil {
+			continue
+		}
+
+		for _, rr := range resp.Msg.Answer {
+			if a, ok := rr.(*dns.A); ok {
+				addrs = append(addrs, net.JoinHostPort(a.A.String(), r.port))
+			}
+		}
+
+		// one resolved nameserver is enough to continue
+		if len(addrs) > 0 {
+			break
+		}
+	}
+
+	return addrs
+}
@@ -0,0 +1,323 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dns "github.com/miekg/dns"
+)
+
+// zoneHandler answers as an authoritative server of zone with records:
+// answers for its own names, referrals with glue for delegated names, and
+// NXDOMAIN otherwise.
+type zoneHandler struct {
+	zone    string
+	records []dns.RR
+}
+
+func newZoneHandler(t *testing.T, zone string, records ...string) *zoneHandler {
+	h := &zoneHandler{zone: zone}
+
+	for _, s := range records {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h.records = append(h.records, rr)
+	}
+
+	return h
+}
+
+func (h *zoneHandler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	q := req.Question[0]
+
+	exists := false
+	for _, rr := range h.records {
+		if !strings.EqualFold(rr.Header().Name, q.Name) {
+			continue
+		}
+
+		exists = true
+
+		if rr.Header().Rrtype == q.Qtype || rr.Header().Rrtype == dns.TypeCNAME {
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+
+	if len(m.Answer) == 0 {
+		// referral to the servers of a child zone
+		names := map[string]bool{}
+		for _, rr := range h.records {
+			ns, ok := rr.(*dns.NS)
+			if !ok || ns.Hdr.Name == h.zone || !dns.IsSubDomain(ns.Hdr.Name, q.Name) {
+				continue
+			}
+
+			m.Ns = append(m.Ns, ns)
+			names[ns.Ns] = true
+		}
+
+		for _, rr := range h.records {
+			if _, ok := rr.(*dns.A); ok && names[rr.Header().Name] {
+				m.Extra = append(m.Extra, rr)
+			}
+		}
+
+		if len(m.Ns) > 0 {
+			w.WriteMsg(m)
+			return
+		}
+	}
+
+	m.Authoritative = true
+	if !exists {
+		m.Rcode = dns.RcodeNameError
+	}
+
+	w.WriteMsg(m)
+}
+
+// deepHandler refers every query to a zone one label deeper than the
+// previous referral, until the queried name itself.
+type deepHandler struct {
+	m     sync.Mutex
+	zone  string
+	glue  string
+	depth int
+}
+
+func (h *deepHandler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	m := new(dns.Msg)
+	m.SetReply(req)
+
+	labels := dns.SplitDomainName(req.Question[0].Name)
+
+	h.depth++
+	if n := len(dns.SplitDomainName(h.zone)) + h.depth; n <= len(labels) {
+		child := dns.Fqdn(strings.Join(labels[len(labels)-n:], "."))
+
+		m.Ns = append(m.Ns, &dns.NS{
+			Hdr: dns.RR_Header{Name: child, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
+			Ns:  "ns." + child,
+		})
+
+		m.Extra = append(m.Extra, &dns.A{
+			Hdr: dns.RR_Header{Name: "ns." + child, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   net.ParseIP(h.glue),
+		})
+	} else {
+		m.Authoritative = true
+	}
+
+	w.WriteMsg(m)
+}
+
+// lameHandler answers neither authoritative nor with a referral.
+type lameHandler struct{}
+
+func (lameHandler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	w.WriteMsg(m)
+}
+
+// serveHierarchy starts a server for every handler, on 127.0.0.1, 127.0.0.2
+// and so on, all on the same port, and returns the root hints of the first.
+func serveHierarchy(t *testing.T, handlers ...dns.Handler) ([]string, func()) {
+	servers := []*dns.Server{}
+
+	stop := func() {
+		for _, srv := range servers {
+			srv.Shutdown()
+		}
+	}
+
+	port := "0"
+	for i, h := range handlers {
+		pc, err := net.ListenPacket("udp", net.JoinHostPort(net.IPv4(127, 0, 0, byte(i+1)).String(), port))
+		if err != nil {
+			stop()
+			t.Skipf("cannot listen on loopback addresses: %s", err)
+		}
+
+		_, port, _ = net.SplitHostPort(pc.LocalAddr().String())
+
+		started := make(chan struct{})
+
+		srv := &dns.Server{PacketConn: pc, Handler: h, NotifyStartedFunc: func() { close(started) }}
+		go srv.ActivateAndServe()
+		<-started
+
+		servers = append(servers, srv)
+	}
+
+	return []string{net.JoinHostPort("127.0.0.1", port)}, stop
+}
+
+// testHierarchy serves a root, the test. zone and its children:
+//
+//	127.0.0.1  .
+//	127.0.0.2  test.
+//	127.0.0.3  example.test., delegated with glue
+//	127.0.0.4  glueless.test., delegated to ns.example.test. without glue
+//	127.0.0.5  lame.test., a lame server
+//	127.0.0.6  deep.test., referring a label at a time
+//
+// loop-a.test. and loop-b.test. are delegated without glue to the
+// nameservers of each other.
+func testHierarchy(t *testing.T) ([]string, func()) {
+	return serveHierarchy(t,
+		newZoneHandler(t, ".",
+			"test. 300 IN NS ns.test.",
+			"ns.test. 300 IN A 127.0.0.2",
+		),
+		newZoneHandler(t, "test.",
+			"example.test. 300 IN NS ns1.example.test.",
+			"ns1.example.test. 300 IN A 127.0.0.3",
+			"glueless.test. 300 IN NS ns.example.test.",
+			"lame.test. 300 IN NS ns.lame.test.",
+			"ns.lame.test. 300 IN A 127.0.0.5",
+			"deep.test. 300 IN NS ns.deep.test.",
+			"ns.deep.test. 300 IN A 127.0.0.6",
+			"loop-a.test. 300 IN NS ns.loop-b.test.",
+			"loop-b.test. 300 IN NS ns.loop-a.test.",
+		),
+		newZoneHandler(t, "example.test.",
+			"example.test. 300 IN MX 10 mail.example.test.",
+			"mail.example.test. 300 IN A 192.0.2.1",
+			"ns.example.test. 300 IN A 127.0.0.4",
+			"alias.example.test. 300 IN CNAME www.glueless.test.",
+		),
+		newZoneHandler(t, "glueless.test.",
+			"www.glueless.test. 300 IN A 192.0.2.2",
+		),
+		lameHandler{},
+		&deepHandler{zone: "deep.test.", glue: "127.0.0.6"},
+	)
+}
+
+func TestIterativeResolver(t *testing.T) {
+	hints, stop := testHierarchy(t)
+	defer stop()
+
+	_, port, _ := net.SplitHostPort(hints[0])
+
+	for _, tt := range []struct {
+		name    string
+		qtype   uint16
+		answers []string
+		server  string
+		zone    string
+	}{
+		// referral chain, with glue
+		{"example.test.", dns.TypeMX, []string{"mail.example.test."}, "127.0.0.3", "example.test."},
+		{"mail.example.test.", dns.TypeA, []string{"192.0.2.1"}, "127.0.0.3", "example.test."},
+		// glueless, the nameserver is resolved in another zone
+		{"www.glueless.test.", dns.TypeA, []string{"192.0.2.2"}, "127.0.0.4", "glueless.test."},
+		// cname across zones
+		{"alias.example.test.", dns.TypeA, []string{"www.glueless.test.", "192.0.2.2"}, "127.0.0.4", "glueless.test."},
+		// nxdomain is an answer
+		{"missing.example.test.", dns.TypeA, []string{}, "127.0.0.3", "example.test."},
+	} {
+		resp, err := IterativeResolver(hints).ResolveAuthoritative(context.Background(), tt.name, tt.qtype)
+		if err != nil && !IsNotFound(err) {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		} else if err != nil {
+			if len(tt.answers) > 0 {
+				t.Errorf("%s: %s", tt.name, err)
+			}
+
+			continue
+		}
+
+		answers := []string{}
+		for _, rr := range resp.Msg.Answer {
+			switch rr := rr.(type) {
+			case *dns.MX:
+				answers = append(answers, rr.Mx)
+			case *dns.A:
+				answers = append(answers, rr.A.String())
+			case *dns.CNAME:
+				answers = append(answers, rr.Target)
+			}
+		}
+
+		if strings.Join(answers, " ") != strings.Join(tt.answers, " ") {
+			t.Errorf("%s: got answers %v, expected %v", tt.name, answers, tt.answers)
+		}
+
+		if server := net.JoinHostPort(tt.server, port); resp.Server != server || resp.Zone != tt.zone {
+			t.Errorf("%s: got answer of %s for %s, expected %s for %s", tt.name, resp.Server, resp.Zone, server, tt.zone)
+		}
+	}
+}
+
+func TestIterativeResolverErrors(t *testing.T) {
+	hints, stop := testHierarchy(t)
+	defer stop()
+
+	deep := strings.Repeat("x.", maxReferrals+2) + "deep.test."
+
+	for _, tt := range []struct {
+		name string
+		err  string
+	}{
+		{"www.lame.test.", "BROKEN: lame delegation: 127.0.0.5"},
+		{"www.loop-a.test.", "BROKEN: lame delegation: could not resolve any nameserver of loop-a.test."},
+		{deep, "Too many referrals"},
+	} {
+		_, err := IterativeResolver(hints).ResolveAuthoritative(context.Background(), tt.name, dns.TypeA)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, expected %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestIterativeResolverDelegations(t *testing.T) {
+	r := IterativeResolver([]string{"127.0.0.1:5353"}).(*iterativeResolver)
+
+	r.delegate("example.test.", []string{"127.0.0.3:5353"}, time.Minute)
+	r.delegate("expired.test.", []string{"127.0.0.4:5353"}, 0)
+
+	if zone, _ := r.closest("www.example.test."); zone != "example.test." {
+		t.Errorf("got zone %s, expected example.test.", zone)
+	}
+
+	// expired delegations are dropped when passed
+	if zone, _ := r.closest("www.expired.test."); zone != "." {
+		t.Errorf("got zone %s, expected the root for an expired delegation", zone)
+	} else if _, ok := r.delegations["expired.test."]; ok {
+		t.Errorf("expected the expired delegation to be dropped")
+	}
+
+	// and swept when a sweep is due
+	r.delegate("expired.test.", []string{"127.0.0.4:5353"}, 0)
+	r.swept = time.Now().Add(-sweepInterval)
+	r.delegate("other.test.", []string{"127.0.0.5:5353"}, time.Minute)
+
+	if _, ok := r.delegations["expired.test."]; ok {
+		t.Errorf("expected the expired delegation to be swept")
+	}
+
+	for i := 0; i < maxDelegations+10; i++ {
+		r.delegate(fmt.Sprintf("zone%d.test.", i), []string{"127.0.0.6:5353"}, time.Minute)
+	}
+
+	if n := len(r.delegations); n != maxDelegations {
+		t.Errorf("got %d delegations, expected at most %d", n, maxDelegations)
+	}
+}
@@ -0,0 +1,103 @@
+package plugins
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Limiter spaces events evenly at a maximum rate per second, shared by all
+// goroutines waiting on it. A nil limiter never waits.
+type Limiter struct {
+	interval time.Duration
+
+	m    sync.Mutex
+	next time.Time
+}
+
+// NewLimiter returns a limiter allowing perSecond events per second, or nil
+// if perSecond is not positive.
+func NewLimiter(perSecond float64) *Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+
+	return &Limiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+	}
+}
+
+// Wait waits for the turn of the next event, or until ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.m.Lock()
+
+	now := time.Now()
+
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+
+	l.next = at.Add(l.interval)
+
+	l.m.Unlock()
+
+	if d := at.Sub(now); d > 0 {
+		return sleep(ctx, d)
+	}
+
+	return ctx.Err()
+}
+
+// QueryRate limits the queries a resolver sends to perSecond, retries and
+// the queries of an iterative walk included. Cached answers don't count.
+func QueryRate(perSecond float64) OptionFn {
+	return func(p interface{}) {
+		switch r := p.(type) {
+		case *resolver:
+			r.limit = NewLimiter(perSecond)
+		case *iterativeResolver:
+			r.limit = NewLimiter(perSecond)
+		}
+	}
+}
+
+// LimitGrabber returns gr, opening at most perSecond connections per second.
+func LimitGrabber(gr Grabber, perSecond float64) Grabber {
+	return &limitingGrabber{gr, NewLimiter(perSecond)}
+}
+
+type limitingGrabber struct {
+	Grabber
+	limit *Limiter
+}
+
+func (gr *limitingGrabber) Grab(ctx context.Context, addr net.IP, port int, ehlo string, timeout time.Duration) *Transcript {
+	err := gr.limit.Wait(ctx)
+	if err == nil {
+		// the wait took from the time budget of the check
+		var ok bool
+		if timeout, ok = budget(ctx, timeout); !ok {
+			err = ctx.Err()
+			if err == nil {
+				err = context.DeadlineExceeded
+			}
+		}
+	}
+
+	if err != nil {
+		return &Transcript{
+			IP:             addr.String(),
+			Port:           port,
+			Error:          err.Error(),
+			ErrorComponent: "connect",
+		}
+	}
+
+	return gr.Grabber.Grab(ctx, addr, port, ehlo, timeout)
+}
@@ -0,0 +1,43 @@
+package plugins
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// timeoutGrabber returns the timeout it was called with as banner.
+type timeoutGrabber struct{}
+
+func (timeoutGrabber) Grab(ctx context.Context, addr net.IP, port int, ehlo string, timeout time.Duration) *Transcript {
+	return &Transcript{IP: addr.String(), Port: port, Banner: timeout.String()}
+}
+
+func TestLimitGrabber(t *testing.T) {
+	gr := LimitGrabber(timeoutGrabber{}, 10)
+	addr := net.ParseIP("192.0.2.25")
+
+	// the first connection doesn't wait
+	if tr := gr.Grab(context.Background(), addr, 25, "checkmail.test", time.Second); tr.Banner != "1s" {
+		t.Errorf("got %+v, expected a grab with the full timeout", tr)
+	}
+
+	// the second waits 100ms, leaving less than the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	if tr := gr.Grab(ctx, addr, 25, "checkmail.test", time.Second); tr.Error != "" {
+		t.Errorf("got %+v, expected a grab", tr)
+	} else if timeout, _ := time.ParseDuration(tr.Banner); timeout <= 0 || timeout > 200*time.Millisecond {
+		t.Errorf("got timeout %s, expected the time left after waiting", tr.Banner)
+	}
+
+	// the third would wait past the deadline
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if tr := gr.Grab(ctx, addr, 25, "checkmail.test", time.Second); tr.Error == "" || tr.Banner != "" {
+		t.Errorf("got %+v, expected no grab once the time budget is spent", tr)
+	}
+}
@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	dns "github.com/miekg/dns"
@@ -10,8 +11,22 @@ var (
 	_ = Register(MXPlugin)
 )
 
+var (
+	mxHost = Finding{
+		ID:         "MX-HOST",
+		Severity:   SeverityInfo,
+		References: []string{"https://tools.ietf.org/html/rfc5321#section-5.1"},
+	}
+)
+
 func MXPlugin(options ...OptionFn) Plugin {
-	return &mxPlugin{}
+	p := &mxPlugin{}
+
+	for _, optionFn := range options {
+		optionFn(p)
+	}
+
+	return p
 }
 
 type mxPlugin struct {
@@ -21,37 +36,48 @@ func (d *mxPlugin) Name() string {
 	return "MX"
 }
 
-func (p *mxPlugin) Check(domain string) <-chan Issue {
+func (d *mxPlugin) Description() string {
+	return "Lists the mail servers of the domain."
+}
+
+func (d *mxPlugin) Category() Category {
+	return CategoryDNS
+}
+
+func (d *mxPlugin) Requires() []Fact {
+	return []Fact{FactMX}
+}
+
+func (d *mxPlugin) Findings() []Finding {
+	return []Finding{
+		mxHost,
+		FindingLookupError,
+	}
+}
+
+func (p *mxPlugin) Check(ctx context.Context, domain string) <-chan Issue {
 	issuesChan := make(chan Issue)
 
 	go func() {
 		defer close(issuesChan)
 
-		r, err := r.Resolve(fmt.Sprintf("%s.", domain), dns.TypeMX)
-		if err != nil {
-			issuesChan <- Issue{
-				Severity: SeverityError,
-				Message:  fmt.Sprintf("Error retrieving MX records: %s", err.Error()),
-			}
-			return
-		}
+		scan := scanFrom(ctx, domain)
 
-		if r.Rcode != dns.RcodeSuccess {
-			issuesChan <- Issue{
-				Severity: SeverityError,
-				Message:  fmt.Sprintf("Error retrieving MX record: %s", dns.RcodeToString[r.Rcode]),
-			}
+		name := fmt.Sprintf("%s.", domain)
+
+		records, err := scan.MX(ctx)
+		if err != nil {
+			issuesChan <- lookupIssue(domain, "MX", name, dns.TypeMX, err)
 			return
 		}
 
-		for _, a := range r.Answer {
-			if mx, ok := a.(*dns.MX); ok {
-				// todo(nl5887): reverse dns
-				issuesChan <- Issue{
-					Severity: SeverityInfo,
-					Message:  fmt.Sprintf("mail server %s with preference %d", mx.Mx, mx.Preference),
-				}
-			}
+		for _, mx := range records {
+			// todo(nl5887): reverse dns
+			issuesChan <- mxHost.Issue(mx.Mx, fmt.Sprintf("mail server %s with preference %d", mx.Mx, mx.Preference)).
+				With("name", name).
+				With("type", "MX").
+				With("preference", fmt.Sprintf("%d", mx.Preference)).
+				With("record", mx.String())
 		}
 
 	}()
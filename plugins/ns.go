@@ -1,6 +1,7 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	dns "github.com/miekg/dns"
@@ -10,8 +11,22 @@ var (
 	_ = Register(NSPlugin)
 )
 
+var (
+	nsHost = Finding{
+		ID:         "NS-HOST",
+		Severity:   SeverityInfo,
+		References: []string{"https://tools.ietf.org/html/rfc1035#section-3.3.11"},
+	}
+)
+
 func NSPlugin(options ...OptionFn) Plugin {
-	return &nsPlugin{}
+	p := &nsPlugin{}
+
+	for _, optionFn := range options {
+		optionFn(p)
+	}
+
+	return p
 }
 
 type nsPlugin struct {
@@ -21,36 +36,44 @@ func (d *nsPlugin) Name() string {
 	return "NS"
 }
 
-func (p *nsPlugin) Check(domain string) <-chan Issue {
+func (d *nsPlugin) Description() string {
+	return "Lists the nameservers of the domain."
+}
+
+func (d *nsPlugin) Category() Category {
+	return CategoryDNS
+}
+
+func (d *nsPlugin) Findings() []Finding {
+	return []Finding{
+		nsHost,
+		FindingLookupError,
+	}
+}
+
+func (p *nsPlugin) Check(ctx context.Context, domain string) <-chan Issue {
 	issuesChan := make(chan Issue)
 
 	go func() {
 		defer close(issuesChan)
 
-		r, err := r.Resolve(fmt.Sprintf("%s.", domain), dns.TypeNS)
-		if err != nil {
-			issuesChan <- Issue{
-				Severity: SeverityError,
-				Message:  fmt.Sprintf("Error retrieving NS records: %s", err.Error()),
-			}
-			return
-		}
+		scan := scanFrom(ctx, domain)
 
-		if r.Rcode != dns.RcodeSuccess {
-			issuesChan <- Issue{
-				Severity: SeverityError,
-				Message:  fmt.Sprintf("Error retrieving NS record: %s", dns.RcodeToString[r.Rcode]),
-			}
+		name := fmt.Sprintf("%s.", domain)
+
+		r, err := scan.lookup(ctx, name, dns.TypeNS)
+		if err != nil {
+			issuesChan <- lookupIssue(domain, "NS", name, dns.TypeNS, err)
 			return
 		}
 
 		for _, a := range r.Answer {
 			if ns, ok := a.(*dns.NS); ok {
 				// todo(nl5887): reverse dns
-				issuesChan <- Issue{
-					Severity: SeverityInfo,
-					Message:  fmt.Sprintf("found nameserver: %s", ns.Ns),
-				}
+				issuesChan <- nsHost.Issue(ns.Ns, fmt.Sprintf("found nameserver: %s", ns.Ns)).
+					With("name", name).
+					With("type", "NS").
+					With("record", ns.String())
 			}
 		}
 
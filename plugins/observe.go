@@ -0,0 +1,47 @@
+package plugins
+
+import (
+	"context"
+
+	dns "github.com/miekg/dns"
+)
+
+// ObserveFunc is called with the outcome of every lookup.
+type ObserveFunc func(name string, qtype uint16, outcome Outcome)
+
+// ObserveResolver returns res, calling fn with the outcome of every lookup.
+func ObserveResolver(res Resolver, fn ObserveFunc) Resolver {
+	or := &observingResolver{res, fn}
+	if ar, ok := res.(AuthoritativeResolver); ok {
+		return &observingAuthoritativeResolver{or, ar}
+	}
+
+	return or
+}
+
+type observingResolver struct {
+	Resolver
+	fn ObserveFunc
+}
+
+func (r *observingResolver) Resolve(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	msg, err := r.Resolver.Resolve(ctx, name, qtype)
+	r.fn(name, qtype, Classify(msg, err))
+	return msg, err
+}
+
+type observingAuthoritativeResolver struct {
+	*observingResolver
+	ar AuthoritativeResolver
+}
+
+func (r *observingAuthoritativeResolver) ResolveAuthoritative(ctx context.Context, name string, qtype uint16) (*Response, error) {
+	resp, err := r.ar.ResolveAuthoritative(ctx, name, qtype)
+	if err != nil {
+		r.fn(name, qtype, Classify(nil, err))
+		return nil, err
+	}
+
+	r.fn(name, qtype, Classify(resp.Msg, nil))
+	return resp, nil
+}
@@ -0,0 +1,85 @@
+package plugins
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Key returns the key of a plugin name as used in configuration, like
+// "banner-grabbing" for "Banner grabbing".
+func Key(name string) string {
+	return strings.Replace(strings.ToLower(strings.TrimSpace(name)), " ", "-", -1)
+}
+
+// Selectors sets the selectors checked by the DKIM plugin.
+func Selectors(selectors ...string) OptionFn {
+	return func(p interface{}) {
+		if p, ok := p.(*dkimPlugin); ok {
+			p.selectors = selectors
+		}
+	}
+}
+
+// Ports sets the ports the banner grabbing plugin connects to.
+func Ports(ports ...int) OptionFn {
+	return func(p interface{}) {
+		if p, ok := p.(*grabPlugin); ok {
+			p.ports = ports
+		}
+	}
+}
+
+// EHLO sets the name the banner grabbing plugin uses to introduce itself.
+func EHLO(name string) OptionFn {
+	return func(p interface{}) {
+		if p, ok := p.(*grabPlugin); ok {
+			p.ehlo = name
+		}
+	}
+}
+
+// SMTPTimeout sets the timeout of a single connection of the banner grabbing
+// plugin.
+func SMTPTimeout(timeout time.Duration) OptionFn {
+	return func(p interface{}) {
+		if p, ok := p.(*grabPlugin); ok {
+			p.timeout = timeout
+		}
+	}
+}
+
+// Matches returns whether plugin p is selected by one of selectors, where a
+// selector is either a plugin key, plugin name or category.
+func Matches(p Plugin, selectors []string) bool {
+	for _, selector := range selectors {
+		switch Key(selector) {
+		case Key(p.Name()), string(p.Category()):
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateSelectors returns an error for the first selector not matching any
+// registered plugin or category.
+func ValidateSelectors(selectors []string) error {
+	for _, selector := range selectors {
+		found := false
+
+		for _, category := range Categories {
+			found = found || Key(selector) == string(category)
+		}
+
+		for _, fn := range Plugins {
+			found = found || Matches(fn(), []string{selector})
+		}
+
+		if !found {
+			return fmt.Errorf("Unknown plugin or category: %s", selector)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	dns "github.com/miekg/dns"
+)
+
+// Outcome classifies the result of a lookup.
+type Outcome string
+
+const (
+	OutcomeSuccess   Outcome = "SUCCESS"
+	OutcomeNoData    Outcome = "NODATA"
+	OutcomeNXDomain  Outcome = "NXDOMAIN"
+	OutcomeServFail  Outcome = "SERVFAIL"
+	OutcomeRefused   Outcome = "REFUSED"
+	OutcomeTimeout   Outcome = "TIMEOUT"
+	OutcomeTruncated Outcome = "TRUNCATED"
+
+	// OutcomeBroken is a lookup the nameservers of the domain could not
+	// answer, like a query rejected with NOTIMP or FORMERR or a lame
+	// delegation. It is a finding about the domain, unlike OutcomeError.
+	OutcomeBroken Outcome = "BROKEN"
+
+	// OutcomeError is a lookup failing because of the resolver or the
+	// network.
+	OutcomeError Outcome = "ERROR"
+)
+
+// hint explains what an outcome usually means.
+func (o Outcome) hint() string {
+	switch o {
+	case OutcomeServFail:
+		return "possible broken DNSSEC or unreachable nameservers"
+	case OutcomeRefused:
+		return "nameserver refuses to answer, possible lame delegation"
+	case OutcomeTimeout:
+		return "nameservers did not respond in time"
+	case OutcomeTruncated:
+		return "answer truncated and TCP fallback failed"
+	case OutcomeBroken:
+		return "nameservers of the domain are broken or misconfigured"
+	}
+
+	return ""
+}
+
+// errTruncated is returned when a truncated answer could not be retrieved
+// over TCP.
+var errTruncated = errors.New("truncated answer, TCP fallback failed")
+
+// errLame is wrapped by the errors of delegations that cannot be followed.
+var errLame = errors.New("lame delegation")
+
+// Classify returns the outcome of a lookup answered with msg or failed with
+// err.
+func Classify(msg *dns.Msg, err error) Outcome {
+	if err != nil {
+		var le *LookupError
+		if errors.As(err, &le) {
+			return le.Outcome
+		}
+
+		var ne net.Error
+		switch {
+		case errors.Is(err, errTruncated):
+			return OutcomeTruncated
+		case errors.Is(err, errLame):
+			return OutcomeBroken
+		case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+			return OutcomeTimeout
+		case errors.As(err, &ne) && ne.Timeout():
+			return OutcomeTimeout
+		}
+
+		return OutcomeError
+	}
+
+	switch msg.Rcode {
+	case dns.RcodeSuccess:
+		if len(msg.Answer) == 0 {
+			return OutcomeNoData
+		}
+
+		return OutcomeSuccess
+	case dns.RcodeNameError:
+		return OutcomeNXDomain
+	case dns.RcodeServerFailure:
+		return OutcomeServFail
+	case dns.RcodeRefused:
+		return OutcomeRefused
+	case dns.RcodeNotImplemented, dns.RcodeFormatError:
+		return OutcomeBroken
+	}
+
+	return OutcomeError
+}
+
+// LookupError is returned for lookups that did not result in an answer.
+type LookupError struct {
+	Name    string
+	Type    uint16
+	Outcome Outcome
+
+	// Rcode is the rcode of the answer, if any.
+	Rcode int
+
+	// Err is the underlying error, nil when an answer was received.
+	Err error
+}
+
+func (e *LookupError) Error() string {
+	str := string(e.Outcome)
+	if (e.Outcome == OutcomeError || e.Outcome == OutcomeBroken) && e.Rcode != dns.RcodeSuccess {
+		str = dns.RcodeToString[e.Rcode]
+	}
+
+	if e.Err != nil {
+		str = fmt.Sprintf("%s: %s", str, e.Err.Error())
+	}
+
+	if hint := e.Outcome.hint(); hint != "" {
+		str = fmt.Sprintf("%s (%s)", str, hint)
+	}
+
+	return str
+}
+
+func (e *LookupError) Unwrap() error {
+	return e.Err
+}
+
+// NotFound returns whether the looked up name or record does not exist.
+func (e *LookupError) NotFound() bool {
+	return e.Outcome == OutcomeNXDomain || e.Outcome == OutcomeNoData
+}
+
+// IsNotFound returns whether err is a lookup error for a name or record that
+// does not exist.
+func IsNotFound(err error) bool {
+	var le *LookupError
+	return errors.As(err, &le) && le.NotFound()
+}
+
+// lookupError returns the error for a lookup of name and type t, either
+// failed with err or answered with a non success msg.
+func lookupError(name string, t uint16, msg *dns.Msg, err error) error {
+	if err != nil {
+		var le *LookupError
+		if errors.As(err, &le) {
+			return err
+		}
+	}
+
+	outcome := Classify(msg, err)
+	if outcome == OutcomeSuccess || outcome == OutcomeNoData {
+		return nil
+	}
+
+	le := &LookupError{
+		Name:    name,
+		Type:    t,
+		Outcome: outcome,
+		Err:     err,
+	}
+
+	if msg != nil {
+		le.Rcode = msg.Rcode
+	}
+
+	return le
+}
+
+// isContextError returns whether err was caused by a done context.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// RetryPolicy determines how often and how fast failed queries are retried.
+// Only transient failures are retried, an NXDOMAIN will not go away by asking
+// again.
+type RetryPolicy struct {
+	// Attempts is the total number of attempts, including the first.
+	Attempts int
+
+	// Backoff is the delay before the first retry, doubled on every next
+	// retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   4,
+	Backoff:    100 * time.Millisecond,
+	MaxBackoff: 2 * time.Second,
+}
+
+// Retryable returns whether a query with outcome should be retried.
+func (p RetryPolicy) Retryable(outcome Outcome) bool {
+	switch outcome {
+	case OutcomeTimeout, OutcomeServFail, OutcomeTruncated, OutcomeError:
+		return true
+	}
+
+	return false
+}
+
+// Delay returns the backoff before retry attempt (1 for the first retry).
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	return d
+}
+
+// Retry sets the retry policy of a resolver.
+func Retry(policy RetryPolicy) OptionFn {
+	return func(p interface{}) {
+		if r, ok := p.(*resolver); ok && policy.Attempts > 0 {
+			r.retry = policy
+		}
+	}
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// lookupIssue returns the issue for a lookup of name that failed with err,
+// what names the records looked up, like "DMARC".
+func lookupIssue(domain, what, name string, t uint16, err error) Issue {
+	issue := FindingLookupError.Issue(domain, fmt.Sprintf("%s lookup %s", what, err.Error())).
+		With("name", name).
+		With("type", dns.TypeToString[t]).
+		With("outcome", string(Classify(nil, err)))
+
+	var le *LookupError
+	if errors.As(err, &le) && le.Err == nil {
+		issue = issue.With("rcode", dns.RcodeToString[le.Rcode])
+	}
+
+	return issue
+}
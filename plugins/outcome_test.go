@@ -0,0 +1,46 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	dns "github.com/miekg/dns"
+)
+
+func TestClassify(t *testing.T) {
+	answer := func(rcode int) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeTXT)
+		m.Rcode = rcode
+		return m
+	}
+
+	for i, tt := range []struct {
+		msg       *dns.Msg
+		err       error
+		outcome   Outcome
+		retryable bool
+	}{
+		{answer(dns.RcodeSuccess), nil, OutcomeNoData, false},
+		{answer(dns.RcodeNameError), nil, OutcomeNXDomain, false},
+		{answer(dns.RcodeServerFailure), nil, OutcomeServFail, true},
+		{answer(dns.RcodeRefused), nil, OutcomeRefused, false},
+		{answer(dns.RcodeNotImplemented), nil, OutcomeBroken, false},
+		{answer(dns.RcodeFormatError), nil, OutcomeBroken, false},
+		{nil, fmt.Errorf("%w: 192.0.2.53 answered neither authoritative nor with a referral", errLame), OutcomeBroken, false},
+		{nil, context.DeadlineExceeded, OutcomeTimeout, true},
+		{nil, errTruncated, OutcomeTruncated, true},
+		{nil, errors.New("connection refused"), OutcomeError, true},
+	} {
+		outcome := Classify(tt.msg, tt.err)
+		if outcome != tt.outcome {
+			t.Errorf("%d: got outcome %s, expected %s", i, outcome, tt.outcome)
+		}
+
+		if retryable := DefaultRetryPolicy.Retryable(outcome); retryable != tt.retryable {
+			t.Errorf("%s: got retryable %t, expected %t", outcome, retryable, tt.retryable)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package plugins
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	"github.com/op/go-logging"
 )
 
@@ -10,11 +14,36 @@ type Plugin interface {
 	// Gather(domain string) (Result, error)
 	Name() string
 
-	Check(domain string) <-chan Issue
+	// Description returns a one line description of what is checked.
+	Description() string
+
+	Category() Category
+
+	// Findings returns all findings the plugin can report.
+	Findings() []Finding
+
+	// Check runs the plugin against domain. Implementations should stop
+	// and close the returned channel once ctx is done.
+	Check(ctx context.Context, domain string) <-chan Issue
 }
 
 type OptionFn func(interface{})
 
+// Category groups plugins checking related parts of the configuration.
+type Category string
+
+const (
+	CategoryAuthentication Category = "authentication"
+	CategoryTransport      Category = "transport"
+	CategoryDNS            Category = "dns"
+)
+
+var Categories = []Category{
+	CategoryAuthentication,
+	CategoryTransport,
+	CategoryDNS,
+}
+
 type Severity string
 
 const (
@@ -25,12 +54,94 @@ const (
 	SeverityOK      Severity = "OK"
 )
 
+var severityRank = map[Severity]int{
+	SeverityError:   3,
+	SeverityWarning: 2,
+	SeverityInfo:    1,
+	SeverityOK:      1,
+	SeverityDebug:   0,
+}
+
+// AtLeast returns whether s is as severe as other, or more.
+func (s Severity) AtLeast(other Severity) bool {
+	return severityRank[s] >= severityRank[other]
+}
+
+// ParseSeverity parses a severity, case insensitive.
+func ParseSeverity(str string) (Severity, error) {
+	s := Severity(strings.ToUpper(str))
+	if _, ok := severityRank[s]; !ok {
+		return "", fmt.Errorf("Unknown severity: %s", str)
+	}
+
+	return s, nil
+}
+
+// Issue is a single finding of a plugin for a target. Target is the domain
+// being checked, unless the finding is about something more specific like a
+// mail server or an address.
 type Issue struct {
-	Severity    Severity
-	Message     string
-	Description string
+	ID          string            `json:"id"`
+	Plugin      string            `json:"plugin"`
+	Target      string            `json:"target"`
+	Severity    Severity          `json:"severity"`
+	Message     string            `json:"message"`
+	Description string            `json:"description,omitempty"`
+	Remediation string            `json:"remediation,omitempty"`
+	References  []string          `json:"references,omitempty"`
+	Evidence    map[string]string `json:"evidence,omitempty"`
+}
+
+// With returns a copy of the issue with key set to value in its evidence.
+func (i Issue) With(key, value string) Issue {
+	evidence := map[string]string{}
+	for k, v := range i.Evidence {
+		evidence[k] = v
+	}
+
+	evidence[key] = value
+
+	i.Evidence = evidence
+	return i
 }
 
+// Finding describes a kind of issue a plugin can report. The ID is stable
+// and can be used to key suppressions, dashboards and tickets on.
+type Finding struct {
+	ID          string   `json:"id"`
+	Severity    Severity `json:"severity"`
+	Description string   `json:"description,omitempty"`
+	Remediation string   `json:"remediation,omitempty"`
+	References  []string `json:"references,omitempty"`
+}
+
+// Issue returns an issue of this finding for target.
+func (f Finding) Issue(target string, message string) Issue {
+	return Issue{
+		ID:          f.ID,
+		Target:      target,
+		Severity:    f.Severity,
+		Message:     message,
+		Description: f.Description,
+		Remediation: f.Remediation,
+		References:  f.References,
+	}
+}
+
+// Findings shared by all plugins.
+var (
+	FindingTimeout = Finding{
+		ID:          "CHECK-TIMEOUT",
+		Severity:    SeverityError,
+		Remediation: "Increase the time budget of the check or verify the reachability of the servers involved.",
+	}
+	FindingLookupError = Finding{
+		ID:          "DNS-LOOKUP-ERROR",
+		Severity:    SeverityError,
+		Remediation: "Verify the resolver is reachable and the authoritative nameservers of the domain respond.",
+	}
+)
+
 var Plugins []PluginFn = []PluginFn{}
 
 type PluginFn func(...OptionFn) Plugin
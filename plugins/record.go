@@ -0,0 +1,402 @@
+package plugins
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	dns "github.com/miekg/dns"
+)
+
+// A fixture bundle is a directory holding every DNS exchange and SMTP
+// transcript of a scan, one JSON object per line, so scans can be replayed
+// offline.
+const (
+	bundleManifest    = "manifest.json"
+	bundleDNS         = "dns.ndjson"
+	bundleTranscripts = "smtp.ndjson"
+)
+
+type manifest struct {
+	Created time.Time `json:"created"`
+}
+
+// recording is a recorded DNS exchange.
+type recording struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// Authoritative exchanges were answered by Server, authoritative
+	// for Zone.
+	Authoritative bool   `json:"authoritative,omitempty"`
+	Server        string `json:"server,omitempty"`
+	Zone          string `json:"zone,omitempty"`
+
+	// Msg is the answer in wire format, Text the same answer in
+	// presentation format for humans reading the bundle.
+	Msg  []byte `json:"msg,omitempty"`
+	Text string `json:"text,omitempty"`
+
+	Outcome Outcome `json:"outcome"`
+	Error   string  `json:"error,omitempty"`
+}
+
+func recordingKey(authoritative bool, name string, qtype uint16) string {
+	return fmt.Sprintf("%t %s %d", authoritative, strings.ToLower(dns.Fqdn(name)), qtype)
+}
+
+func transcriptKey(addr string, port int) string {
+	return net.JoinHostPort(addr, fmt.Sprintf("%d", port))
+}
+
+// Recorder writes DNS exchanges and SMTP transcripts to a fixture bundle.
+type Recorder struct {
+	m sync.Mutex
+
+	dns         *os.File
+	transcripts *os.File
+}
+
+// NewRecorder returns a recorder writing a fixture bundle to dir, replacing
+// an earlier recording.
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest{Created: time.Now().UTC()}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, bundleManifest), data, 0644); err != nil {
+		return nil, err
+	}
+
+	rec := &Recorder{}
+
+	if rec.dns, err = os.Create(filepath.Join(dir, bundleDNS)); err != nil {
+		return nil, err
+	}
+
+	if rec.transcripts, err = os.Create(filepath.Join(dir, bundleTranscripts)); err != nil {
+		rec.dns.Close()
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// Close closes the bundle.
+func (rec *Recorder) Close() error {
+	err := rec.dns.Close()
+	if terr := rec.transcripts.Close(); err == nil {
+		err = terr
+	}
+
+	return err
+}
+
+func (rec *Recorder) write(f *os.File, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("Error recording: %s", err.Error())
+		return
+	}
+
+	rec.m.Lock()
+	defer rec.m.Unlock()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Errorf("Error recording: %s", err.Error())
+	}
+}
+
+func (rec *Recorder) record(authoritative bool, name string, qtype uint16, msg *dns.Msg, err error) {
+	if isContextError(err) {
+		// aborted lookups say nothing about the domain
+		return
+	}
+
+	e := recording{
+		Name:          strings.ToLower(dns.Fqdn(name)),
+		Type:          dns.TypeToString[qtype],
+		Authoritative: authoritative,
+		Outcome:       Classify(msg, err),
+	}
+
+	if err != nil {
+		var le *LookupError
+		if errors.As(err, &le) && le.Err != nil {
+			err = le.Err
+		}
+
+		e.Error = err.Error()
+	} else {
+		data, perr := msg.Pack()
+		if perr != nil {
+			log.Errorf("Error recording %s %s: %s", e.Name, e.Type, perr.Error())
+			return
+		}
+
+		e.Msg = data
+		e.Text = msg.String()
+	}
+
+	rec.write(rec.dns, e)
+}
+
+// Resolver returns res, recording every exchange.
+func (rec *Recorder) Resolver(res Resolver) Resolver {
+	rr := &recordingResolver{res, rec}
+	if ar, ok := res.(AuthoritativeResolver); ok {
+		return &recordingAuthoritativeResolver{rr, ar}
+	}
+
+	return rr
+}
+
+// Grabber returns gr, recording every transcript.
+func (rec *Recorder) Grabber(gr Grabber) Grabber {
+	return &recordingGrabber{gr, rec}
+}
+
+type recordingResolver struct {
+	Resolver
+	rec *Recorder
+}
+
+func (r *recordingResolver) Resolve(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	msg, err := r.Resolver.Resolve(ctx, name, qtype)
+	r.rec.record(false, name, qtype, msg, err)
+	return msg, err
+}
+
+type recordingAuthoritativeResolver struct {
+	*recordingResolver
+	ar AuthoritativeResolver
+}
+
+func (r *recordingAuthoritativeResolver) ResolveAuthoritative(ctx context.Context, name string, qtype uint16) (*Response, error) {
+	resp, err := r.ar.ResolveAuthoritative(ctx, name, qtype)
+	if err != nil {
+		r.rec.record(true, name, qtype, nil, err)
+		return nil, err
+	}
+
+	data, perr := resp.Msg.Pack()
+	if perr != nil {
+		log.Errorf("Error recording %s %s: %s", name, dns.TypeToString[qtype], perr.Error())
+		return resp, nil
+	}
+
+	r.rec.write(r.rec.dns, recording{
+		Name:          strings.ToLower(dns.Fqdn(name)),
+		Type:          dns.TypeToString[qtype],
+		Authoritative: true,
+		Server:        resp.Server,
+		Zone:          resp.Zone,
+		Msg:           data,
+		Text:          resp.Msg.String(),
+		Outcome:       Classify(resp.Msg, nil),
+	})
+
+	return resp, nil
+}
+
+type recordingGrabber struct {
+	Grabber
+	rec *Recorder
+}
+
+func (gr *recordingGrabber) Grab(ctx context.Context, addr net.IP, port int, ehlo string, timeout time.Duration) *Transcript {
+	t := gr.Grabber.Grab(ctx, addr, port, ehlo, timeout)
+	gr.rec.write(gr.rec.transcripts, t)
+	return t
+}
+
+// Replayer serves the DNS exchanges and SMTP transcripts of a fixture bundle,
+// without any network access.
+type Replayer struct {
+	exchanges     map[string]recording
+	transcripts   map[string]*Transcript
+	authoritative bool
+}
+
+// NewReplayer returns a replayer of the fixture bundle in dir.
+func NewReplayer(dir string) (*Replayer, error) {
+	if _, err := os.Stat(filepath.Join(dir, bundleManifest)); err != nil {
+		return nil, fmt.Errorf("Not a recording: %s", err.Error())
+	}
+
+	rp := &Replayer{
+		exchanges:   map[string]recording{},
+		transcripts: map[string]*Transcript{},
+	}
+
+	err := readLines(filepath.Join(dir, bundleDNS), func(data []byte) error {
+		e := recording{}
+		if err := json.Unmarshal(data, &e); err != nil {
+			return err
+		}
+
+		qtype, ok := dns.StringToType[e.Type]
+		if !ok {
+			return fmt.Errorf("unknown type %s", e.Type)
+		}
+
+		key := recordingKey(e.Authoritative, e.Name, qtype)
+		if _, ok := rp.exchanges[key]; !ok {
+			rp.exchanges[key] = e
+		}
+
+		rp.authoritative = rp.authoritative || e.Authoritative
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readLines(filepath.Join(dir, bundleTranscripts), func(data []byte) error {
+		t := &Transcript{}
+		if err := json.Unmarshal(data, t); err != nil {
+			return err
+		}
+
+		key := transcriptKey(t.IP, t.Port)
+		if _, ok := rp.transcripts[key]; !ok {
+			rp.transcripts[key] = t
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rp, nil
+}
+
+// readLines calls fn for every non empty line of path.
+func readLines(path string, fn func([]byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for i := 1; scanner.Scan(); i++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		if err := fn(scanner.Bytes()); err != nil {
+			return fmt.Errorf("%s:%d: %s", path, i, err.Error())
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Resolver returns a resolver answering from the recording. It resolves
+// authoritatively when the recording was made by an iterative resolver.
+func (rp *Replayer) Resolver() Resolver {
+	rr := &replayResolver{rp}
+	if rp.authoritative {
+		return &replayAuthoritativeResolver{rr}
+	}
+
+	return rr
+}
+
+// Grabber returns a grabber answering from the recording.
+func (rp *Replayer) Grabber() Grabber {
+	return &replayGrabber{rp}
+}
+
+// replay returns the recorded answer of a query.
+func (rp *Replayer) replay(authoritative bool, name string, qtype uint16) (recording, *dns.Msg, error) {
+	name = strings.ToLower(dns.Fqdn(name))
+
+	e, ok := rp.exchanges[recordingKey(authoritative, name, qtype)]
+	if !ok {
+		return e, nil, &LookupError{
+			Name:    name,
+			Type:    qtype,
+			Outcome: OutcomeError,
+			Err:     fmt.Errorf("no recorded answer for %s %s", name, dns.TypeToString[qtype]),
+		}
+	}
+
+	if e.Msg == nil {
+		return e, nil, &LookupError{
+			Name:    name,
+			Type:    qtype,
+			Outcome: e.Outcome,
+			Err:     errors.New(e.Error),
+		}
+	}
+
+	msg := &dns.Msg{}
+	if err := msg.Unpack(e.Msg); err != nil {
+		return e, nil, err
+	}
+
+	return e, msg, nil
+}
+
+type replayResolver struct {
+	rp *Replayer
+}
+
+func (r *replayResolver) Resolve(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	_, msg, err := r.rp.replay(false, name, qtype)
+	return msg, err
+}
+
+type replayAuthoritativeResolver struct {
+	*replayResolver
+}
+
+func (r *replayAuthoritativeResolver) ResolveAuthoritative(ctx context.Context, name string, qtype uint16) (*Response, error) {
+	e, msg, err := r.rp.replay(true, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{
+		Msg:    msg,
+		Server: e.Server,
+		Zone:   e.Zone,
+	}, nil
+}
+
+type replayGrabber struct {
+	rp *Replayer
+}
+
+func (gr *replayGrabber) Grab(ctx context.Context, addr net.IP, port int, ehlo string, timeout time.Duration) *Transcript {
+	if t, ok := gr.rp.transcripts[transcriptKey(addr.String(), port)]; ok {
+		return t
+	}
+
+	return &Transcript{
+		IP:             addr.String(),
+		Port:           port,
+		Error:          "no recorded transcript",
+		ErrorComponent: "replay",
+	}
+}
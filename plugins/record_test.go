@@ -0,0 +1,170 @@
+package plugins
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	dns "github.com/miekg/dns"
+)
+
+// stubResolver answers from a fixed set of answers, and authoritatively as
+// ns1.example.com for example.com.
+type stubResolver map[string]*dns.Msg
+
+func (r stubResolver) Resolve(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	msg, ok := r[dns.Fqdn(name)]
+	if !ok {
+		return nil, &LookupError{Name: name, Type: qtype, Outcome: OutcomeServFail, Rcode: dns.RcodeServerFailure}
+	}
+
+	return msg, nil
+}
+
+func (r stubResolver) ResolveAuthoritative(ctx context.Context, name string, qtype uint16) (*Response, error) {
+	msg, err := r.Resolve(ctx, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{Msg: msg, Server: "192.0.2.53:53", Zone: "example.com."}, nil
+}
+
+// stubGrabber returns a transcript with the banner for every address.
+type stubGrabber string
+
+func (gr stubGrabber) Grab(ctx context.Context, addr net.IP, port int, ehlo string, timeout time.Duration) *Transcript {
+	return &Transcript{
+		IP:     addr.String(),
+		Port:   port,
+		Banner: string(gr),
+		EHLO:   "250-" + ehlo + "\r\n250 STARTTLS",
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	txt := new(dns.Msg)
+	txt.SetQuestion("example.com.", dns.TypeTXT)
+	txt.Response = true
+	txt.Answer = append(txt.Answer, &dns.TXT{
+		Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+		Txt: []string{"v=spf1 -all"},
+	})
+
+	nx := new(dns.Msg)
+	nx.SetQuestion("missing.example.com.", dns.TypeA)
+	nx.Response = true
+	nx.Rcode = dns.RcodeNameError
+
+	stub := stubResolver{
+		"example.com.":         txt,
+		"missing.example.com.": nx,
+	}
+
+	rec, err := NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := rec.Resolver(stub).(AuthoritativeResolver)
+	gr := rec.Grabber(stubGrabber("220 mail.example.com ESMTP"))
+
+	ctx := context.Background()
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	res.Resolve(ctx, "example.com", dns.TypeTXT)
+	res.Resolve(ctx, "missing.example.com", dns.TypeA)
+	res.Resolve(ctx, "broken.example.com", dns.TypeMX)
+	res.Resolve(canceled, "aborted.example.com", dns.TypeA)
+	res.ResolveAuthoritative(ctx, "example.com", dns.TypeTXT)
+
+	transcript := gr.Grab(ctx, net.ParseIP("192.0.2.25"), 25, "checkmail.test", time.Second)
+
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rp, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay, ok := rp.Resolver().(AuthoritativeResolver)
+	if !ok {
+		t.Fatal("expected an authoritative resolver replaying an authoritative recording")
+	}
+
+	for _, tt := range []struct {
+		name    string
+		qtype   uint16
+		msg     *dns.Msg
+		outcome Outcome
+	}{
+		{"example.com", dns.TypeTXT, txt, OutcomeSuccess},
+		{"Missing.Example.com.", dns.TypeA, nx, OutcomeNXDomain},
+		{"broken.example.com", dns.TypeMX, nil, OutcomeServFail},
+		// aborted lookups are not recorded
+		{"aborted.example.com", dns.TypeA, nil, OutcomeError},
+		{"example.com", dns.TypeMX, nil, OutcomeError},
+	} {
+		msg, err := replay.Resolve(ctx, tt.name, tt.qtype)
+		if outcome := Classify(msg, err); outcome != tt.outcome {
+			t.Errorf("%s %s: got outcome %s, expected %s", tt.name, dns.TypeToString[tt.qtype], outcome, tt.outcome)
+		}
+
+		if tt.msg != nil && (msg == nil || msg.String() != tt.msg.String()) {
+			t.Errorf("%s %s: got %v, expected %v", tt.name, dns.TypeToString[tt.qtype], msg, tt.msg)
+		}
+	}
+
+	resp, err := replay.ResolveAuthoritative(ctx, "example.com", dns.TypeTXT)
+	if err != nil {
+		t.Fatal(err)
+	} else if resp.Server != "192.0.2.53:53" || resp.Zone != "example.com." || resp.Msg.String() != txt.String() {
+		t.Errorf("got authoritative answer of %s for %s, expected of 192.0.2.53:53 for example.com.", resp.Server, resp.Zone)
+	}
+
+	if _, err := replay.ResolveAuthoritative(ctx, "missing.example.com", dns.TypeA); err == nil {
+		t.Errorf("missing.example.com A: got authoritative answer, expected not recorded")
+	}
+
+	grab := rp.Grabber()
+
+	if t2 := grab.Grab(ctx, net.ParseIP("192.0.2.25"), 25, "other.test", time.Second); !reflect.DeepEqual(t2, transcript) {
+		t.Errorf("got transcript %+v, expected %+v", t2, transcript)
+	}
+
+	if t2 := grab.Grab(ctx, net.ParseIP("192.0.2.25"), 587, "checkmail.test", time.Second); t2.ErrorComponent != "replay" {
+		t.Errorf("got transcript %+v, expected no recorded transcript", t2)
+	}
+}
+
+func TestReplayerNotARecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if _, err := NewReplayer(dir); err == nil {
+		t.Errorf("expected an error replaying a directory without recording")
+	}
+}
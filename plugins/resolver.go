@@ -1,98 +1,298 @@
 package plugins
 
 import (
-	dns "github.com/miekg/dns"
-	"math/rand"
+	"context"
+	"fmt"
 	"net"
+	"time"
+
+	dns "github.com/miekg/dns"
 )
 
 var (
-	r = Resolver()
+	r = defaultResolver()
+)
+
+const (
+	// DefaultConcurrency is the default number of queries in flight.
+	DefaultConcurrency = 32
+
+	// DefaultBufSize is the default EDNS0 UDP buffer size, as recommended
+	// by DNS flag day 2020 to prevent fragmentation.
+	DefaultBufSize = 1232
 )
 
-func Question(z string, t uint16) question {
-	return question{
-		z:          z,
-		t:          t,
-		resultChan: make(chan *dns.Msg),
-		errorChan:  make(chan error),
+// Resolver resolves DNS questions, returning the answer as is.
+type Resolver interface {
+	Resolve(ctx context.Context, name string, qtype uint16) (*dns.Msg, error)
+}
+
+// SetResolver sets the resolver used by all plugins.
+func SetResolver(res Resolver) {
+	r = res
+}
+
+func defaultResolver() Resolver {
+	res, err := SystemResolver()
+	if err != nil {
+		return errResolver{err}
 	}
+
+	return res
 }
 
-type question struct {
-	z string
-	t uint16
+// errResolver fails every query, it is used when no resolver could be
+// configured.
+type errResolver struct {
+	err error
+}
 
-	resultChan chan *dns.Msg
-	errorChan  chan error
+func (r errResolver) Resolve(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	return nil, r.err
 }
 
-func Resolver() *resolver {
-	conf, _ := dns.ClientConfigFromFile("/etc/resolv.conf")
+// NewResolver returns a resolver for specs. A spec is either "system" for the
+// servers of /etc/resolv.conf, a plain DNS server (9.9.9.9 or 9.9.9.9:53), a
+// DNS-over-TLS server (tls://1.1.1.1#cloudflare-dns.com) or a DNS-over-HTTPS
+// url (https://dns.google/dns-query).
+func NewResolver(specs []string, options ...OptionFn) (Resolver, error) {
+	if len(specs) == 1 && specs[0] == "system" {
+		return SystemResolver(options...)
+	}
 
-	c := new(dns.Client)
-	c.Net = "tcp"
+	res := newResolver(options...)
 
-	queue := make(chan question)
+	for _, spec := range specs {
+		u, err := parseUpstream(spec, res.bufSize)
+		if err != nil {
+			return nil, err
+		}
 
-	go func() {
-		for {
-			question := <-queue
-
-			func() {
-				retry := 0
-				for {
-					m := new(dns.Msg)
-					m.SetQuestion(question.z, question.t)
-
-					i := rand.Intn(len(conf.Servers))
-
-					r, _, err := c.Exchange(m, net.JoinHostPort(conf.Servers[i], conf.Port))
-					if err != nil {
-						if retry > 5 {
-							question.errorChan <- err
-							return
-						}
-
-						retry++
-						continue
-					}
-
-					/*
-						if r.Rcode != dns.RcodeSuccess {
-							issuesChan <- Issue{
-								Severity: SeverityError,
-								Message:  fmt.Sprintf("Error retrieving DNSKey record: %s", dns.RcodeToString[r.Rcode]),
-							}
-							return
-						}
-					*/
-
-					question.resultChan <- r
-					return
-				}
-			}()
+		res.upstreams = append(res.upstreams, u)
+	}
+
+	if len(res.upstreams) == 0 {
+		return nil, fmt.Errorf("No resolvers configured")
+	}
+
+	return res, nil
+}
+
+// SystemResolver returns a resolver for the servers in /etc/resolv.conf.
+func SystemResolver(options ...OptionFn) (Resolver, error) {
+	conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return nil, err
+	}
+
+	servers := []string{}
+	for _, server := range conf.Servers {
+		servers = append(servers, net.JoinHostPort(server, conf.Port))
+	}
+
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("No nameservers in /etc/resolv.conf")
+	}
+
+	return ServerResolver(servers, options...), nil
+}
+
+// ServerResolver returns a resolver querying servers, given as host or
+// host:port, over plain DNS.
+func ServerResolver(servers []string, options ...OptionFn) Resolver {
+	res := newResolver(options...)
+
+	for _, server := range servers {
+		res.upstreams = append(res.upstreams, &dnsUpstream{
+			addr:    withPort(server, "53"),
+			bufSize: res.bufSize,
+		})
+	}
+
+	return res
+}
+
+// TLSResolver returns a resolver querying servers using DNS-over-TLS. Servers
+// are given as host, host:port or host:port#servername.
+func TLSResolver(servers []string, options ...OptionFn) (Resolver, error) {
+	specs := []string{}
+	for _, server := range servers {
+		specs = append(specs, "tls://"+server)
+	}
+
+	return NewResolver(specs, options...)
+}
+
+// HTTPSResolver returns a resolver querying the DNS-over-HTTPS urls.
+func HTTPSResolver(urls []string, options ...OptionFn) (Resolver, error) {
+	return NewResolver(urls, options...)
+}
+
+func newResolver(options ...OptionFn) *resolver {
+	res := &resolver{
+		concurrency: DefaultConcurrency,
+		bufSize:     DefaultBufSize,
+		retry:       DefaultRetryPolicy,
+		cache:       newCache(maxCacheEntries),
+		flights:     newFlights(),
+	}
+
+	for _, optionFn := range options {
+		optionFn(res)
+	}
+
+	res.sem = make(chan struct{}, res.concurrency)
+	return res
+}
+
+// Concurrency sets the maximum number of queries a resolver has in flight.
+func Concurrency(n int) OptionFn {
+	return func(p interface{}) {
+		if n <= 0 {
+			return
+		}
+
+		switch r := p.(type) {
+		case *resolver:
+			r.concurrency = n
+		case *iterativeResolver:
+			r.concurrency = n
+		}
+	}
+}
+
+// BufSize sets the EDNS0 UDP buffer size a resolver advertises.
+func BufSize(size uint16) OptionFn {
+	return func(p interface{}) {
+		if size < dns.MinMsgSize {
+			return
+		}
+
+		switch r := p.(type) {
+		case *resolver:
+			r.bufSize = size
+		case *iterativeResolver:
+			r.bufSize = size
 		}
+	}
+}
+
+// exchange sends m to addr using c, but returns as soon as ctx is done. The
+// timeout of the exchange is capped to the deadline of ctx, so an abandoned
+// exchange does not linger.
+func exchange(ctx context.Context, c *dns.Client, m *dns.Msg, addr string) (*dns.Msg, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+
+		c = &dns.Client{
+			Net:       c.Net,
+			UDPSize:   c.UDPSize,
+			TLSConfig: c.TLSConfig,
+			Timeout:   timeout,
+		}
+	}
+
+	type result struct {
+		msg *dns.Msg
+		err error
+	}
+
+	resultChan := make(chan result, 1)
+
+	go func() {
+		msg, _, err := c.Exchange(m, addr)
+		resultChan <- result{msg, err}
 	}()
 
-	return &resolver{
-		queue: queue,
+	select {
+	case result := <-resultChan:
+		return result.msg, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
+// resolver sends queries to its upstreams, in order, moving to the next
+// upstream when one fails transiently. The number of queries in flight is
+// bounded and answers are cached. Answers are returned whatever their rcode,
+// failures to get an answer are returned as LookupError.
 type resolver struct {
-	queue chan question
+	upstreams []upstream
+
+	concurrency int
+	bufSize     uint16
+
+	// sem bounds the number of queries in flight
+	sem chan struct{}
+
+	retry RetryPolicy
+
+	// limit spaces the queries, if set
+	limit *Limiter
+
+	cache *cache
+
+	// flights shares lookups in flight
+	flights *flights
 }
 
-func (r *resolver) Resolve(z string, t uint16) (*dns.Msg, error) {
-	question := Question(z, t)
+func (r *resolver) Resolve(ctx context.Context, z string, t uint16) (*dns.Msg, error) {
+	if msg := r.cache.Get(z, t); msg != nil {
+		return msg, nil
+	}
+
+	return r.flights.Do(ctx, z, t, func() (*dns.Msg, error) {
+		return r.resolve(ctx, z, t)
+	})
+}
 
-	r.queue <- question
+// resolve sends the question to the upstreams, caching the answer.
+func (r *resolver) resolve(ctx context.Context, z string, t uint16) (*dns.Msg, error) {
+	if len(r.upstreams) == 0 {
+		return nil, fmt.Errorf("No resolvers configured")
+	}
 
 	select {
-	case result := <-question.resultChan:
-		return result, nil
-	case err := <-question.errorChan:
-		return nil, err
+	case r.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	defer func() {
+		<-r.sem
+	}()
+
+	m := new(dns.Msg)
+	m.SetQuestion(z, t)
+	m.SetEdns0(r.bufSize, false)
+
+	for attempt := 1; ; attempt++ {
+		u := r.upstreams[(attempt-1)%len(r.upstreams)]
+
+		if err := r.limit.Wait(ctx); err != nil {
+			return nil, lookupError(z, t, nil, err)
+		}
+
+		msg, err := u.Exchange(ctx, m)
+		if ctx.Err() != nil {
+			return nil, lookupError(z, t, nil, ctx.Err())
+		}
+
+		outcome := Classify(msg, err)
+		if r.retry.Retryable(outcome) && attempt < r.retry.Attempts {
+			if err := sleep(ctx, r.retry.Delay(attempt)); err != nil {
+				return nil, lookupError(z, t, nil, err)
+			}
+
+			continue
+		} else if err != nil {
+			return nil, lookupError(z, t, nil, err)
+		}
+
+		r.cache.Set(msg)
+		return msg, nil
 	}
 }
@@ -0,0 +1,28 @@
+package plugins
+
+import (
+	"context"
+
+	dns "github.com/miekg/dns"
+)
+
+// txtRecords answers TXT questions with the records of the name, other
+// questions with NODATA.
+type txtRecords map[string][]string
+
+func (r txtRecords) Resolve(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.Response = true
+
+	if qtype == dns.TypeTXT {
+		for _, txt := range r[name] {
+			m.Answer = append(m.Answer, &dns.TXT{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+				Txt: []string{txt},
+			})
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,83 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	dns "github.com/miekg/dns"
+)
+
+// Run executes the check of plugin p against domain. When timeout is non
+// zero the check is bounded by it, in addition to any deadline ctx already
+// carries. A check that does not finish in time results in a single timed
+// out issue; issues still produced by the check afterwards are discarded.
+func Run(ctx context.Context, p Plugin, domain string, timeout time.Duration) <-chan Issue {
+	issuesChan := make(chan Issue)
+
+	go func() {
+		defer close(issuesChan)
+
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		start := time.Now()
+
+		issues := p.Check(ctx, domain)
+
+		for {
+			select {
+			case issue, ok := <-issues:
+				if !ok {
+					return
+				}
+
+				if issue.Plugin == "" {
+					issue.Plugin = p.Name()
+				}
+
+				if issue.Target == "" {
+					issue.Target = domain
+				}
+
+				// record which authoritative server served the record
+				if scan, ok := ctx.Value(scanKey{}).(*Scan); ok && issue.Evidence["name"] != "" {
+					if server := scan.Origin(issue.Evidence["name"], dns.StringToType[issue.Evidence["type"]]); server != "" {
+						issue = issue.With("server", server)
+					}
+				}
+
+				issuesChan <- issue
+			case <-ctx.Done():
+				// the plugin will notice the cancellation on its own,
+				// make sure it never blocks on sending.
+				go drain(issues)
+
+				issue := timedOut(ctx, time.Since(start))
+				issue.Plugin = p.Name()
+				issue.Target = domain
+
+				issuesChan <- issue
+				return
+			}
+		}
+	}()
+
+	return issuesChan
+}
+
+func timedOut(ctx context.Context, elapsed time.Duration) Issue {
+	if ctx.Err() == context.Canceled {
+		return FindingTimeout.Issue("", fmt.Sprintf("Check cancelled after %s", elapsed.Round(time.Millisecond)))
+	}
+
+	return FindingTimeout.Issue("", fmt.Sprintf("Check timed out after %s", elapsed.Round(time.Millisecond)))
+}
+
+func drain(issues <-chan Issue) {
+	for range issues {
+	}
+}
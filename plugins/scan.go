@@ -0,0 +1,348 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	dns "github.com/miekg/dns"
+)
+
+// Fact is a piece of information about a domain several plugins depend on.
+type Fact string
+
+const (
+	// FactMX are the MX records of the domain.
+	FactMX Fact = "mx"
+	// FactMXIPs are the addresses of all mail servers of the domain.
+	FactMXIPs Fact = "mx-ips"
+	// FactTXT are the TXT records at the apex of the domain.
+	FactTXT Fact = "txt"
+	// FactSPF are the SPF records of the domain.
+	FactSPF Fact = "spf"
+)
+
+// Dependent is implemented by plugins depending on facts of the scan, so
+// those can be gathered up front and concurrently.
+type Dependent interface {
+	Requires() []Fact
+}
+
+// Scan holds the state shared by all checks of a single domain. DNS answers
+// and facts derived from them are memoised, so shared work runs only once.
+type Scan struct {
+	Domain string
+
+	resolver Resolver
+
+	m    sync.Mutex
+	memo map[string]*memo
+}
+
+type memo struct {
+	done chan struct{}
+
+	value interface{}
+	err   error
+}
+
+// NewScan returns a scan of domain.
+func NewScan(domain string) *Scan {
+	return &Scan{
+		Domain:   domain,
+		resolver: r,
+		memo:     map[string]*memo{},
+	}
+}
+
+type scanKey struct{}
+
+// WithScan returns a context carrying scan, plugins checking scan.Domain will
+// use it.
+func WithScan(ctx context.Context, scan *Scan) context.Context {
+	return context.WithValue(ctx, scanKey{}, scan)
+}
+
+// scanFrom returns the scan of domain carried by ctx, or a new scan.
+func scanFrom(ctx context.Context, domain string) *Scan {
+	if scan, ok := ctx.Value(scanKey{}).(*Scan); ok && scan.Domain == domain {
+		return scan
+	}
+
+	return NewScan(domain)
+}
+
+// Memo returns the result of fn for key, calling fn only once per scan.
+// Plugins can use it to share derived results with other plugins. Results
+// of calls aborted by their context are not kept.
+func (s *Scan) Memo(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	s.m.Lock()
+
+	if m, ok := s.memo[key]; ok {
+		s.m.Unlock()
+
+		select {
+		case <-m.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if isContextError(m.err) {
+			// the context of the first caller was done, try again
+			return s.Memo(ctx, key, fn)
+		}
+
+		return m.value, m.err
+	}
+
+	m := &memo{
+		done: make(chan struct{}),
+	}
+
+	s.memo[key] = m
+	s.m.Unlock()
+
+	m.value, m.err = fn(ctx)
+
+	if isContextError(m.err) {
+		s.m.Lock()
+		delete(s.memo, key)
+		s.m.Unlock()
+	}
+
+	close(m.done)
+
+	return m.value, m.err
+}
+
+// Prefetch gathers facts concurrently, errors are left for the plugins
+// depending on the facts to report.
+func (s *Scan) Prefetch(ctx context.Context, facts ...Fact) {
+	wg := sync.WaitGroup{}
+
+	for _, fact := range facts {
+		wg.Add(1)
+
+		go func(fact Fact) {
+			defer wg.Done()
+
+			switch fact {
+			case FactMX:
+				s.MX(ctx)
+			case FactMXIPs:
+				s.MXIPs(ctx)
+			case FactTXT:
+				s.TXT(ctx)
+			case FactSPF:
+				s.SPF(ctx)
+			}
+		}(fact)
+	}
+
+	wg.Wait()
+}
+
+// ErrNotAuthoritative is returned for authoritative lookups when the
+// resolver does not query authoritative servers directly.
+var ErrNotAuthoritative = errors.New("Resolver does not support authoritative lookups, use the iterative resolver")
+
+// Lookup resolves name with type t. Answers are memoised for the scan.
+func (s *Scan) Lookup(ctx context.Context, name string, t uint16) (*dns.Msg, error) {
+	if _, ok := s.resolver.(AuthoritativeResolver); ok {
+		resp, err := s.Authoritative(ctx, name, t)
+		if err != nil {
+			return nil, err
+		}
+
+		return resp.Msg, nil
+	}
+
+	v, err := s.Memo(ctx, fmt.Sprintf("lookup %s %s", dns.Fqdn(name), dns.TypeToString[t]), func(ctx context.Context) (interface{}, error) {
+		return s.resolver.Resolve(ctx, dns.Fqdn(name), t)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*dns.Msg), nil
+}
+
+// Authoritative resolves name with type t at the authoritative servers, it
+// returns ErrNotAuthoritative if the resolver doesn't support this.
+func (s *Scan) Authoritative(ctx context.Context, name string, t uint16) (*Response, error) {
+	ar, ok := s.resolver.(AuthoritativeResolver)
+	if !ok {
+		return nil, ErrNotAuthoritative
+	}
+
+	v, err := s.Memo(ctx, fmt.Sprintf("authoritative %s %s", dns.Fqdn(name), dns.TypeToString[t]), func(ctx context.Context) (interface{}, error) {
+		return ar.ResolveAuthoritative(ctx, dns.Fqdn(name), t)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*Response), nil
+}
+
+// Origin returns the address of the authoritative server that answered the
+// lookup of name with type t, if known.
+func (s *Scan) Origin(name string, t uint16) string {
+	s.m.Lock()
+	m, ok := s.memo[fmt.Sprintf("authoritative %s %s", dns.Fqdn(name), dns.TypeToString[t])]
+	s.m.Unlock()
+
+	if !ok {
+		return ""
+	}
+
+	select {
+	case <-m.done:
+	default:
+		return ""
+	}
+
+	if resp, ok := m.value.(*Response); ok && resp != nil {
+		return resp.Server
+	}
+
+	return ""
+}
+
+// lookup is Lookup, returning a LookupError for answers with a non success
+// rcode. Answers without records (NODATA) are returned as is.
+func (s *Scan) lookup(ctx context.Context, name string, t uint16) (*dns.Msg, error) {
+	msg, err := s.Lookup(ctx, name, t)
+	if err := lookupError(dns.Fqdn(name), t, msg, err); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// MX returns the MX records of the domain.
+func (s *Scan) MX(ctx context.Context) ([]*dns.MX, error) {
+	msg, err := s.lookup(ctx, s.Domain, dns.TypeMX)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []*dns.MX{}
+	for _, a := range msg.Answer {
+		if mx, ok := a.(*dns.MX); ok {
+			records = append(records, mx)
+		}
+	}
+
+	return records, nil
+}
+
+// IPs returns the IPv4 and IPv6 addresses of host.
+func (s *Scan) IPs(ctx context.Context, host string) ([]net.IP, error) {
+	v, err := s.Memo(ctx, fmt.Sprintf("ips %s", dns.Fqdn(host)), func(ctx context.Context) (interface{}, error) {
+		ips := []net.IP{}
+
+		var lastErr error
+		for _, t := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			msg, err := s.lookup(ctx, host, t)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+
+			for _, a := range msg.Answer {
+				switch rr := a.(type) {
+				case *dns.A:
+					ips = append(ips, rr.A)
+				case *dns.AAAA:
+					ips = append(ips, rr.AAAA)
+				}
+			}
+		}
+
+		if len(ips) == 0 && lastErr != nil {
+			return nil, lastErr
+		}
+
+		return ips, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]net.IP), nil
+}
+
+// MXIPs returns the addresses of all mail servers, keyed by mail server.
+// Mail servers that could not be resolved are left out.
+func (s *Scan) MXIPs(ctx context.Context) (map[string][]net.IP, error) {
+	records, err := s.MX(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		host string
+		ips  []net.IP
+		err  error
+	}
+
+	resultChan := make(chan result, len(records))
+
+	for _, mx := range records {
+		go func(host string) {
+			ips, err := s.IPs(ctx, host)
+			resultChan <- result{host, ips, err}
+		}(mx.Mx)
+	}
+
+	addrs := map[string][]net.IP{}
+	for range records {
+		result := <-resultChan
+		if result.err != nil {
+			continue
+		}
+
+		addrs[result.host] = result.ips
+	}
+
+	return addrs, ctx.Err()
+}
+
+// TXT returns the TXT records at the apex of the domain, with the strings of
+// each record joined.
+func (s *Scan) TXT(ctx context.Context) ([]string, error) {
+	msg, err := s.lookup(ctx, s.Domain, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []string{}
+	for _, a := range msg.Answer {
+		if txt, ok := a.(*dns.TXT); ok {
+			records = append(records, strings.Join(txt.Txt, ""))
+		}
+	}
+
+	return records, nil
+}
+
+// SPF returns the SPF records of the domain.
+func (s *Scan) SPF(ctx context.Context) ([]string, error) {
+	records, err := s.TXT(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	spf := []string{}
+	for _, record := range records {
+		if record == "v=spf1" || strings.HasPrefix(record, "v=spf1 ") {
+			spf = append(spf, record)
+		}
+	}
+
+	return spf, nil
+}
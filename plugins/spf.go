@@ -1,13 +1,13 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	"bufio"
 	"os"
 	"strings"
 
-	"github.com/fatih/color"
 	dns "github.com/miekg/dns"
 )
 
@@ -15,8 +15,82 @@ var (
 	_ = Register(SPFPlugin)
 )
 
+var (
+	spfRecord = Finding{
+		ID:         "SPF-RECORD",
+		Severity:   SeverityInfo,
+		References: []string{"https://tools.ietf.org/html/rfc7208#section-4.5"},
+	}
+	spfConfigured = Finding{
+		ID:         "SPF-CONFIGURED",
+		Severity:   SeverityOK,
+		References: []string{"https://tools.ietf.org/html/rfc7208"},
+	}
+	spfMissing = Finding{
+		ID:          "SPF-MISSING",
+		Severity:    SeverityError,
+		Description: "Without SPF receivers cannot verify which servers are allowed to send mail for the domain.",
+		Remediation: "Publish a TXT record starting with \"v=spf1\" listing the servers that send mail for the domain, ending with \"-all\".",
+		References:  []string{"https://tools.ietf.org/html/rfc7208#section-3"},
+	}
+	spfAllNoQualifier = Finding{
+		ID:          "SPF-ALL-NO-QUALIFIER",
+		Severity:    SeverityError,
+		Description: "The all mechanism without qualifier defaults to +all, which allows every server to send mail for the domain.",
+		Remediation: "Use \"-all\" or \"~all\" instead of \"all\".",
+		References:  []string{"https://tools.ietf.org/html/rfc7208#section-4.6.2", "https://tools.ietf.org/html/rfc7208#section-5.1"},
+	}
+	spfMechanismPTR = Finding{
+		ID:          "SPF-MECHANISM-PTR",
+		Severity:    SeverityWarning,
+		Description: "If the domain name (PTR record) for the client's address is in the given domain and that domain name resolves to the client's address (forward-confirmed reverse DNS), match. This mechanism is deprecated and should no longer be used.",
+		Remediation: "Replace the ptr mechanism by ip4, ip6, a or include mechanisms.",
+		References:  []string{"https://tools.ietf.org/html/rfc7208#section-5.5"},
+	}
+	spfMechanismExists = Finding{
+		ID:          "SPF-MECHANISM-EXISTS",
+		Severity:    SeverityWarning,
+		Description: "If the given domain name resolves to any address, match (no matter the address it resolves to). This is rarely used. Along with the SPF macro language it offers more complex matches like DNSBL-queries.",
+		Remediation: "Verify the exists mechanism is intended, or replace it by ip4, ip6, a or include mechanisms.",
+		References:  []string{"https://tools.ietf.org/html/rfc7208#section-5.7"},
+	}
+	spfAllPass = Finding{
+		ID:          "SPF-ALL-PASS",
+		Severity:    SeverityError,
+		Description: "Allow all mail",
+		Remediation: "End the SPF record with \"-all\".",
+		References:  []string{"https://tools.ietf.org/html/rfc7208#section-5.1"},
+	}
+	spfAllNeutral = Finding{
+		ID:          "SPF-ALL-NEUTRAL",
+		Severity:    SeverityError,
+		Description: "No policy statement",
+		Remediation: "End the SPF record with \"-all\".",
+		References:  []string{"https://tools.ietf.org/html/rfc7208#section-5.1"},
+	}
+	spfAllSoftfail = Finding{
+		ID:          "SPF-ALL-SOFTFAIL",
+		Severity:    SeverityWarning,
+		Description: "Allow mail whether or not it matches the parameters in the record",
+		Remediation: "End the SPF record with \"-all\" once all servers sending mail for the domain are listed.",
+		References:  []string{"https://tools.ietf.org/html/rfc7208#section-5.1"},
+	}
+	spfAllFail = Finding{
+		ID:          "SPF-ALL-FAIL",
+		Severity:    SeverityOK,
+		Description: "Only allow mail that matches one of the parameters (IPv4, MX, etc) in the record",
+		References:  []string{"https://tools.ietf.org/html/rfc7208#section-5.1"},
+	}
+)
+
 func SPFPlugin(options ...OptionFn) Plugin {
-	return &spfPlugin{}
+	p := &spfPlugin{}
+
+	for _, optionFn := range options {
+		optionFn(p)
+	}
+
+	return p
 }
 
 type spfPlugin struct {
@@ -26,155 +100,215 @@ func (d *spfPlugin) Name() string {
 	return "SPF"
 }
 
-func (p *spfPlugin) Check(domain string) <-chan Issue {
+func (d *spfPlugin) Description() string {
+	return "Checks the SPF record of the domain and its all policy."
+}
+
+func (d *spfPlugin) Category() Category {
+	return CategoryAuthentication
+}
+
+func (d *spfPlugin) Requires() []Fact {
+	return []Fact{FactSPF}
+}
+
+func (d *spfPlugin) Findings() []Finding {
+	return []Finding{
+		spfRecord,
+		spfConfigured,
+		spfMissing,
+		spfAllNoQualifier,
+		spfMechanismPTR,
+		spfMechanismExists,
+		spfAllPass,
+		spfAllNeutral,
+		spfAllSoftfail,
+		spfAllFail,
+		FindingLookupError,
+	}
+}
+
+func (p *spfPlugin) Check(ctx context.Context, domain string) <-chan Issue {
 	issuesChan := make(chan Issue)
 
 	go func() {
 		defer close(issuesChan)
 
 		found := false
+		failed := false
+
+		name := fmt.Sprintf("%s.", domain)
 
 		defer func() {
 			if found {
-				issuesChan <- Issue{
-					Severity: SeverityOK,
-					Message:  fmt.Sprintf("SPF Records configured"),
-				}
-			} else {
-				issuesChan <- Issue{
-					Severity: SeverityError,
-					Message:  fmt.Sprintf("No SPF records configured."),
-				}
+				issuesChan <- spfConfigured.Issue(domain, fmt.Sprintf("SPF Records configured"))
+			} else if !failed {
+				issuesChan <- spfMissing.Issue(domain, fmt.Sprintf("No SPF records configured.")).
+					With("name", name).
+					With("type", "TXT")
 			}
 		}()
 
-		r, err := r.Resolve(fmt.Sprintf("%s.", domain), dns.TypeTXT)
-		if err != nil {
-			issuesChan <- Issue{
-				Severity: SeverityError,
-				Message:  fmt.Sprintf("Error retrieving TXT records: %s", err.Error()),
-			}
+		scan := scanFrom(ctx, domain)
+
+		records, err := scan.SPF(ctx)
+		if IsNotFound(err) {
 			return
-		}
+		} else if err != nil {
+			issuesChan <- lookupIssue(domain, "SPF", name, dns.TypeTXT, err)
 
-		if r.Rcode != dns.RcodeSuccess {
-			issuesChan <- Issue{
-				Severity: SeverityDebug,
-				Message:  fmt.Sprintf("Error retrieving TXT record: %s", dns.RcodeToString[r.Rcode]),
-			}
+			failed = true
 			return
 		}
 
-		for _, a := range r.Answer {
-			if txt, ok := a.(*dns.TXT); ok {
-				// https://emailcopilot.com/blog/how-should-i-end-my-spf-record-all/
+		for _, str := range records {
+			// https://emailcopilot.com/blog/how-should-i-end-my-spf-record-all/
 
-				allPolicy := "?"
+			allPolicy := "?"
 
-				str := strings.Join(txt.Txt, "")
-				if !strings.HasPrefix(str, "v=spf1") {
-					continue
-				}
+			issue := func(f Finding, message string) Issue {
+				return f.Issue(domain, message).
+					With("name", name).
+					With("type", "TXT").
+					With("record", str)
+			}
 
-				issuesChan <- Issue{
-					Severity: SeverityInfo,
-					Message:  fmt.Sprintf("%s", str),
-				}
+			lookups := spfLookups(ctx, scan, str, spfMaxLookups)
+
+			issuesChan <- issue(spfRecord, fmt.Sprintf("%s", str)).
+				With("lookups", fmt.Sprintf("%d", lookups))
+
+			found = true
+
+			// check version
+			scanner := bufio.NewScanner(strings.NewReader(str))
+
+			scanner.Split(bufio.ScanWords)
 
-				found = true
-
-				// check version
-				scanner := bufio.NewScanner(strings.NewReader(str))
-
-				scanner.Split(bufio.ScanWords)
-
-				for scanner.Scan() {
-					text := scanner.Text()
-
-					text = strings.TrimSpace(text)
-
-					if text == "all" {
-						issuesChan <- Issue{
-							Severity:    SeverityError,
-							Message:     fmt.Sprintf("Configuration error, all defaults to +all."),
-							Description: "",
-						}
-					}
-
-					rule := "+"
-					switch text[0] {
-					case '+':
-						rule = "+"
-						text = text[1:]
-					case '?':
-						rule = "?"
-						text = text[1:]
-					case '~':
-						rule = "~"
-						text = text[1:]
-					case '-':
-						rule = "-"
-						text = text[1:]
-					}
-
-					switch {
-					case strings.HasPrefix(text, "ip4:"):
-						// check for broad ip4 net
-					case strings.HasPrefix(text, "ip6:"):
-						// check for broad ip6 net
-					case strings.HasPrefix(text, "mx"):
-					case strings.HasPrefix(text, "ptr"):
-						issuesChan <- Issue{
-							Severity: SeverityWarning,
-							Message: fmt.Sprintf("warning: %s\n", color.RedString("PTR	If the domain name (PTR record) for the client's address is in the given domain and that domain name resolves to the client's address (forward-confirmed reverse DNS), match. This mechanism is deprecated and should no longer be used.[6]")),
-						}
-					case strings.HasPrefix(text, "exists"):
-						issuesChan <- Issue{
-							Severity: SeverityWarning,
-							Message:  fmt.Sprintf("warning %s\n", color.RedString("If the given domain name resolves to any address, match (no matter the address it resolves to). This is rarely used. Along with the SPF macro language it offers more complex matches like DNSBL-queries.")),
-						}
-					case text == "all":
-						allPolicy = rule
-					case text == "a":
-					case strings.HasPrefix(text, "include:"):
-					}
+			for scanner.Scan() {
+				text := scanner.Text()
+
+				text = strings.TrimSpace(text)
+
+				if text == "all" {
+					issuesChan <- issue(spfAllNoQualifier, fmt.Sprintf("Configuration error, all defaults to +all."))
 				}
 
-				if err := scanner.Err(); err != nil {
-					fmt.Fprintln(os.Stderr, "reading input:", err)
+				rule := "+"
+				switch text[0] {
+				case '+':
+					rule = "+"
+					text = text[1:]
+				case '?':
+					rule = "?"
+					text = text[1:]
+				case '~':
+					rule = "~"
+					text = text[1:]
+				case '-':
+					rule = "-"
+					text = text[1:]
 				}
 
-				switch allPolicy {
-				case "+":
-					issuesChan <- Issue{
-						Severity:    SeverityError,
-						Message:     fmt.Sprintf("SPF rule configured all to PASS"),
-						Description: "Allow all mail",
-					}
-				case "?":
-					issuesChan <- Issue{
-						Severity:    SeverityError,
-						Message:     fmt.Sprintf("SPF rule configured all to NEUTRAL"),
-						Description: "No policy statement",
-					}
-				case "~":
-					issuesChan <- Issue{
-						Severity:    SeverityWarning,
-						Message:     fmt.Sprintf("SPF rule configured all to SOFT_FAIL"),
-						Description: "Allow mail whether or not it matches the parameters in the record",
-					}
-				case "-":
-					issuesChan <- Issue{
-						Severity:    SeverityOK,
-						Message:     fmt.Sprintf("SPF rule configured all to FAIL"),
-						Description: "Only allow mail that matches one of the parameters (IPv4, MX, etc) in the record",
-					}
+				switch {
+				case strings.HasPrefix(text, "ip4:"):
+					// check for broad ip4 net
+				case strings.HasPrefix(text, "ip6:"):
+					// check for broad ip6 net
+				case strings.HasPrefix(text, "mx"):
+				case strings.HasPrefix(text, "ptr"):
+					issuesChan <- issue(spfMechanismPTR, fmt.Sprintf("SPF record uses the deprecated ptr mechanism")).
+						With("mechanism", text)
+				case strings.HasPrefix(text, "exists"):
+					issuesChan <- issue(spfMechanismExists, fmt.Sprintf("SPF record uses the exists mechanism")).
+						With("mechanism", text)
+				case text == "all":
+					allPolicy = rule
+				case text == "a":
+				case strings.HasPrefix(text, "include:"):
 				}
-			} else {
-				fmt.Printf("could not cast %#v\n", a)
+			}
+
+			if err := scanner.Err(); err != nil {
+				fmt.Fprintln(os.Stderr, "reading input:", err)
+			}
+
+			switch allPolicy {
+			case "+":
+				issuesChan <- issue(spfAllPass, fmt.Sprintf("SPF rule configured all to PASS")).
+					With("all", allPolicy)
+			case "?":
+				issuesChan <- issue(spfAllNeutral, fmt.Sprintf("SPF rule configured all to NEUTRAL")).
+					With("all", allPolicy)
+			case "~":
+				issuesChan <- issue(spfAllSoftfail, fmt.Sprintf("SPF rule configured all to SOFT_FAIL")).
+					With("all", allPolicy)
+			case "-":
+				issuesChan <- issue(spfAllFail, fmt.Sprintf("SPF rule configured all to FAIL")).
+					With("all", allPolicy)
 			}
 		}
 	}()
 
 	return issuesChan
 }
+
+// spfMaxLookups is the maximum number of DNS lookups while evaluating an SPF
+// record.
+const spfMaxLookups = 10
+
+// spfLookups counts the terms of record causing DNS lookups, following
+// include and redirect to the records they refer to. Every term counts, also
+// when it refers to a record counted before, see RFC 7208 section 4.6.4.
+// Counting stops once over limit, which also ends include loops.
+func spfLookups(ctx context.Context, scan *Scan, record string, limit int) int {
+	count := 0
+
+	for _, term := range strings.Fields(record) {
+		if count > limit {
+			break
+		}
+
+		term = strings.ToLower(strings.TrimLeft(term, "+-~?"))
+
+		target := ""
+
+		switch {
+		case strings.HasPrefix(term, "include:"):
+			target = strings.TrimPrefix(term, "include:")
+		case strings.HasPrefix(term, "redirect="):
+			target = strings.TrimPrefix(term, "redirect=")
+		case term == "a", strings.HasPrefix(term, "a:"), strings.HasPrefix(term, "a/"):
+		case term == "mx", strings.HasPrefix(term, "mx:"), strings.HasPrefix(term, "mx/"):
+		case term == "ptr", strings.HasPrefix(term, "ptr:"):
+		case strings.HasPrefix(term, "exists:"):
+		default:
+			continue
+		}
+
+		count++
+
+		// names with macros depend on the sender, they can't be followed
+		if target == "" || strings.Contains(target, "%") {
+			continue
+		}
+
+		msg, err := scan.Lookup(ctx, target, dns.TypeTXT)
+		if err != nil {
+			continue
+		}
+
+		for _, a := range msg.Answer {
+			txt, ok := a.(*dns.TXT)
+			if !ok {
+				continue
+			}
+
+			if s := strings.Join(txt.Txt, ""); s == "v=spf1" || strings.HasPrefix(s, "v=spf1 ") {
+				count += spfLookups(ctx, scan, s, limit-count)
+			}
+		}
+	}
+
+	return count
+}
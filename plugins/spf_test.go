@@ -0,0 +1,35 @@
+package plugins
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSPFLookups(t *testing.T) {
+	defer SetResolver(r)
+
+	SetResolver(txtRecords{
+		"a.example.com.":    {"v=spf1 a include:b.example.com -all"},
+		"b.example.com.":    {"v=spf1 ip4:192.0.2.0/24 -all"},
+		"loop.example.com.": {"v=spf1 include:loop.example.com -all"},
+	})
+
+	for _, tt := range []struct {
+		record  string
+		lookups int
+	}{
+		{"v=spf1 ip4:192.0.2.1 ip6:2001:db8::/32 -all", 0},
+		{"v=spf1 a mx:mail.example.com ptr exists:%{i}.example.com -all", 4},
+		{"v=spf1 include:b.example.com -all", 1},
+		// includes count again every time they are referred to
+		{"v=spf1 include:a.example.com include:a.example.com mx -all", 7},
+		{"v=spf1 redirect=a.example.com", 3},
+		{"v=spf1 include:%{d}.example.com -all", 1},
+		// counting stops past the limit
+		{"v=spf1 include:loop.example.com -all", spfMaxLookups + 1},
+	} {
+		if lookups := spfLookups(context.Background(), NewScan("example.com"), tt.record, spfMaxLookups); lookups != tt.lookups {
+			t.Errorf("%q: got %d lookups, expected %d", tt.record, lookups, tt.lookups)
+		}
+	}
+}
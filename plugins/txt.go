@@ -1,18 +1,31 @@
 package plugins
 
 import (
+	"context"
 	"fmt"
 
 	dns "github.com/miekg/dns"
-	"strings"
 )
 
 var (
 	_ = Register(TXTPlugin)
 )
 
+var (
+	txtRecord = Finding{
+		ID:       "TXT-RECORD",
+		Severity: SeverityInfo,
+	}
+)
+
 func TXTPlugin(options ...OptionFn) Plugin {
-	return &txtPlugin{}
+	p := &txtPlugin{}
+
+	for _, optionFn := range options {
+		optionFn(p)
+	}
+
+	return p
 }
 
 type txtPlugin struct {
@@ -22,39 +35,46 @@ func (d *txtPlugin) Name() string {
 	return "TXT"
 }
 
-func (p *txtPlugin) Check(domain string) <-chan Issue {
+func (d *txtPlugin) Description() string {
+	return "Lists the TXT records of the domain."
+}
+
+func (d *txtPlugin) Category() Category {
+	return CategoryDNS
+}
+
+func (d *txtPlugin) Requires() []Fact {
+	return []Fact{FactTXT}
+}
+
+func (d *txtPlugin) Findings() []Finding {
+	return []Finding{
+		txtRecord,
+		FindingLookupError,
+	}
+}
+
+func (p *txtPlugin) Check(ctx context.Context, domain string) <-chan Issue {
 	issuesChan := make(chan Issue)
 
 	go func() {
 		defer close(issuesChan)
 
-		r, err := r.Resolve(fmt.Sprintf("%s.", domain), dns.TypeTXT)
-		if err != nil {
-			issuesChan <- Issue{
-				Severity: SeverityError,
-				Message:  fmt.Sprintf("Error retrieving TXT records: %s", err.Error()),
-			}
-			return
-		}
+		scan := scanFrom(ctx, domain)
 
-		if r.Rcode != dns.RcodeSuccess {
-			issuesChan <- Issue{
-				Severity: SeverityDebug,
-				Message:  fmt.Sprintf("Error retrieving TXT record: %s", dns.RcodeToString[r.Rcode]),
-			}
+		name := fmt.Sprintf("%s.", domain)
+
+		records, err := scan.TXT(ctx)
+		if err != nil {
+			issuesChan <- lookupIssue(domain, "TXT", name, dns.TypeTXT, err)
 			return
 		}
 
-		for _, a := range r.Answer {
-			if txt, ok := a.(*dns.TXT); ok {
-				str := strings.Join(txt.Txt, "")
-				issuesChan <- Issue{
-					Severity: SeverityInfo,
-					Message:  fmt.Sprintf("%s", str),
-				}
-			} else {
-				fmt.Printf("could not cast %#v\n", a)
-			}
+		for _, str := range records {
+			issuesChan <- txtRecord.Issue(domain, fmt.Sprintf("%s", str)).
+				With("name", name).
+				With("type", "TXT").
+				With("record", str)
 		}
 	}()
 
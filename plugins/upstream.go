@@ -0,0 +1,178 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	dns "github.com/miekg/dns"
+)
+
+// upstream is a single server queries are sent to.
+type upstream interface {
+	Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error)
+
+	String() string
+}
+
+// dnsUpstream queries a server over UDP, retrying over TCP when the answer
+// is truncated.
+type dnsUpstream struct {
+	addr    string
+	bufSize uint16
+}
+
+func (u *dnsUpstream) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	msg, err := exchange(ctx, &dns.Client{Net: "udp", UDPSize: u.bufSize}, m, u.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if !msg.Truncated {
+		return msg, nil
+	}
+
+	msg, err = exchange(ctx, &dns.Client{Net: "tcp"}, m, u.addr)
+	if err != nil && !isContextError(err) {
+		return nil, fmt.Errorf("%w: %s", errTruncated, err.Error())
+	}
+
+	return msg, err
+}
+
+func (u *dnsUpstream) String() string {
+	return u.addr
+}
+
+// tlsUpstream queries a server using DNS-over-TLS (RFC 7858).
+type tlsUpstream struct {
+	addr       string
+	serverName string
+}
+
+func (u *tlsUpstream) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	return exchange(ctx, &dns.Client{
+		Net: "tcp-tls",
+		TLSConfig: &tls.Config{
+			ServerName: u.serverName,
+		},
+	}, m, u.addr)
+}
+
+func (u *tlsUpstream) String() string {
+	return fmt.Sprintf("tls://%s#%s", u.addr, u.serverName)
+}
+
+// httpsUpstream queries a server using DNS-over-HTTPS (RFC 8484).
+type httpsUpstream struct {
+	url    string
+	client *http.Client
+}
+
+func (u *httpsUpstream) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	// RFC 8484 section 4.1, the id should be 0 to improve caching
+	q := m.Copy()
+	q.Id = 0
+
+	data, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", u.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := u.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", u.url, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(body); err != nil {
+		return nil, err
+	}
+
+	msg.Id = m.Id
+	return msg, nil
+}
+
+func (u *httpsUpstream) String() string {
+	return u.url
+}
+
+// parseUpstream parses a server specification:
+//
+//	9.9.9.9, 9.9.9.9:53, udp://9.9.9.9:53   plain DNS
+//	tls://1.1.1.1:853#cloudflare-dns.com    DNS-over-TLS, with server name
+//	https://dns.google/dns-query            DNS-over-HTTPS
+func parseUpstream(spec string, bufSize uint16) (upstream, error) {
+	switch {
+	case strings.HasPrefix(spec, "https://"):
+		return &httpsUpstream{
+			url:    spec,
+			client: &http.Client{},
+		}, nil
+	case strings.HasPrefix(spec, "tls://"):
+		addr, serverName := strings.TrimPrefix(spec, "tls://"), ""
+		if i := strings.Index(addr, "#"); i != -1 {
+			addr, serverName = addr[:i], addr[i+1:]
+		}
+
+		addr = withPort(addr, "853")
+
+		if serverName == "" {
+			host, _, _ := net.SplitHostPort(addr)
+			if net.ParseIP(host) != nil {
+				return nil, fmt.Errorf("Server name required to verify %s, use tls://%s#<name>", spec, addr)
+			}
+
+			serverName = host
+		}
+
+		return &tlsUpstream{
+			addr:       addr,
+			serverName: serverName,
+		}, nil
+	case strings.Contains(spec, "://") && !strings.HasPrefix(spec, "udp://"):
+		return nil, fmt.Errorf("Unsupported resolver: %s", spec)
+	}
+
+	addr := withPort(strings.TrimPrefix(spec, "udp://"), "53")
+	if host, _, err := net.SplitHostPort(addr); err != nil || host == "" {
+		return nil, fmt.Errorf("Invalid resolver: %s", spec)
+	}
+
+	return &dnsUpstream{
+		addr:    addr,
+		bufSize: bufSize,
+	}, nil
+}
+
+func withPort(addr string, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+
+	return net.JoinHostPort(strings.Trim(addr, "[]"), port)
+}
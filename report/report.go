@@ -0,0 +1,307 @@
+// Package report holds the results of a checkmail run, grouped by domain and
+// then by plugin.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dutchcoders/checkmail/plugins"
+)
+
+// Report is the result of checking one or more domains.
+type Report struct {
+	Version  string    `json:"version"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Duration Duration  `json:"duration"`
+
+	Domains []*Domain `json:"domains"`
+}
+
+// Domain holds the checks of a single domain, in the order the plugins were
+// selected.
+type Domain struct {
+	Domain   string    `json:"domain"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Duration Duration  `json:"duration"`
+
+	// Fields are the other columns of the input the domain was read from.
+	Fields map[string]string `json:"fields,omitempty"`
+
+	Checks []*Check `json:"checks"`
+
+	// Score is set by Report.Score.
+	Score *Score `json:"score,omitempty"`
+}
+
+// Check holds the issues a plugin reported for a domain.
+type Check struct {
+	Plugin   string           `json:"plugin"`
+	Key      string           `json:"key"`
+	Category plugins.Category `json:"category"`
+	Started  time.Time        `json:"started"`
+	Finished time.Time        `json:"finished"`
+	Duration Duration         `json:"duration"`
+
+	Issues []plugins.Issue `json:"issues"`
+
+	// Suppressed are the issues suppressed as accepted risk.
+	Suppressed []Suppressed `json:"suppressed,omitempty"`
+}
+
+// Suppressed is an issue suppressed as accepted risk.
+type Suppressed struct {
+	plugins.Issue
+
+	Justification string    `json:"justification"`
+	Expires       time.Time `json:"expires"`
+}
+
+// New returns an empty report for checking domains with the selected
+// plugins. Every check is created up front, so each can be filled by its
+// own goroutine.
+func New(version string, domains []string, selected []plugins.Plugin) *Report {
+	r := &Report{
+		Version: version,
+		Started: time.Now(),
+		Domains: []*Domain{},
+	}
+
+	for _, domain := range domains {
+		d := &Domain{
+			Domain: domain,
+			Checks: []*Check{},
+		}
+
+		for _, p := range selected {
+			d.Checks = append(d.Checks, &Check{
+				Plugin:   p.Name(),
+				Key:      plugins.Key(p.Name()),
+				Category: p.Category(),
+				Issues:   []plugins.Issue{},
+			})
+		}
+
+		r.Domains = append(r.Domains, d)
+	}
+
+	return r
+}
+
+// Domain returns the results of domain, or nil.
+func (r *Report) Domain(domain string) *Domain {
+	for _, d := range r.Domains {
+		if d.Domain == domain {
+			return d
+		}
+	}
+
+	return nil
+}
+
+// Check returns the check of plugin, by name, or nil.
+func (d *Domain) Check(plugin string) *Check {
+	for _, c := range d.Checks {
+		if c.Plugin == plugin {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// Start marks the start of the check.
+func (c *Check) Start() {
+	c.Started = time.Now()
+}
+
+// Add adds an issue to the check.
+func (c *Check) Add(issue plugins.Issue) {
+	c.Issues = append(c.Issues, issue)
+}
+
+// Finish marks the end of the check.
+func (c *Check) Finish() {
+	c.Finished = time.Now()
+	c.Duration = Duration(c.Finished.Sub(c.Started))
+}
+
+// Finish marks the end of the run, deriving the timing of the domains from
+// their checks.
+func (r *Report) Finish() {
+	r.Finished = time.Now()
+	r.Duration = Duration(r.Finished.Sub(r.Started))
+
+	for _, d := range r.Domains {
+		d.Finish()
+	}
+}
+
+// Finish derives the timing of the domain from its checks.
+func (d *Domain) Finish() {
+	for _, c := range d.Checks {
+		if c.Started.IsZero() {
+			continue
+		}
+
+		if d.Started.IsZero() || c.Started.Before(d.Started) {
+			d.Started = c.Started
+		}
+
+		if c.Finished.After(d.Finished) {
+			d.Finished = c.Finished
+		}
+	}
+
+	d.Duration = Duration(d.Finished.Sub(d.Started))
+}
+
+// Status summarizes a check by its most severe issue.
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// Status returns fail if the check reported an error, warn if it reported a
+// warning and pass otherwise.
+func (c *Check) Status() Status {
+	status := StatusPass
+
+	for _, issue := range c.Issues {
+		switch issue.Severity {
+		case plugins.SeverityError:
+			return StatusFail
+		case plugins.SeverityWarning:
+			status = StatusWarn
+		}
+	}
+
+	return status
+}
+
+// Failed returns whether the check could not do its job, because it timed
+// out or a lookup got no answer, like on a resolver outage. Such failures may
+// go away when the check runs again. Lookups answered with an error because
+// of the domain, like a SERVFAIL, an unexpected rcode or a lame delegation,
+// are findings, not failures: they fail the same way again.
+func (c *Check) Failed() bool {
+	for _, issue := range c.Issues {
+		switch issue.ID {
+		case plugins.FindingTimeout.ID:
+			return true
+		case plugins.FindingLookupError.ID:
+			switch issue.Evidence["outcome"] {
+			case string(plugins.OutcomeTimeout):
+				return true
+			case string(plugins.OutcomeError):
+				if _, answered := issue.Evidence["rcode"]; !answered {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// Failed returns whether the run failed: more than half of the checks could
+// not be completed, as when the resolver is unusable. Checks failing here and
+// there, like on a transient resolver error, don't fail the run.
+func (r *Report) Failed() bool {
+	checks, failed := 0, 0
+
+	for _, d := range r.Domains {
+		for _, c := range d.Checks {
+			checks++
+
+			if c.Failed() {
+				failed++
+			}
+		}
+	}
+
+	return checks > 0 && failed*2 > checks
+}
+
+// Has returns whether any issue is as severe as severity, or more.
+func (r *Report) Has(severity plugins.Severity) bool {
+	for _, d := range r.Domains {
+		for _, issue := range d.Issues() {
+			if issue.Severity.AtLeast(severity) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Issues returns all issues of the domain, in check order.
+func (d *Domain) Issues() []plugins.Issue {
+	issues := []plugins.Issue{}
+	for _, c := range d.Checks {
+		issues = append(issues, c.Issues...)
+	}
+
+	return issues
+}
+
+// Suppressed returns the suppressed issues of all checks.
+func (d *Domain) Suppressed() []Suppressed {
+	suppressed := []Suppressed{}
+	for _, c := range d.Checks {
+		suppressed = append(suppressed, c.Suppressed...)
+	}
+
+	return suppressed
+}
+
+// Load reads a report written by --output json.
+func Load(path string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	r := &Report{}
+	if err := json.NewDecoder(f).Decode(r); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	return r, nil
+}
+
+// Duration is a time.Duration encoded as a string like "1.5s".
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(str)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
@@ -0,0 +1,68 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/dutchcoders/checkmail/plugins"
+)
+
+func lookup(outcome plugins.Outcome) plugins.Issue {
+	return plugins.FindingLookupError.Issue("example.com", "Lookup failed.").With("outcome", string(outcome))
+}
+
+func TestCheckFailed(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		issue  plugins.Issue
+		failed bool
+	}{
+		{"finding", plugins.Finding{ID: "SPF-MISSING", Severity: plugins.SeverityError}.Issue("example.com", "Missing."), false},
+		{"servfail", lookup(plugins.OutcomeServFail), false},
+		{"broken", lookup(plugins.OutcomeBroken).With("rcode", "NOTIMP"), false},
+		{"timeout", plugins.FindingTimeout.Issue("example.com", "Timed out."), true},
+		{"lookup timeout", lookup(plugins.OutcomeTimeout), true},
+		{"resolver unreachable", lookup(plugins.OutcomeError), true},
+		// answered, it fails the same way again
+		{"unexpected rcode", lookup(plugins.OutcomeError).With("rcode", "NOTAUTH"), false},
+	} {
+		c := &Check{Plugin: "SPF", Issues: []plugins.Issue{tt.issue}}
+
+		if failed := c.Failed(); failed != tt.failed {
+			t.Errorf("%s: got failed %t, expected %t", tt.name, failed, tt.failed)
+		}
+	}
+}
+
+func TestReportFailed(t *testing.T) {
+	for _, tt := range []struct {
+		checks int
+		failed int
+		want   bool
+	}{
+		{0, 0, false},
+		{100, 0, false},
+		// a transient error among many checks
+		{100000, 1, false},
+		{10, 5, false},
+		{10, 6, true},
+		{6, 6, true},
+	} {
+		r := &Report{}
+		d := &Domain{Domain: "example.com"}
+
+		for i := 0; i < tt.checks; i++ {
+			c := &Check{Plugin: "SPF"}
+			if i < tt.failed {
+				c.Issues = append(c.Issues, lookup(plugins.OutcomeError))
+			}
+
+			d.Checks = append(d.Checks, c)
+		}
+
+		r.Domains = append(r.Domains, d)
+
+		if failed := r.Failed(); failed != tt.want {
+			t.Errorf("%d of %d checks failed: got run failed %t, expected %t", tt.failed, tt.checks, failed, tt.want)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package report
+
+import (
+	"math"
+	"sort"
+
+	"github.com/dutchcoders/checkmail/plugins"
+)
+
+// Weights weigh the checks in the score of a domain. A check can cost at
+// most its weight within its category, the score of a category is the share
+// of its weight left. The overall score weighs the category scores.
+type Weights struct {
+	// Categories weigh the categories in the overall score.
+	Categories map[plugins.Category]float64
+
+	// Checks weigh the checks within their category, by plugin key.
+	// Checks without weight don't count.
+	Checks map[string]float64
+}
+
+// DefaultWeights are the weights used unless configured otherwise.
+var DefaultWeights = Weights{
+	Categories: map[plugins.Category]float64{
+		plugins.CategoryAuthentication: 50,
+		plugins.CategoryTransport:      25,
+		plugins.CategoryDNS:            25,
+	},
+	Checks: map[string]float64{
+		"dmarc":           35,
+		"spf":             35,
+		"dkim":            20,
+		"domainkey":       10,
+		"banner-grabbing": 100,
+		"dnssec":          60,
+		"mx":              20,
+		"ns":              20,
+		"txt":             0,
+	},
+}
+
+// Merge returns the weights with the weights of other replacing its own.
+func (w Weights) Merge(other Weights) Weights {
+	merged := Weights{
+		Categories: map[plugins.Category]float64{},
+		Checks:     map[string]float64{},
+	}
+
+	for _, m := range []Weights{w, other} {
+		for k, v := range m.Categories {
+			merged.Categories[k] = v
+		}
+
+		for k, v := range m.Checks {
+			merged.Checks[k] = v
+		}
+	}
+
+	return merged
+}
+
+// penalties are the share of the weight of a check a finding costs. Findings
+// add up, up to the full weight of the check.
+var penalties = map[plugins.Severity]float64{
+	plugins.SeverityError:   1,
+	plugins.SeverityWarning: 0.5,
+}
+
+// categoryTitles name the categories in a score.
+var categoryTitles = map[plugins.Category]string{
+	plugins.CategoryAuthentication: "sender authentication",
+	plugins.CategoryTransport:      "transport security",
+	plugins.CategoryDNS:            "DNS integrity",
+}
+
+// Score rates the email security of a domain from 0 to 100.
+type Score struct {
+	Score int    `json:"score"`
+	Grade string `json:"grade"`
+
+	Categories []CategoryScore `json:"categories"`
+
+	// Costs are the findings costing points, most expensive first.
+	Costs []Cost `json:"costs"`
+
+	// Partial is set when checks that could not be completed were left
+	// out of the score.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// CategoryScore is the score of the checks of a category.
+type CategoryScore struct {
+	Category plugins.Category `json:"category"`
+	Title    string           `json:"title"`
+	Score    int              `json:"score"`
+	Weight   float64          `json:"weight"`
+}
+
+// Cost is the number of points a finding cost the overall score.
+type Cost struct {
+	Plugin  string  `json:"plugin"`
+	ID      string  `json:"id"`
+	Target  string  `json:"target"`
+	Message string  `json:"message"`
+	Points  float64 `json:"points"`
+}
+
+// Grade returns the letter grade of a score.
+func Grade(score int) string {
+	switch {
+	case score >= 90:
+		return "A"
+	case score >= 80:
+		return "B"
+	case score >= 70:
+		return "C"
+	case score >= 60:
+		return "D"
+	}
+
+	return "F"
+}
+
+// Score scores every domain of the report.
+func (r *Report) Score(w Weights) {
+	for _, d := range r.Domains {
+		d.Score = d.score(w)
+	}
+}
+
+// Scored returns whether any domain of the report has a score.
+func (r *Report) Scored() bool {
+	for _, d := range r.Domains {
+		if d.Score != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Score returns the score of domain d, or nil when none of its weighed checks
+// could be completed.
+func (w Weights) Score(d *Domain) *Score {
+	return d.score(w)
+}
+
+func (d *Domain) score(w Weights) *Score {
+	type category struct {
+		weight float64
+		lost   float64
+		costs  []Cost
+	}
+
+	categories := map[plugins.Category]*category{}
+	partial := false
+
+	for _, c := range d.Checks {
+		weight := w.Checks[c.Key]
+		if weight <= 0 || w.Categories[c.Category] <= 0 {
+			continue
+		}
+
+		// a check that timed out or failed says nothing about the
+		// domain, and would cost as much as a broken configuration
+		if c.Failed() {
+			partial = true
+			continue
+		}
+
+		cat, ok := categories[c.Category]
+		if !ok {
+			cat = &category{}
+			categories[c.Category] = cat
+		}
+
+		cat.weight += weight
+
+		// the share of the weight of the check left to lose
+		left := 1.0
+
+		for _, issue := range c.Issues {
+			penalty := math.Min(penalties[issue.Severity], left)
+			if penalty <= 0 {
+				continue
+			}
+
+			left -= penalty
+			cat.lost += penalty * weight
+
+			cat.costs = append(cat.costs, Cost{
+				Plugin:  c.Plugin,
+				ID:      issue.ID,
+				Target:  issue.Target,
+				Message: issue.Message,
+				Points:  penalty * weight,
+			})
+		}
+	}
+
+	total := 0.0
+	for name := range categories {
+		total += w.Categories[name]
+	}
+
+	if total == 0 && partial {
+		return nil
+	}
+
+	s := &Score{
+		Score:      100,
+		Categories: []CategoryScore{},
+		Costs:      []Cost{},
+		Partial:    partial,
+	}
+
+	if total == 0 {
+		s.Grade = Grade(s.Score)
+		return s
+	}
+
+	score := 0.0
+
+	for _, name := range plugins.Categories {
+		cat, ok := categories[name]
+		if !ok {
+			continue
+		}
+
+		share := w.Categories[name] / total
+		catScore := 100 * (cat.weight - cat.lost) / cat.weight
+
+		score += share * catScore
+
+		s.Categories = append(s.Categories, CategoryScore{
+			Category: name,
+			Title:    categoryTitles[name],
+			Score:    int(math.Round(catScore)),
+			Weight:   w.Categories[name],
+		})
+
+		// express the costs in points of the overall score
+		for _, cost := range cat.costs {
+			cost.Points = round(100 * share * cost.Points / cat.weight)
+			s.Costs = append(s.Costs, cost)
+		}
+	}
+
+	sort.SliceStable(s.Costs, func(i, j int) bool {
+		return s.Costs[i].Points > s.Costs[j].Points
+	})
+
+	s.Score = int(math.Round(score))
+	s.Grade = Grade(s.Score)
+	return s
+}
+
+// round rounds to a single decimal.
+func round(v float64) float64 {
+	return math.Round(v*10) / 10
+}
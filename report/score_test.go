@@ -0,0 +1,91 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/dutchcoders/checkmail/plugins"
+)
+
+func TestGrade(t *testing.T) {
+	for _, tt := range []struct {
+		score int
+		grade string
+	}{
+		{100, "A"},
+		{90, "A"},
+		{89, "B"},
+		{80, "B"},
+		{79, "C"},
+		{70, "C"},
+		{69, "D"},
+		{60, "D"},
+		{59, "F"},
+		{50, "F"},
+		{0, "F"},
+	} {
+		if grade := Grade(tt.score); grade != tt.grade {
+			t.Errorf("%d: got grade %s, expected %s", tt.score, grade, tt.grade)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	w := Weights{
+		Categories: map[plugins.Category]float64{
+			plugins.CategoryAuthentication: 100,
+		},
+		Checks: map[string]float64{
+			"spf":   50,
+			"dmarc": 50,
+		},
+	}
+
+	var (
+		ok       = plugins.Finding{ID: "OK", Severity: plugins.SeverityOK}.Issue("example.com", "Configured.")
+		warning  = plugins.Finding{ID: "WARNING", Severity: plugins.SeverityWarning}.Issue("example.com", "Weak.")
+		broken   = plugins.FindingLookupError.Issue("example.com", "Lookup failed.").With("outcome", string(plugins.OutcomeServFail))
+		timeout  = plugins.FindingTimeout.Issue("example.com", "Timed out.")
+		resolver = plugins.FindingLookupError.Issue("example.com", "Lookup failed.").With("outcome", string(plugins.OutcomeError))
+	)
+
+	for _, tt := range []struct {
+		name    string
+		spf     []plugins.Issue
+		dmarc   []plugins.Issue
+		score   int
+		grade   string
+		partial bool
+	}{
+		{"configured", []plugins.Issue{ok}, []plugins.Issue{ok}, 100, "A", false},
+		{"warning", []plugins.Issue{warning}, []plugins.Issue{ok}, 75, "C", false},
+		{"warnings add up", []plugins.Issue{warning, warning, warning}, []plugins.Issue{ok}, 50, "F", false},
+		{"broken nameservers", []plugins.Issue{broken}, []plugins.Issue{warning}, 25, "F", false},
+		{"timeout", []plugins.Issue{timeout}, []plugins.Issue{ok}, 100, "A", true},
+		{"resolver failure", []plugins.Issue{resolver}, []plugins.Issue{warning}, 50, "F", true},
+	} {
+		d := &Domain{
+			Domain: "example.com",
+			Checks: []*Check{
+				{Plugin: "SPF", Key: "spf", Category: plugins.CategoryAuthentication, Issues: tt.spf},
+				{Plugin: "DMARC", Key: "dmarc", Category: plugins.CategoryAuthentication, Issues: tt.dmarc},
+			},
+		}
+
+		s := w.Score(d)
+		if s.Score != tt.score || s.Grade != tt.grade || s.Partial != tt.partial {
+			t.Errorf("%s: got %d %s partial %t, expected %d %s partial %t", tt.name, s.Score, s.Grade, s.Partial, tt.score, tt.grade, tt.partial)
+		}
+	}
+
+	d := &Domain{
+		Domain: "example.com",
+		Checks: []*Check{
+			{Plugin: "SPF", Key: "spf", Category: plugins.CategoryAuthentication, Issues: []plugins.Issue{timeout}},
+			{Plugin: "DMARC", Key: "dmarc", Category: plugins.CategoryAuthentication, Issues: []plugins.Issue{resolver}},
+		},
+	}
+
+	if s := w.Score(d); s != nil {
+		t.Errorf("all checks failed: got %d %s, expected no score", s.Score, s.Grade)
+	}
+}
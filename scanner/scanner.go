@@ -0,0 +1,205 @@
+// Package scanner schedules the checks of a run: every plugin checking every
+// domain is a unit of work, run concurrently by a bounded number of workers.
+package scanner
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// DefaultWorkers is the default number of checks running concurrently.
+const DefaultWorkers = 16
+
+// Scanner runs the checks of the selected plugins.
+type Scanner struct {
+	Plugins []plugins.Plugin
+
+	// Workers is the maximum number of checks running concurrently.
+	Workers int
+
+	// Timeout returns the time budget of a single check of plugin, 0
+	// disables.
+	Timeout func(p plugins.Plugin) time.Duration
+
+	// DomainTimeout is the time budget for all checks of a domain,
+	// starting at its first check, 0 disables.
+	DomainTimeout time.Duration
+
+	// Ordered passes the checks in domain then plugin order, instead of
+	// as they finish.
+	Ordered bool
+
+	// Progress is called whenever a check starts or finishes.
+	Progress func(done, running, total int)
+}
+
+// unit is a single plugin checking a single domain.
+type unit struct {
+	domain *domain
+	plugin plugins.Plugin
+	check  *report.Check
+}
+
+// domain holds the state shared by the checks of a domain.
+type domain struct {
+	*report.Domain
+
+	once   sync.Once
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	pending int
+}
+
+// start returns the context of the checks of the domain, the first call
+// starts the time budget and gathers the facts the plugins share.
+func (d *domain) start(ctx context.Context, timeout time.Duration, facts []plugins.Fact) context.Context {
+	d.once.Do(func() {
+		if timeout > 0 {
+			d.ctx, d.cancel = context.WithTimeout(ctx, timeout)
+		} else {
+			d.ctx, d.cancel = context.WithCancel(ctx)
+		}
+
+		scan := plugins.NewScan(d.Domain.Domain)
+		d.ctx = plugins.WithScan(d.ctx, scan)
+
+		// gather the facts the plugins share while the first
+		// plugins run
+		go scan.Prefetch(d.ctx, facts...)
+	})
+
+	return d.ctx
+}
+
+// Scan runs the checks of all domains of rep, filling in the report. Results
+// are passed to fn as soon as the check has finished or, when Ordered is set,
+// as soon as the check and all checks before it in domain then plugin order
+// have finished. Calls to fn and Progress are never concurrent, and are made
+// from the goroutine calling Scan.
+func (s *Scanner) Scan(ctx context.Context, rep *report.Report, fn func(domain string, p plugins.Plugin, c *report.Check)) {
+	facts := []plugins.Fact{}
+	for _, p := range s.Plugins {
+		if d, ok := p.(plugins.Dependent); ok {
+			facts = append(facts, d.Requires()...)
+		}
+	}
+
+	units := []*unit{}
+	for _, rd := range rep.Domains {
+		d := &domain{Domain: rd}
+
+		for _, p := range s.Plugins {
+			c := rd.Check(p.Name())
+			if c == nil {
+				continue
+			}
+
+			units = append(units, &unit{d, p, c})
+			d.pending++
+		}
+	}
+
+	workers := s.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	queue := make(chan int)
+	events := make(chan event, workers)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range queue {
+				events <- event{i, false}
+				s.run(ctx, units[i], facts)
+				events <- event{i, true}
+			}
+		}()
+	}
+
+	go func() {
+		for i := range units {
+			queue <- i
+		}
+
+		close(queue)
+
+		wg.Wait()
+		close(events)
+	}()
+
+	var (
+		done    = make([]bool, len(units))
+		next    = 0
+		count   = 0
+		running = 0
+	)
+
+	for ev := range events {
+		if !ev.finished {
+			running++
+			s.progress(count, running, len(units))
+			continue
+		}
+
+		u := units[ev.unit]
+
+		running--
+		count++
+		done[ev.unit] = true
+
+		if u.domain.pending--; u.domain.pending == 0 {
+			u.domain.cancel()
+		}
+
+		if !s.Ordered {
+			fn(u.domain.Domain.Domain, u.plugin, u.check)
+		}
+
+		for s.Ordered && next < len(units) && done[next] {
+			fn(units[next].domain.Domain.Domain, units[next].plugin, units[next].check)
+			next++
+		}
+
+		s.progress(count, running, len(units))
+	}
+}
+
+// event is a unit of work starting or finishing.
+type event struct {
+	unit     int
+	finished bool
+}
+
+func (s *Scanner) progress(done, running, total int) {
+	if s.Progress != nil {
+		s.Progress(done, running, total)
+	}
+}
+
+// run runs a single check, collecting its issues.
+func (s *Scanner) run(ctx context.Context, u *unit, facts []plugins.Fact) {
+	ctx = u.domain.start(ctx, s.DomainTimeout, facts)
+
+	timeout := time.Duration(0)
+	if s.Timeout != nil {
+		timeout = s.Timeout(u.plugin)
+	}
+
+	u.check.Start()
+	defer u.check.Finish()
+
+	for issue := range plugins.Run(ctx, u.plugin, u.domain.Domain.Domain, timeout) {
+		u.check.Add(issue)
+	}
+}
@@ -0,0 +1,88 @@
+package scanner
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// slowPlugin takes the delay of a domain to check it.
+type slowPlugin map[string]time.Duration
+
+func (p slowPlugin) Name() string                { return "Slow" }
+func (p slowPlugin) Description() string         { return "Takes its time." }
+func (p slowPlugin) Category() plugins.Category  { return plugins.CategoryDNS }
+func (p slowPlugin) Findings() []plugins.Finding { return nil }
+
+func (p slowPlugin) Check(ctx context.Context, domain string) <-chan plugins.Issue {
+	issues := make(chan plugins.Issue)
+
+	go func() {
+		defer close(issues)
+
+		select {
+		case <-time.After(p[domain]):
+		case <-ctx.Done():
+		}
+	}()
+
+	return issues
+}
+
+func TestScanOrder(t *testing.T) {
+	p := slowPlugin{
+		"a.example.com": 100 * time.Millisecond,
+		"b.example.com": 0,
+		"c.example.com": 50 * time.Millisecond,
+	}
+
+	domains := []string{"a.example.com", "b.example.com", "c.example.com"}
+
+	for _, tt := range []struct {
+		ordered bool
+		domains []string
+	}{
+		{true, domains},
+		{false, []string{"b.example.com", "c.example.com", "a.example.com"}},
+	} {
+		s := &Scanner{
+			Plugins: []plugins.Plugin{p},
+			Ordered: tt.ordered,
+		}
+
+		var calls int32
+
+		s.Progress = func(done, running, total int) {
+			if atomic.AddInt32(&calls, 1) != 1 {
+				t.Error("concurrent calls")
+			}
+
+			atomic.AddInt32(&calls, -1)
+		}
+
+		got := []string{}
+
+		s.Scan(context.Background(), report.New("test", domains, s.Plugins), func(domain string, p plugins.Plugin, c *report.Check) {
+			if atomic.AddInt32(&calls, 1) != 1 {
+				t.Error("concurrent calls")
+			}
+
+			defer atomic.AddInt32(&calls, -1)
+
+			if c.Finished.IsZero() {
+				t.Errorf("%s: check passed before it finished", domain)
+			}
+
+			got = append(got, domain)
+		})
+
+		if !reflect.DeepEqual(got, tt.domains) {
+			t.Errorf("ordered %t: got %v, expected %v", tt.ordered, got, tt.domains)
+		}
+	}
+}
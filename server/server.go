@@ -0,0 +1,404 @@
+// Package server serves the checks over a JSON API: scans are posted as jobs,
+// run in the background and polled for their status and report.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
+
+	"github.com/dutchcoders/checkmail/input"
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+var log = logging.MustGetLogger("check/server")
+
+// ScanFunc runs the checks of domains, only the checks matching selectors if
+// any, returning the finished report.
+type ScanFunc func(ctx context.Context, domains []string, selectors []string) (*report.Report, error)
+
+// Defaults of the server.
+const (
+	DefaultJobs       = 2
+	DefaultMaxDomains = 100
+	DefaultMaxQueued  = 100
+	DefaultRetention  = time.Hour
+)
+
+// errQueueFull is returned when a scan is posted while MaxQueued jobs wait.
+var errQueueFull = errors.New("Too many scans queued, try again later")
+
+// Server serves the API, and the static files of a web front-end.
+type Server struct {
+	Scan ScanFunc
+
+	// Path is the directory with static files served at /, none if empty.
+	Path string
+
+	// Jobs is the number of scans running concurrently, the others are
+	// queued.
+	Jobs int
+
+	// MaxDomains is the maximum number of domains of a single scan.
+	MaxDomains int
+
+	// MaxQueued is the maximum number of jobs waiting for a slot, 0
+	// doesn't limit.
+	MaxQueued int
+
+	// Retention is how long finished jobs are kept.
+	Retention time.Duration
+
+	// Timeout is the time budget of a single scan, 0 disables.
+	Timeout time.Duration
+
+	m     sync.Mutex
+	jobs  map[string]*Job
+	slots chan struct{}
+}
+
+// Status of a job.
+type Status string
+
+const (
+	StatusQueued  Status = "queued"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+)
+
+// Job is a scan posted to the API.
+type Job struct {
+	ID      string   `json:"id"`
+	Status  Status   `json:"status"`
+	Domains []string `json:"domains"`
+	Checks  []string `json:"checks,omitempty"`
+
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	Error  string         `json:"error,omitempty"`
+	Report *report.Report `json:"report,omitempty"`
+}
+
+// ScanRequest is the body of a posted scan.
+type ScanRequest struct {
+	Domains []string `json:"domains"`
+
+	// Checks optionally selects the checks by plugin name, key or
+	// category.
+	Checks []string `json:"checks"`
+}
+
+// Check describes a check in the list of checks.
+type Check struct {
+	Name        string            `json:"name"`
+	Key         string            `json:"key"`
+	Category    plugins.Category  `json:"category"`
+	Description string            `json:"description"`
+	Findings    []plugins.Finding `json:"findings"`
+}
+
+// New returns a server running scans with scan.
+func New(scan ScanFunc) *Server {
+	return &Server{
+		Scan:       scan,
+		Jobs:       DefaultJobs,
+		MaxDomains: DefaultMaxDomains,
+		MaxQueued:  DefaultMaxQueued,
+		Retention:  DefaultRetention,
+	}
+}
+
+// Handler returns the handler of the API and static files.
+func (s *Server) Handler() http.Handler {
+	s.jobs = map[string]*Job{}
+
+	jobs := s.Jobs
+	if jobs <= 0 {
+		jobs = DefaultJobs
+	}
+
+	s.slots = make(chan struct{}, jobs)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/scans", s.scans)
+	mux.HandleFunc("/api/scans/", s.scan)
+	mux.HandleFunc("/api/checks", s.checks)
+
+	if s.Path != "" {
+		mux.Handle("/", http.FileServer(http.Dir(s.Path)))
+	}
+
+	return mux
+}
+
+// ListenAndServe serves on addr.
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+// scans posts a scan, or lists the jobs.
+func (s *Server) scans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.m.Lock()
+		defer s.m.Unlock()
+
+		s.expire()
+
+		jobs := []Job{}
+		for _, job := range s.jobs {
+			summary := *job
+			summary.Report = nil
+			jobs = append(jobs, summary)
+		}
+
+		sort.Slice(jobs, func(i, j int) bool {
+			return jobs[i].Created.Before(jobs[j].Created)
+		})
+
+		writeJSON(w, http.StatusOK, jobs)
+	case http.MethodPost:
+		req := ScanRequest{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request: "+err.Error())
+			return
+		}
+
+		job, err := s.post(req)
+		if err == errQueueFull {
+			w.Header().Set("Retry-After", "60")
+			writeError(w, http.StatusTooManyRequests, err.Error())
+			return
+		} else if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		w.Header().Set("Location", "/api/scans/"+job.ID)
+		writeJSON(w, http.StatusAccepted, job)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// scan returns the status of a job, and its report once done.
+func (s *Server) scan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/scans/")
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Unknown scan: "+id)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
+
+// checks lists the available checks.
+func (s *Server) checks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	checks := []Check{}
+	for _, fn := range plugins.Plugins {
+		p := fn()
+
+		checks = append(checks, Check{
+			Name:        p.Name(),
+			Key:         plugins.Key(p.Name()),
+			Category:    p.Category(),
+			Description: p.Description(),
+			Findings:    p.Findings(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, checks)
+}
+
+// post validates req and queues its job, unless MaxQueued jobs are waiting
+// already.
+func (s *Server) post(req ScanRequest) (*Job, error) {
+	targets := []input.Target{}
+	for _, domain := range req.Domains {
+		n := input.Normalize(domain)
+		if n == "" {
+			continue
+		}
+
+		if !input.Valid(n) {
+			return nil, fmt.Errorf("Invalid domain: %s", strings.TrimSpace(domain))
+		}
+
+		targets = append(targets, input.Target{Domain: n})
+	}
+
+	domains := []string{}
+	for _, t := range input.Dedupe(targets) {
+		domains = append(domains, t.Domain)
+	}
+
+	if len(domains) == 0 {
+		return nil, errors.New("No domains to scan")
+	}
+
+	if s.MaxDomains > 0 && len(domains) > s.MaxDomains {
+		return nil, errors.New("Too many domains to scan")
+	}
+
+	if err := plugins.ValidateSelectors(req.Checks); err != nil {
+		return nil, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		ID:      id,
+		Status:  StatusQueued,
+		Domains: domains,
+		Checks:  req.Checks,
+		Created: time.Now(),
+	}
+
+	s.m.Lock()
+	s.expire()
+
+	if s.MaxQueued > 0 && s.queued() >= s.MaxQueued {
+		s.m.Unlock()
+		return nil, errQueueFull
+	}
+
+	s.jobs[id] = job
+	result := *job
+	s.m.Unlock()
+
+	go s.run(job)
+
+	return &result, nil
+}
+
+// run runs job once a slot is free.
+func (s *Server) run(job *Job) {
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	started := time.Now()
+
+	s.m.Lock()
+	job.Status = StatusRunning
+	job.Started = &started
+	s.m.Unlock()
+
+	ctx := context.Background()
+
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	rep, err := s.Scan(ctx, job.Domains, job.Checks)
+
+	finished := time.Now()
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	job.Finished = &finished
+
+	if err != nil {
+		log.Errorf("Error running scan %s: %s", job.ID, err.Error())
+
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		return
+	}
+
+	job.Status = StatusDone
+	job.Report = rep
+
+	if rep.Failed() {
+		job.Status = StatusFailed
+		job.Error = "Scan failed, checks could not be completed"
+	}
+}
+
+// queued returns the number of jobs waiting for a slot, s.m is held.
+func (s *Server) queued() int {
+	n := 0
+	for _, job := range s.jobs {
+		if job.Status == StatusQueued {
+			n++
+		}
+	}
+
+	return n
+}
+
+// expire removes the jobs finished longer than the retention ago, s.m is
+// held.
+func (s *Server) expire() {
+	if s.Retention <= 0 {
+		return
+	}
+
+	for id, job := range s.jobs {
+		if job.Finished != nil && time.Since(*job.Finished) > s.Retention {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// newID returns a random job ID.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(v); err != nil {
+		log.Errorf("Error writing response: %s", err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{
+		"error": message,
+	})
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// blockingScan returns a scan that signals on started and finishes once
+// release is closed.
+func blockingScan(started chan<- []string, release <-chan struct{}) ScanFunc {
+	return func(ctx context.Context, domains []string, selectors []string) (*report.Report, error) {
+		started <- domains
+
+		<-release
+
+		rep := &report.Report{}
+		for _, domain := range domains {
+			rep.Domains = append(rep.Domains, &report.Domain{Domain: domain})
+		}
+
+		return rep, nil
+	}
+}
+
+func do(t *testing.T, h http.Handler, method, path, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	v := map[string]interface{}{}
+	if strings.HasPrefix(w.Body.String(), "{") {
+		if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+			t.Fatalf("%s %s: %s", method, path, err)
+		}
+	}
+
+	return w, v
+}
+
+func TestPostAndPoll(t *testing.T) {
+	started := make(chan []string, 1)
+	release := make(chan struct{})
+
+	h := New(blockingScan(started, release)).Handler()
+
+	w, job := do(t, h, http.MethodPost, "/api/scans", `{"domains": [" Example.COM. ", "example.com", "", "example.org"]}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("got status %d, expected %d: %s", w.Code, http.StatusAccepted, w.Body.String())
+	}
+
+	id, _ := job["id"].(string)
+	if location := w.Header().Get("Location"); location != "/api/scans/"+id {
+		t.Errorf("got location %q, expected the job", location)
+	}
+
+	// normalized and deduplicated
+	if domains := <-started; !reflect.DeepEqual(domains, []string{"example.com", "example.org"}) {
+		t.Errorf("got domains %v, expected example.com and example.org", domains)
+	}
+
+	if _, job := do(t, h, http.MethodGet, "/api/scans/"+id, ""); job["status"] != string(StatusRunning) {
+		t.Errorf("got status %v, expected %s", job["status"], StatusRunning)
+	}
+
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w, job = do(t, h, http.MethodGet, "/api/scans/"+id, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d, expected %d", w.Code, http.StatusOK)
+		}
+
+		if job["status"] == string(StatusDone) {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("got status %v, expected the scan to finish", job["status"])
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, ok := job["report"]; !ok {
+		t.Errorf("expected the report of the finished job")
+	}
+
+	// the list leaves out the reports
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/scans", nil))
+
+	jobs := []Job{}
+	if err := json.Unmarshal(w.Body.Bytes(), &jobs); err != nil {
+		t.Fatal(err)
+	} else if len(jobs) != 1 || jobs[0].ID != id || jobs[0].Report != nil {
+		t.Errorf("got jobs %+v, expected the job without its report", jobs)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	started := make(chan []string, 10)
+	release := make(chan struct{})
+	defer close(release)
+
+	s := New(blockingScan(started, release))
+	s.MaxDomains = 2
+
+	h := s.Handler()
+
+	for _, tt := range []struct {
+		method string
+		path   string
+		body   string
+		code   int
+		err    string
+	}{
+		{http.MethodGet, "/api/scans/unknown", "", http.StatusNotFound, "Unknown scan: unknown"},
+		{http.MethodPut, "/api/scans", "", http.StatusMethodNotAllowed, "Method not allowed"},
+		{http.MethodPost, "/api/scans/unknown", "", http.StatusMethodNotAllowed, "Method not allowed"},
+		{http.MethodPost, "/api/checks", "", http.StatusMethodNotAllowed, "Method not allowed"},
+		{http.MethodPost, "/api/scans", `{"domains":`, http.StatusBadRequest, "Invalid request: unexpected EOF"},
+		{http.MethodPost, "/api/scans", `{"domains": [" "]}`, http.StatusBadRequest, "No domains to scan"},
+		{http.MethodPost, "/api/scans", `{"domains": ["example.com", "exa mple.com"]}`, http.StatusBadRequest, "Invalid domain: exa mple.com"},
+		{http.MethodPost, "/api/scans", `{"domains": ["a.example.com", "b.example.com", "c.example.com"]}`, http.StatusBadRequest, "Too many domains to scan"},
+		{http.MethodPost, "/api/scans", `{"domains": ["example.com"], "checks": ["unknown"]}`, http.StatusBadRequest, "unknown"},
+	} {
+		w, v := do(t, h, tt.method, tt.path, tt.body)
+		if w.Code != tt.code {
+			t.Errorf("%s %s: got status %d, expected %d", tt.method, tt.path, w.Code, tt.code)
+		}
+
+		if err, _ := v["error"].(string); !strings.Contains(err, tt.err) {
+			t.Errorf("%s %s: got error %q, expected %q", tt.method, tt.path, err, tt.err)
+		}
+	}
+
+	select {
+	case domains := <-started:
+		t.Errorf("got scan of %v, expected none", domains)
+	default:
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	started := make(chan []string, 10)
+	release := make(chan struct{})
+	defer close(release)
+
+	s := New(blockingScan(started, release))
+	s.Jobs = 1
+	s.MaxQueued = 1
+
+	h := s.Handler()
+
+	post := func() int {
+		w, _ := do(t, h, http.MethodPost, "/api/scans", `{"domains": ["example.com"]}`)
+		return w.Code
+	}
+
+	// the first job runs, the second is queued
+	if code := post(); code != http.StatusAccepted {
+		t.Fatalf("got status %d, expected %d", code, http.StatusAccepted)
+	}
+
+	<-started
+
+	if code := post(); code != http.StatusAccepted {
+		t.Fatalf("got status %d, expected %d", code, http.StatusAccepted)
+	}
+
+	w, v := do(t, h, http.MethodPost, "/api/scans", `{"domains": ["example.com"]}`)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d, expected %d", w.Code, http.StatusTooManyRequests)
+	} else if v["error"] != errQueueFull.Error() || w.Header().Get("Retry-After") == "" {
+		t.Errorf("got error %v and Retry-After %q, expected the queue to be full", v["error"], w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,115 @@
+// Package suppress applies suppressions of accepted risks to the results of
+// a run.
+package suppress
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dutchcoders/checkmail/config"
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// FindingExpired is reported for findings whose suppression expired.
+var FindingExpired = plugins.Finding{
+	ID:          "SUPPRESSION-EXPIRED",
+	Severity:    plugins.SeverityWarning,
+	Remediation: "Fix the finding, or review the accepted risk and renew the suppression with a new expiry date.",
+}
+
+// Suppressions match findings of checks against accepted risks.
+type Suppressions struct {
+	entries []config.Suppression
+
+	// Now returns the current time, deciding which suppressions expired.
+	Now func() time.Time
+}
+
+// New returns the suppressions of entries.
+func New(entries []config.Suppression) *Suppressions {
+	return &Suppressions{
+		entries: entries,
+		Now:     time.Now,
+	}
+}
+
+// matches returns whether e matches issue of domain.
+func matches(e config.Suppression, domain string, issue plugins.Issue) bool {
+	if !strings.EqualFold(e.Finding, issue.ID) {
+		return false
+	}
+
+	if !strings.EqualFold(e.Plugin, issue.Plugin) && e.Plugin != plugins.Key(issue.Plugin) {
+		return false
+	}
+
+	// the glob is validated when the suppressions are loaded
+	if ok, _ := path.Match(strings.ToLower(e.Domain), strings.ToLower(domain)); !ok {
+		return false
+	}
+
+	return e.Target == "" || strings.EqualFold(strings.TrimSuffix(e.Target, "."), strings.TrimSuffix(issue.Target, "."))
+}
+
+// Apply moves the issues of check matched by a suppression to its suppressed
+// issues. Issues matched by expired suppressions stay, with a warning about
+// the expired suppression.
+func (s *Suppressions) Apply(domain string, check *report.Check) {
+	if len(s.entries) == 0 {
+		return
+	}
+
+	now := s.Now()
+
+	issues := []plugins.Issue{}
+
+	for _, issue := range check.Issues {
+		var (
+			active  *config.Suppression
+			expired *config.Suppression
+		)
+
+		for i, e := range s.entries {
+			if !matches(e, domain, issue) {
+				continue
+			}
+
+			if now.Before(e.Expires) {
+				active = &s.entries[i]
+				break
+			} else if expired == nil {
+				expired = &s.entries[i]
+			}
+		}
+
+		if active != nil {
+			check.Suppressed = append(check.Suppressed, report.Suppressed{
+				Issue:         issue,
+				Justification: active.Justification,
+				Expires:       active.Expires,
+			})
+
+			continue
+		}
+
+		issues = append(issues, issue)
+
+		if expired != nil {
+			issues = append(issues, FindingExpired.Issue(issue.Target, fmt.Sprintf("Suppression of %s expired on %s: %s", issue.ID, expired.Expires.Format("2006-01-02"), expired.Justification)).
+				With("finding", issue.ID).
+				With("justification", expired.Justification).
+				With("expires", expired.Expires.Format("2006-01-02")))
+		}
+	}
+
+	for i := range issues {
+		if issues[i].Plugin == "" {
+			issues[i].Plugin = check.Plugin
+		}
+	}
+
+	check.Issues = issues
+}
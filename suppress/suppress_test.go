@@ -0,0 +1,66 @@
+package suppress
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dutchcoders/checkmail/config"
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+func TestApply(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	s := New([]config.Suppression{
+		{Plugin: "spf", Finding: "SPF-ALL-SOFTFAIL", Domain: "*.example.com", Justification: "migrating", Expires: now.AddDate(0, 1, 0)},
+		{Plugin: "DMARC", Finding: "DMARC-POLICY-NONE", Domain: "example.com", Justification: "monitoring", Expires: now.AddDate(0, -1, 0)},
+		{Plugin: "banner-grabbing", Finding: "STARTTLS-MISSING", Domain: "example.com", Target: "mx1.example.com.", Justification: "legacy", Expires: now.AddDate(1, 0, 0)},
+	})
+
+	s.Now = func() time.Time { return now }
+
+	for _, tt := range []struct {
+		domain     string
+		plugin     string
+		issue      plugins.Issue
+		issues     []string
+		suppressed []string
+	}{
+		// the glob matches subdomains at any depth, not the domain
+		{"mail.example.com", "SPF", plugins.Issue{ID: "SPF-ALL-SOFTFAIL", Target: "mail.example.com"}, []string{}, []string{"SPF-ALL-SOFTFAIL"}},
+		{"MAIL.Example.com", "SPF", plugins.Issue{ID: "spf-all-softfail", Target: "mail.example.com"}, []string{}, []string{"spf-all-softfail"}},
+		{"example.com", "SPF", plugins.Issue{ID: "SPF-ALL-SOFTFAIL", Target: "example.com"}, []string{"SPF-ALL-SOFTFAIL"}, []string{}},
+		{"a.b.example.com", "SPF", plugins.Issue{ID: "SPF-ALL-SOFTFAIL", Target: "a.b.example.com"}, []string{}, []string{"SPF-ALL-SOFTFAIL"}},
+		{"example.org", "SPF", plugins.Issue{ID: "SPF-ALL-SOFTFAIL", Target: "example.org"}, []string{"SPF-ALL-SOFTFAIL"}, []string{}},
+		// expired suppressions warn
+		{"example.com", "DMARC", plugins.Issue{ID: "DMARC-POLICY-NONE", Target: "example.com"}, []string{"DMARC-POLICY-NONE", "SUPPRESSION-EXPIRED"}, []string{}},
+		// the target has to match, if set
+		{"example.com", "Banner grabbing", plugins.Issue{ID: "STARTTLS-MISSING", Target: "mx1.example.com"}, []string{}, []string{"STARTTLS-MISSING"}},
+		{"example.com", "Banner grabbing", plugins.Issue{ID: "STARTTLS-MISSING", Target: "mx2.example.com"}, []string{"STARTTLS-MISSING"}, []string{}},
+	} {
+		tt.issue.Plugin = tt.plugin
+
+		c := &report.Check{Plugin: tt.plugin, Issues: []plugins.Issue{tt.issue}}
+		s.Apply(tt.domain, c)
+
+		issues := []string{}
+		for _, issue := range c.Issues {
+			issues = append(issues, issue.ID)
+
+			if issue.Plugin != tt.plugin {
+				t.Errorf("%s %s: got plugin %q, expected %q", tt.domain, issue.ID, issue.Plugin, tt.plugin)
+			}
+		}
+
+		suppressed := []string{}
+		for _, sup := range c.Suppressed {
+			suppressed = append(suppressed, sup.Issue.ID)
+		}
+
+		if !reflect.DeepEqual(issues, tt.issues) || !reflect.DeepEqual(suppressed, tt.suppressed) {
+			t.Errorf("%s %s: got issues %v suppressed %v, expected %v and %v", tt.domain, tt.issue.ID, issues, suppressed, tt.issues, tt.suppressed)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+// Package watch periodically rescans domains and alerts a webhook when the
+// findings of a domain changed since its last scan.
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/op/go-logging"
+
+	"github.com/dutchcoders/checkmail/diff"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+var log = logging.MustGetLogger("check/watch")
+
+// Defaults of the watcher.
+const (
+	DefaultInterval       = time.Hour
+	DefaultWebhookTimeout = 10 * time.Second
+
+	// DefaultAttempts is the number of times an alert is posted, waiting
+	// DefaultRetryDelay doubling between attempts, before it is kept for
+	// the next check.
+	DefaultAttempts   = 3
+	DefaultRetryDelay = time.Second
+)
+
+// maxPending bounds the number of alerts kept for delivery, the oldest are
+// dropped first.
+const maxPending = 1000
+
+// ScanFunc runs the checks of domains, returning the finished report.
+type ScanFunc func(ctx context.Context, domains []string) (*report.Report, error)
+
+// Watcher scans Domains every Interval, comparing every domain to its last
+// scan.
+type Watcher struct {
+	Scan    ScanFunc
+	Domains []string
+
+	Interval time.Duration
+
+	// Timeout is the time budget of a single scan, 0 disables.
+	Timeout time.Duration
+
+	// State is the directory the last scan of every domain is kept in, so
+	// changes are detected across restarts. Empty keeps them in memory.
+	State string
+
+	// Webhook is the URL alerts are posted to, alerts are only logged if
+	// empty.
+	Webhook string
+
+	Client *http.Client
+
+	// Attempts and RetryDelay control the retries of posting an alert.
+	Attempts   int
+	RetryDelay time.Duration
+
+	m    sync.Mutex
+	last map[string]*report.Domain
+
+	// pending are the alerts not delivered yet, oldest first
+	pending []*Alert
+}
+
+// Alert is posted to the webhook when the findings of a domain changed.
+type Alert struct {
+	Domain string `json:"domain"`
+
+	// Previous and Current are the times the compared scans finished.
+	Previous time.Time `json:"previous"`
+	Current  time.Time `json:"current"`
+
+	// Summary lists the changes, one per line.
+	Summary string `json:"summary"`
+
+	Diff *diff.Domain `json:"diff"`
+}
+
+// New returns a watcher scanning domains with scan.
+func New(scan ScanFunc, domains []string) *Watcher {
+	return &Watcher{
+		Scan:     scan,
+		Domains:  domains,
+		Interval: DefaultInterval,
+		Client: &http.Client{
+			Timeout: DefaultWebhookTimeout,
+		},
+		Attempts:   DefaultAttempts,
+		RetryDelay: DefaultRetryDelay,
+		last:       map[string]*report.Domain{},
+	}
+}
+
+// Run scans the domains right away and then every interval, until ctx is
+// done.
+func (w *Watcher) Run(ctx context.Context) {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		w.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check scans the domains once, alerting on the domains that changed. Alerts
+// that could not be delivered before are posted first.
+func (w *Watcher) Check(ctx context.Context) {
+	scanCtx := ctx
+	if w.Timeout > 0 {
+		var cancel context.CancelFunc
+		scanCtx, cancel = context.WithTimeout(ctx, w.Timeout)
+		defer cancel()
+	}
+
+	rep, err := w.Scan(scanCtx, w.Domains)
+	if err != nil {
+		log.Errorf("Error scanning: %s", err.Error())
+	} else {
+		for _, d := range rep.Domains {
+			if err := w.check(rep, d); err != nil {
+				log.Errorf("Error checking %s: %s", d.Domain, err.Error())
+			}
+		}
+	}
+
+	w.deliver(ctx)
+}
+
+// check compares d to the last scan of the domain, stores d as the last scan
+// and queues an alert when it changed. Checks that failed, like on a
+// resolver outage, are left out, so their findings don't show as resolved,
+// and keep their last result.
+func (w *Watcher) check(rep *report.Report, d *report.Domain) error {
+	completed := *d
+	completed.Checks = []*report.Check{}
+
+	for _, c := range d.Checks {
+		if c.Failed() {
+			log.Warningf("Check %s of %s failed, keeping its last result", c.Plugin, d.Domain)
+			continue
+		}
+
+		completed.Checks = append(completed.Checks, c)
+	}
+
+	last, err := w.load(d.Domain)
+	if err != nil {
+		return err
+	}
+
+	if last != nil {
+		changes := diff.Compare(single(rep.Version, last), single(rep.Version, &completed))
+
+		for _, dd := range changes.Domains {
+			if dd.Domain != d.Domain || dd.Empty() {
+				continue
+			}
+
+			w.queue(&Alert{
+				Domain:   d.Domain,
+				Previous: last.Finished,
+				Current:  d.Finished,
+				Summary:  summary(dd),
+				Diff:     dd,
+			})
+		}
+	}
+
+	return w.store(rep.Version, merge(last, d))
+}
+
+// queue logs alert and keeps it for delivery.
+func (w *Watcher) queue(alert *Alert) {
+	log.Warningf("Findings of %s changed:\n%s", alert.Domain, alert.Summary)
+
+	if w.Webhook == "" {
+		return
+	}
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if len(w.pending) >= maxPending {
+		log.Errorf("Too many undelivered alerts, dropping the alert of %s of %s", w.pending[0].Domain, w.pending[0].Current.Format(time.RFC3339))
+		w.pending = w.pending[1:]
+	}
+
+	w.pending = append(w.pending, alert)
+}
+
+// deliver posts the pending alerts in order. Once an alert could not be
+// delivered, it and the alerts after it are kept for the next check.
+func (w *Watcher) deliver(ctx context.Context) {
+	for {
+		w.m.Lock()
+		if len(w.pending) == 0 {
+			w.m.Unlock()
+			return
+		}
+
+		alert := w.pending[0]
+		w.m.Unlock()
+
+		if err := w.post(ctx, alert); err != nil {
+			log.Errorf("Error delivering the alert of %s, retrying with the next check: %s", alert.Domain, err.Error())
+			return
+		}
+
+		w.m.Lock()
+		w.pending = w.pending[1:]
+		w.m.Unlock()
+	}
+}
+
+// post posts alert to the webhook, retrying with backoff.
+func (w *Watcher) post(ctx context.Context, alert *Alert) error {
+	delay := w.RetryDelay
+
+	for attempt := 1; ; attempt++ {
+		err := w.alert(ctx, alert)
+		if err == nil || attempt >= w.Attempts {
+			return err
+		}
+
+		log.Warningf("Error delivering the alert of %s, retrying in %s: %s", alert.Domain, delay, err.Error())
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		delay *= 2
+	}
+}
+
+// merge returns d, with the last result of the checks that failed, if any.
+func merge(last, d *report.Domain) *report.Domain {
+	merged := *d
+	merged.Checks = []*report.Check{}
+
+	for _, c := range d.Checks {
+		if !c.Failed() {
+			merged.Checks = append(merged.Checks, c)
+		} else if last == nil {
+			continue
+		} else if lc := last.Check(c.Plugin); lc != nil {
+			merged.Checks = append(merged.Checks, lc)
+		}
+	}
+
+	return &merged
+}
+
+// single returns a report of the single domain d.
+func single(version string, d *report.Domain) *report.Report {
+	return &report.Report{
+		Version: version,
+		Domains: []*report.Domain{d},
+	}
+}
+
+// summary lists the changes of dd, one per line.
+func summary(dd *diff.Domain) string {
+	lines := []string{}
+
+	for _, c := range dd.New {
+		lines = append(lines, fmt.Sprintf("new [%s] %s: %s", c.After.Severity, c.After.ID, c.After.Message))
+	}
+
+	for _, c := range dd.Resolved {
+		lines = append(lines, fmt.Sprintf("resolved [%s] %s: %s", c.Before.Severity, c.Before.ID, c.Before.Message))
+	}
+
+	for _, c := range dd.Changed {
+		fields := []string{}
+		for _, f := range c.Fields {
+			fields = append(fields, fmt.Sprintf("%s %q -> %q", f.Name, f.Before, f.After))
+		}
+
+		lines = append(lines, fmt.Sprintf("changed [%s] %s: %s", c.After.Severity, c.After.ID, strings.Join(fields, ", ")))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// alert posts alert to the webhook.
+func (w *Watcher) alert(ctx context.Context, alert *Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
+
+// path returns the path of the state file of domain.
+func (w *Watcher) path(domain string) string {
+	return filepath.Join(w.State, strings.ToLower(strings.TrimSuffix(domain, "."))+".json")
+}
+
+// load returns the last scan of domain, or nil if it wasn't scanned before.
+func (w *Watcher) load(domain string) (*report.Domain, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if d, ok := w.last[domain]; ok || w.State == "" {
+		return d, nil
+	}
+
+	rep, err := report.Load(w.path(domain))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	d := rep.Domain(domain)
+	w.last[domain] = d
+	return d, nil
+}
+
+// store keeps d as the last scan of its domain.
+func (w *Watcher) store(version string, d *report.Domain) error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	w.last[d.Domain] = d
+
+	if w.State == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(w.State, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(single(version, d), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write and rename, so a crash never leaves a partial state file
+	tmp := w.path(d.Domain) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, w.path(d.Domain))
+}
@@ -0,0 +1,184 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dutchcoders/checkmail/plugins"
+	"github.com/dutchcoders/checkmail/report"
+)
+
+// webhook records the alerts posted to it, failing while down is set.
+type webhook struct {
+	m      sync.Mutex
+	down   bool
+	alerts []Alert
+}
+
+func (h *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	if h.down {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+
+	var alert Alert
+	if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.alerts = append(h.alerts, alert)
+}
+
+func (h *webhook) take() []Alert {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	alerts := h.alerts
+	h.alerts = nil
+	return alerts
+}
+
+func (h *webhook) setDown(down bool) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.down = down
+}
+
+func finding(plugin, id string, severity plugins.Severity, message string, evidence ...string) plugins.Issue {
+	i := plugins.Issue{ID: id, Plugin: plugin, Target: "example.com", Severity: severity, Message: message}
+
+	for n := 0; n+1 < len(evidence); n += 2 {
+		i = i.With(evidence[n], evidence[n+1])
+	}
+
+	return i
+}
+
+func banner(date string) plugins.Issue {
+	b := "220 mail.example.com ESMTP Exim 4.96 " + date
+	return finding("Banner grabbing", "SMTP-BANNER", plugins.SeverityInfo, "Banner mail.example.com(192.0.2.25) "+b, "port", "25", "banner", b)
+}
+
+func txt(records ...string) *report.Check {
+	c := &report.Check{Plugin: "TXT"}
+	for _, record := range records {
+		c.Issues = append(c.Issues, finding("TXT", "TXT-RECORD", plugins.SeverityInfo, record, "name", "example.com.", "record", record))
+	}
+
+	return c
+}
+
+func dmarc(policy string, severity plugins.Severity) *report.Check {
+	return &report.Check{Plugin: "DMARC", Issues: []plugins.Issue{
+		finding("DMARC", "DMARC-POLICY", severity, "Policy "+policy, "p", policy),
+	}}
+}
+
+func timedOut(plugin string) *report.Check {
+	i := plugins.FindingTimeout.Issue("example.com", "Timed out.")
+	i.Plugin = plugin
+	return &report.Check{Plugin: plugin, Issues: []plugins.Issue{i}}
+}
+
+// scans returns the checks of example.com for every scan in turn.
+type scans struct {
+	m      sync.Mutex
+	checks [][]*report.Check
+}
+
+func (s *scans) Scan(ctx context.Context, domains []string) (*report.Report, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	checks := s.checks[0]
+	s.checks = s.checks[1:]
+
+	return &report.Report{Domains: []*report.Domain{
+		{Domain: "example.com", Finished: time.Now(), Checks: checks},
+	}}, nil
+}
+
+func TestWatch(t *testing.T) {
+	hook := &webhook{}
+
+	srv := httptest.NewServer(hook)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	s := &scans{}
+
+	w := New(s.Scan, []string{"example.com"})
+	w.Webhook = srv.URL
+	w.State = dir
+	w.RetryDelay = time.Millisecond
+
+	for _, tt := range []struct {
+		name   string
+		checks []*report.Check
+		down   bool
+		alerts []string
+	}{
+		{"first scan", []*report.Check{dmarc("reject", plugins.SeverityOK), txt("v=spf1 -all"), {Plugin: "Banner grabbing", Issues: []plugins.Issue{banner("Thu, 01 Oct 2026 12:00:00 +0000")}}}, false, nil},
+		// the date in the banner changes every scan
+		{"banner date", []*report.Check{dmarc("reject", plugins.SeverityOK), txt("v=spf1 -all"), {Plugin: "Banner grabbing", Issues: []plugins.Issue{banner("Thu, 01 Oct 2026 13:00:00 +0000")}}}, false, nil},
+		// only the added record is new
+		{"record added", []*report.Check{dmarc("reject", plugins.SeverityOK), txt("v=spf1 -all", "verification=x"), {Plugin: "Banner grabbing", Issues: []plugins.Issue{banner("Thu, 01 Oct 2026 14:00:00 +0000")}}}, false, []string{"new [INFO] TXT-RECORD: verification=x"}},
+		// failed checks keep their last result
+		{"timed out", []*report.Check{timedOut("DMARC"), txt("v=spf1 -all", "verification=x"), timedOut("Banner grabbing")}, false, nil},
+		// the change is stored, and delivered once the webhook is up
+		{"webhook down", []*report.Check{dmarc("none", plugins.SeverityWarning), txt("v=spf1 -all", "verification=x")}, true, nil},
+		{"webhook up", []*report.Check{dmarc("none", plugins.SeverityWarning), txt("v=spf1 -all", "verification=x")}, false, []string{`changed [WARNING] DMARC-POLICY: severity "OK" -> "WARNING", p "reject" -> "none"`}},
+	} {
+		hook.setDown(tt.down)
+
+		s.checks = append(s.checks, tt.checks)
+		w.Check(context.Background())
+
+		summaries := []string{}
+		for _, alert := range hook.take() {
+			summaries = append(summaries, alert.Summary)
+		}
+
+		if len(summaries) != len(tt.alerts) {
+			t.Errorf("%s: got alerts %q, expected %q", tt.name, summaries, tt.alerts)
+			continue
+		}
+
+		for i := range summaries {
+			if summaries[i] != tt.alerts[i] {
+				t.Errorf("%s: got alert %q, expected %q", tt.name, summaries[i], tt.alerts[i])
+			}
+		}
+	}
+
+	// the state survives a restart
+	restarted := New(s.Scan, []string{"example.com"})
+	restarted.State = dir
+
+	last, err := restarted.load("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c := last.Check("DMARC"); c == nil || c.Issues[0].Evidence["p"] != "none" {
+		t.Errorf("got last DMARC check %+v, expected the stored change", c)
+	}
+}
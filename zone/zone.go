@@ -0,0 +1,228 @@
+// Package zone locates DNS records in zone files, so findings can point at
+// the line defining the record.
+package zone
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	dns "github.com/miekg/dns"
+)
+
+// Location is the place a record is defined.
+type Location struct {
+	File string
+	Line int
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+type entry struct {
+	rr       dns.RR
+	location Location
+}
+
+// Index holds the records of one or more zone files.
+type Index struct {
+	records map[string][]entry
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{
+		records: map[string][]entry{},
+	}
+}
+
+func key(name string, qtype uint16) string {
+	return fmt.Sprintf("%s %d", strings.ToLower(dns.Fqdn(name)), qtype)
+}
+
+// Load adds the records of the zone file at path. Relative names are
+// relative to origin, unless the file sets $ORIGIN. An empty origin defaults
+// to the file name without .zone or .db extension.
+func (idx *Index) Load(path, origin string) error {
+	if origin == "" {
+		origin = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".zone"), ".db")
+	}
+
+	origin = dns.Fqdn(origin)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var (
+		owner  = origin
+		ttl    = "3600"
+		record = ""
+		start  = 0
+		depth  = 0
+	)
+
+	scanner := bufio.NewScanner(f)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := stripComment(scanner.Text())
+
+		if depth == 0 {
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+
+			fields := strings.Fields(text)
+
+			switch strings.ToUpper(fields[0]) {
+			case "$ORIGIN":
+				if len(fields) > 1 {
+					origin = absolute(fields[1], origin)
+				}
+				continue
+			case "$TTL":
+				if len(fields) > 1 {
+					ttl = fields[1]
+				}
+				continue
+			case "$INCLUDE", "$GENERATE":
+				continue
+			}
+
+			// records starting with whitespace belong to the previous
+			// owner
+			if text[0] == ' ' || text[0] == '\t' {
+				text = owner + " " + text
+			} else {
+				owner = absolute(fields[0], origin)
+			}
+
+			start = line
+			record = text
+		} else {
+			record += " " + text
+		}
+
+		depth += parens(text)
+
+		if depth > 0 {
+			continue
+		}
+
+		depth = 0
+
+		rr, err := dns.NewRR(fmt.Sprintf("$ORIGIN %s\n$TTL %s\n%s", origin, ttl, record))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", path, start, err.Error())
+		} else if rr == nil {
+			continue
+		}
+
+		k := key(rr.Header().Name, rr.Header().Rrtype)
+		idx.records[k] = append(idx.records[k], entry{rr, Location{path, start}})
+	}
+
+	return scanner.Err()
+}
+
+// stripComment removes a trailing comment, outside of quoted strings.
+func stripComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return line[:i]
+			}
+		}
+	}
+
+	return line
+}
+
+// parens returns the number of opening minus closing parentheses of line,
+// outside of quoted strings.
+func parens(line string) int {
+	depth := 0
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case '(':
+			if !quoted {
+				depth++
+			}
+		case ')':
+			if !quoted {
+				depth--
+			}
+		}
+	}
+
+	return depth
+}
+
+// absolute returns name relative to origin as absolute name.
+func absolute(name, origin string) string {
+	if name == "@" {
+		return origin
+	}
+
+	if dns.IsFqdn(name) {
+		return name
+	}
+
+	return name + "." + origin
+}
+
+// Locate returns where the record of name and type qtype is defined. When
+// several records match, record (a TXT value or record in presentation
+// format) selects the one meant.
+func (idx *Index) Locate(name string, qtype uint16, record string) (Location, bool) {
+	entries := idx.records[key(name, qtype)]
+	if len(entries) == 0 {
+		return Location{}, false
+	}
+
+	if record != "" {
+		for _, e := range entries {
+			if matches(e.rr, record) {
+				return e.location, true
+			}
+		}
+	}
+
+	return entries[0].location, true
+}
+
+// matches returns whether rr has the value of record.
+func matches(rr dns.RR, record string) bool {
+	if txt, ok := rr.(*dns.TXT); ok {
+		return strings.Join(txt.Txt, "") == record
+	}
+
+	other, err := dns.NewRR(record)
+	if err != nil || other == nil {
+		return false
+	}
+
+	return rdata(rr) == rdata(other)
+}
+
+// rdata returns the data of rr in presentation format.
+func rdata(rr dns.RR) string {
+	return strings.ToLower(strings.TrimPrefix(rr.String(), rr.Header().String()))
+}
@@ -0,0 +1,102 @@
+package zone
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dns "github.com/miekg/dns"
+)
+
+const testZone = `; zone of example.com
+$TTL 300
+@	IN SOA ns1 hostmaster (
+		2024010101 ; serial
+		3600 900 604800 300 )
+	IN NS ns1
+	IN MX 10 mail
+	IN TXT "v=spf1 mx -all"
+	IN TXT "site-verification=abc; not a comment"
+ns1	IN A 192.0.2.53
+mail	IN A 192.0.2.25
+	IN A 192.0.2.26
+spf	IN TXT "v=spf1 (comment) -all"
+paren	IN TXT "unbalanced ("
+web	IN A 192.0.2.80
+
+$ORIGIN _domainkey.example.com.
+selector	IN TXT ( "v=DKIM1; k=rsa; "
+		"p=MIGf" )
+`
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "example.com.zone")
+	if err := ioutil.WriteFile(path, []byte(testZone), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := NewIndex()
+	if err := idx.Load(path, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		qtype  uint16
+		record string
+		line   int
+	}{
+		{"example.com", dns.TypeSOA, "", 3},
+		{"example.com.", dns.TypeNS, "", 6},
+		{"EXAMPLE.com", dns.TypeMX, "", 7},
+		{"example.com", dns.TypeTXT, "v=spf1 mx -all", 8},
+		{"example.com", dns.TypeTXT, "site-verification=abc; not a comment", 9},
+		{"example.com", dns.TypeTXT, "unknown", 8},
+		{"ns1.example.com", dns.TypeA, "", 10},
+		{"mail.example.com", dns.TypeA, "mail.example.com. 300 IN A 192.0.2.26", 12},
+		// parentheses in quoted strings don't continue the record
+		{"spf.example.com", dns.TypeTXT, "v=spf1 (comment) -all", 13},
+		{"paren.example.com", dns.TypeTXT, "unbalanced (", 14},
+		{"web.example.com", dns.TypeA, "", 15},
+		{"selector._domainkey.example.com", dns.TypeTXT, "v=DKIM1; k=rsa; p=MIGf", 18},
+	} {
+		loc, ok := idx.Locate(tt.name, tt.qtype, tt.record)
+		if !ok {
+			t.Errorf("%s %s: not found", tt.name, dns.TypeToString[tt.qtype])
+		} else if loc.File != path || loc.Line != tt.line {
+			t.Errorf("%s %s: got %s, expected line %d", tt.name, dns.TypeToString[tt.qtype], loc, tt.line)
+		}
+	}
+
+	if loc, ok := idx.Locate("www.example.com", dns.TypeA, ""); ok {
+		t.Errorf("www.example.com A: got %s, expected not found", loc)
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "example.com.db")
+	if err := ioutil.WriteFile(path, []byte("$TTL 300\n\nwww IN A 192.0.2.1\nmail IN A not-an-address\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewIndex().Load(path, "")
+	if err == nil || !strings.HasPrefix(err.Error(), path+":4: ") {
+		t.Errorf("got error %v, expected error at %s:4", err, path)
+	}
+}